@@ -0,0 +1,42 @@
+package profile
+
+import "context"
+
+// Run starts a profiling session with the given options and blocks
+// until it stops, either when ctx is done or, for example, after the
+// time given by Duration, returning any error starting the session or
+// writing its data. Run fits the lifecycle of a service run with
+// golang.org/x/sync/errgroup:
+//
+//	g, ctx := errgroup.WithContext(ctx)
+//	g.Go(func() error { return profile.Run(ctx, profile.CPUProfile) })
+//
+// Run returns nil, not ctx.Err(), when ctx is done.
+func Run(ctx context.Context, options ...Option) error {
+	p, err := StartWithContext(ctx, options...)
+	if err != nil {
+		return err
+	}
+	<-p.Done()
+	return p.Result().Err
+}
+
+// Actor returns a profiling session, started with the given options,
+// as the execute and interrupt functions of an actor in a
+// github.com/oklog/run Group:
+//
+//	var g run.Group
+//	g.Add(profile.Actor(profile.CPUProfile))
+//
+// execute runs the session, as Run does, until interrupt is called,
+// which stops the session and writes its data.
+func Actor(options ...Option) (execute func() error, interrupt func(error)) {
+	ctx, cancel := context.WithCancel(context.Background())
+	execute = func() error {
+		return Run(ctx, options...)
+	}
+	interrupt = func(error) {
+		cancel()
+	}
+	return execute, interrupt
+}
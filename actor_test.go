@@ -0,0 +1,44 @@
+package profile
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestRun(t *testing.T) {
+	dir := t.TempDir()
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error, 1)
+	go func() {
+		errc <- Run(ctx, GoroutineProfile, ProfilePath(dir), Quiet, NoShutdownHook)
+	}()
+	cancel()
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "goroutine.pprof")); err != nil {
+		t.Error(err)
+	}
+	if err := Run(context.Background(), ProfileFilename("../cpu.pprof")); err == nil {
+		t.Error("expected error starting an invalid session")
+	}
+}
+
+func TestActor(t *testing.T) {
+	dir := t.TempDir()
+	execute, interrupt := Actor(GoroutineProfile, ProfilePath(dir), Quiet, NoShutdownHook)
+	errc := make(chan error, 1)
+	go func() {
+		errc <- execute()
+	}()
+	interrupt(errors.New("stopping"))
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "goroutine.pprof")); err != nil {
+		t.Error(err)
+	}
+}
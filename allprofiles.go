@@ -0,0 +1,37 @@
+package profile
+
+import (
+	"fmt"
+	"runtime/pprof"
+	"strings"
+)
+
+// AllProfiles writes every profile known to runtime/pprof, including
+// those registered with pprof.NewProfile, when the session stops.
+// Each profile is written to its own file named after the profile.
+// It is intended for one-shot diagnostics of a misbehaving process;
+// the block and mutex profiles are only populated if their rates
+// were set elsewhere, see BlockProfile and MutexProfile.
+// It replaces any previously selected profiling mode.
+func AllProfiles(p *Profile) error { return p.setMode(AllMode) }
+
+func (prof *Profile) startAll() error {
+	prof.logAttrs("profile: all profiles enabled", "path", prof.dir)
+	prof.closer = func() error {
+		var err error
+		for _, p := range pprof.Profiles() {
+			w, fn, cerr := prof.createLookup(strings.Replace(p.Name(), "/", "_", -1))
+			if cerr != nil {
+				cerr = fmt.Errorf("could not create %s profile %q: %v", p.Name(), fn, cerr)
+			} else {
+				cerr = prof.writeLookup(w, p.Name())
+			}
+			if err == nil {
+				err = cerr
+			}
+		}
+		prof.logAttrs("profile: all profiles disabled", "path", prof.dir)
+		return err
+	}
+	return nil
+}
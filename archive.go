@@ -0,0 +1,129 @@
+package profile
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"time"
+)
+
+// ArchiveOutput packages the files written by the session, together
+// with a metadata.json file describing the session, into a single
+// profile-<timestamp>.tar.gz file in the profile directory when the
+// session stops, which is easier to attach to a ticket or copy to
+// object storage. The packaged files are removed, leaving the archive
+// as the only file reported by Result and copied by Upload.
+func ArchiveOutput(p *Profile) error {
+	p.archive = true
+	return nil
+}
+
+// archiveMetadata is written to metadata.json by ArchiveOutput.
+type archiveMetadata struct {
+	Mode      string    `json:"mode"`
+	Start     time.Time `json:"start"`
+	End       time.Time `json:"end"`
+	Hostname  string    `json:"hostname"`
+	PID       int       `json:"pid"`
+	Program   string    `json:"program"`
+	GoVersion string    `json:"go_version"`
+	GOOS      string    `json:"goos"`
+	GOARCH    string    `json:"goarch"`
+	Files     []string  `json:"files"`
+}
+
+// writeArchive replaces the session's files with an archive of them.
+func (p *Profile) writeArchive() error {
+	files := p.Files()
+	md := archiveMetadata{
+		Mode:      p.mode.String(),
+		Start:     p.started,
+		End:       time.Now(),
+		PID:       os.Getpid(),
+		Program:   os.Args[0],
+		GoVersion: runtime.Version(),
+		GOOS:      runtime.GOOS,
+		GOARCH:    runtime.GOARCH,
+	}
+	md.Hostname, _ = os.Hostname()
+	for _, fn := range files {
+		md.Files = append(md.Files, filepath.Base(fn))
+	}
+	metadata, err := json.MarshalIndent(md, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	fn := filepath.Join(p.dir, "profile-"+p.started.UTC().Format(timestampLayout)+".tar.gz")
+	f, err := p.createFile(fn)
+	if err != nil {
+		return fmt.Errorf("profile: could not create archive %q: %v", fn, err)
+	}
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+	err = tw.WriteHeader(&tar.Header{
+		Name:    "metadata.json",
+		Mode:    0644,
+		Size:    int64(len(metadata)),
+		ModTime: md.End,
+	})
+	if err == nil {
+		_, err = tw.Write(metadata)
+	}
+	for _, name := range files {
+		if err != nil {
+			break
+		}
+		err = addToArchive(tw, name)
+	}
+	if cerr := tw.Close(); err == nil {
+		err = cerr
+	}
+	if cerr := gz.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		// leave no truncated archive under its final name
+		f.discard()
+	} else {
+		err = f.Close()
+	}
+	if err != nil {
+		return fmt.Errorf("profile: could not write archive %q: %v", fn, err)
+	}
+
+	for _, name := range files {
+		os.Remove(name)
+	}
+	p.mu.Lock()
+	p.files = []string{fn}
+	p.mu.Unlock()
+	p.logAttrs("profile: archive written", "path", fn)
+	return nil
+}
+
+func addToArchive(tw *tar.Writer, name string) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	hdr, err := tar.FileInfoHeader(fi, "")
+	if err != nil {
+		return err
+	}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	_, err = io.Copy(tw, f)
+	return err
+}
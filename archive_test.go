@@ -0,0 +1,85 @@
+package profile
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestArchiveOutput(t *testing.T) {
+	dir := t.TempDir()
+	p, err := StartErr(GoroutineProfile, ArchiveOutput, ExpvarSnapshot, ProfilePath(dir), Quiet, NoShutdownHook)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+	files := p.Result().Files
+	want := filepath.Join(dir, "profile-"+p.started.UTC().Format(timestampLayout)+".tar.gz")
+	if len(files) != 1 || files[0] != want {
+		t.Fatalf("got files %q, want %q", files, want)
+	}
+	if got, _ := filepath.Glob(filepath.Join(dir, "*")); len(got) != 1 {
+		t.Fatalf("packaged files were not removed, got %q", got)
+	}
+
+	f, err := os.Open(want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	contents := make(map[string][]byte)
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		contents[hdr.Name], err = ioutil.ReadAll(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	var md archiveMetadata
+	if err := json.Unmarshal(contents["metadata.json"], &md); err != nil {
+		t.Fatal(err)
+	}
+	if md.Mode != "goroutine" || len(md.Files) != 2 {
+		t.Fatalf("unexpected metadata: %+v", md)
+	}
+	if _, err := parseProto(contents["goroutine.pprof"]); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := contents["expvar.json"]; !ok {
+		t.Fatal("archive does not contain expvar.json")
+	}
+}
+
+func TestArchiveOutputError(t *testing.T) {
+	dir := t.TempDir()
+	p, err := configure(GoroutineProfile, ArchiveOutput, ProfilePath(dir), Quiet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.dir = dir
+	p.files = []string{filepath.Join(dir, "missing.pprof")}
+	if err := p.writeArchive(); err == nil {
+		t.Fatal("expected an error archiving a missing file")
+	}
+	if got, _ := filepath.Glob(filepath.Join(dir, "*")); len(got) != 0 {
+		t.Fatalf("got files %q, want the incomplete archive removed", got)
+	}
+}
@@ -0,0 +1,235 @@
+package profile
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// AttachInfo is the content of the discovery file written by
+// Attachable, which describes how to reach a process's control server.
+type AttachInfo struct {
+	PID     int       `json:"pid"`
+	Socket  string    `json:"socket"`
+	Program string    `json:"program"`
+	Started time.Time `json:"started"`
+}
+
+// attachDir returns the directory holding the sockets and discovery
+// files of Attachable processes run by the current user, preferring
+// the user's runtime directory to the shared temporary directory.
+func attachDir() string {
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		return filepath.Join(dir, "profile-attach")
+	}
+	return filepath.Join(os.TempDir(), "profile-attach-"+strconv.Itoa(os.Getuid()))
+}
+
+// openAttachDir returns attachDir, creating it if create is true, and
+// reports an error unless it is a directory, not a symlink, which only
+// the current user can access. Otherwise another user could create
+// the directory first, and so control the sockets and discovery files
+// in it.
+func openAttachDir(create bool) (string, error) {
+	dir := attachDir()
+	if create {
+		if err := os.Mkdir(dir, 0700); err != nil && !os.IsExist(err) {
+			return "", fmt.Errorf("profile: could not create attach directory: %v", err)
+		}
+	}
+	fi, err := os.Lstat(dir)
+	if err != nil {
+		return "", err
+	}
+	if !fi.IsDir() || !privateDir(fi) {
+		return "", fmt.Errorf("profile: attach directory %s must be a directory with mode 0700 owned by the current user", dir)
+	}
+	return dir, nil
+}
+
+// Attachable lets profiling of the process be started on demand by the
+// profile command, for example
+//
+//	profile attach <pid> start cpu 30s
+//
+// without profiling having been enabled when the program started. It
+// listens for commands, as ListenControl does, on a socket in a
+// directory only accessible by the current user, and writes a
+// discovery file named after the process id, see Attach. Sessions
+// are started with the given options. The caller should call Close
+// on the value returned when the process no longer needs to be
+// attachable. See AttachOnSignal to make the process attachable only
+// when the profile command asks for it.
+func Attachable(options ...Option) (*ControlServer, error) {
+	dir, err := openAttachDir(true)
+	if err != nil {
+		return nil, err
+	}
+	pid := os.Getpid()
+	info := AttachInfo{
+		PID:     pid,
+		Socket:  filepath.Join(dir, strconv.Itoa(pid)+".sock"),
+		Program: os.Args[0],
+		Started: time.Now(),
+	}
+	s, err := ListenControl(info.Socket, options...)
+	if err != nil {
+		return nil, err
+	}
+	buf, err := json.Marshal(info)
+	if err == nil {
+		s.discovery = filepath.Join(dir, strconv.Itoa(pid)+".json")
+		err = ioutil.WriteFile(s.discovery, buf, 0600)
+	}
+	if err != nil {
+		s.Close()
+		return nil, fmt.Errorf("profile: could not write attach discovery file: %v", err)
+	}
+	return s, nil
+}
+
+// LookupAttach returns the discovery file written by Attachable in the
+// process with the given pid, which must be run by the current user.
+func LookupAttach(pid int) (AttachInfo, error) {
+	var info AttachInfo
+	dir, err := openAttachDir(false)
+	if os.IsNotExist(err) {
+		return info, fmt.Errorf("profile: process %d is not attachable", pid)
+	}
+	if err != nil {
+		return info, err
+	}
+	buf, err := ioutil.ReadFile(filepath.Join(dir, strconv.Itoa(pid)+".json"))
+	if os.IsNotExist(err) {
+		return info, fmt.Errorf("profile: process %d is not attachable", pid)
+	}
+	if err != nil {
+		return info, err
+	}
+	err = json.Unmarshal(buf, &info)
+	return info, err
+}
+
+// Attach sends command to the Attachable process with the given pid,
+// see ListenControl for the commands, and returns its response.
+func Attach(pid int, command string) (string, error) {
+	info, err := LookupAttach(pid)
+	if err != nil {
+		return "", err
+	}
+	return Control(info.Socket, command)
+}
+
+// AttachOnSignal arranges for the process to call Attachable, with the
+// given options, when the profile command asks it to, so that a
+// process which links this package, but has not enabled profiling, can
+// be profiled on demand without listening on a socket until then. The
+// profile command asks by writing a request file next to the discovery
+// files and sending the process SIGUSR1, see RequestAttach; SIGUSR1
+// without a request file is ignored. Until then the process is marked
+// by a file, named after its pid, next to the discovery files, so that
+// the profile command never sends SIGUSR1, whose default action is to
+// terminate the process, to processes which do not handle it. Call
+// the function returned to stop handling SIGUSR1, remove the marker
+// and close the control server, if any; it may be called more than
+// once.
+// AttachOnSignal is not supported on Windows and Plan 9.
+func AttachOnSignal(options ...Option) (stop func(), err error) {
+	if attachSignal == nil {
+		return nil, fmt.Errorf("profile: AttachOnSignal is not supported on %s", runtime.GOOS)
+	}
+	dir, err := openAttachDir(true)
+	if err != nil {
+		return nil, err
+	}
+	request := filepath.Join(dir, strconv.Itoa(os.Getpid())+".attach")
+	marker := filepath.Join(dir, strconv.Itoa(os.Getpid())+".signal")
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, attachSignal)
+	if err := ioutil.WriteFile(marker, nil, 0600); err != nil {
+		signal.Stop(c)
+		return nil, fmt.Errorf("profile: could not write attach marker: %v", err)
+	}
+	quit := make(chan struct{})
+	done := make(chan struct{})
+	var s *ControlServer
+	go func() {
+		defer close(done)
+		for {
+			select {
+			case <-c:
+			case <-quit:
+				return
+			}
+			if s != nil {
+				continue
+			}
+			if _, err := os.Lstat(request); err != nil {
+				continue // not asked by the profile command
+			}
+			os.Remove(request)
+			var err error
+			if s, err = Attachable(options...); err != nil {
+				log.Printf("profile: could not make process attachable: %v", err)
+			}
+		}
+	}()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			os.Remove(marker)
+			signal.Stop(c)
+			close(quit)
+			<-done
+			if s != nil {
+				s.Close()
+			}
+		})
+	}, nil
+}
+
+// RequestAttach asks the process with the given pid, which must have
+// called AttachOnSignal, to become attachable, and waits up to timeout
+// for it to write its discovery file. It reports an error, without
+// signalling the process, if the process has not called
+// AttachOnSignal.
+func RequestAttach(pid int, timeout time.Duration) error {
+	if attachSignal == nil {
+		return fmt.Errorf("profile: RequestAttach is not supported on %s", runtime.GOOS)
+	}
+	dir, err := openAttachDir(true)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Lstat(filepath.Join(dir, strconv.Itoa(pid)+".signal")); err != nil {
+		return fmt.Errorf("profile: process %d is not attachable and did not call AttachOnSignal", pid)
+	}
+	request := filepath.Join(dir, strconv.Itoa(pid)+".attach")
+	if err := ioutil.WriteFile(request, nil, 0600); err != nil {
+		return fmt.Errorf("profile: could not write attach request: %v", err)
+	}
+	defer os.Remove(request)
+	proc, err := os.FindProcess(pid)
+	if err == nil {
+		err = proc.Signal(attachSignal)
+	}
+	if err != nil {
+		return fmt.Errorf("profile: could not signal process %d: %v", pid, err)
+	}
+	for deadline := time.Now().Add(timeout); ; time.Sleep(10 * time.Millisecond) {
+		if _, err := LookupAttach(pid); err == nil {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("profile: process %d did not become attachable within %v", pid, timeout)
+		}
+	}
+}
@@ -0,0 +1,15 @@
+//go:build windows || plan9 || js || wasip1
+// +build windows plan9 js wasip1
+
+package profile
+
+import "os"
+
+// attachSignal is the signal sent by RequestAttach, which is not
+// supported on these platforms.
+var attachSignal os.Signal
+
+// privateDir reports whether the directory described by fi is private
+// to the current user. Ownership is not reported on these platforms,
+// where the temporary directory is private to the user.
+func privateDir(fi os.FileInfo) bool { return true }
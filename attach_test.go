@@ -0,0 +1,47 @@
+package profile
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAttachable(t *testing.T) {
+	t.Setenv("XDG_RUNTIME_DIR", t.TempDir())
+	dir := t.TempDir()
+	s, err := Attachable(ProfilePath(dir), Quiet, NoShutdownHook)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	info, err := LookupAttach(os.Getpid())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.PID != os.Getpid() || filepath.Dir(info.Socket) != attachDir() {
+		t.Fatalf("got discovery file %+v", info)
+	}
+	if _, err := Attach(os.Getpid(), "start goroutine"); err != nil {
+		t.Fatal(err)
+	}
+	resp, err := Attach(os.Getpid(), "stop")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var st sessionStatus
+	if err := json.Unmarshal([]byte(resp), &st); err != nil {
+		t.Fatal(err)
+	}
+	if len(st.Files) != 1 || st.Files[0] != filepath.Join(dir, "goroutine.pprof") {
+		t.Fatalf("got status %+v after stop", st)
+	}
+
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LookupAttach(os.Getpid()); err == nil {
+		t.Fatal("discovery file remains after Close")
+	}
+}
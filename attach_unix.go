@@ -0,0 +1,19 @@
+//go:build !windows && !plan9 && !js && !wasip1
+// +build !windows,!plan9,!js,!wasip1
+
+package profile
+
+import (
+	"os"
+	"syscall"
+)
+
+// attachSignal is the signal sent by RequestAttach.
+var attachSignal os.Signal = syscall.SIGUSR1
+
+// privateDir reports whether the directory described by fi has mode
+// 0700 and is owned by the current user.
+func privateDir(fi os.FileInfo) bool {
+	st, ok := fi.Sys().(*syscall.Stat_t)
+	return ok && int(st.Uid) == os.Getuid() && fi.Mode().Perm() == 0700
+}
@@ -0,0 +1,72 @@
+//go:build !windows && !plan9 && !js && !wasip1
+// +build !windows,!plan9,!js,!wasip1
+
+package profile
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestAttachDirNotPrivate(t *testing.T) {
+	t.Setenv("XDG_RUNTIME_DIR", t.TempDir())
+	if err := os.Mkdir(attachDir(), 0777); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chmod(attachDir(), 0777); err != nil {
+		t.Fatal(err)
+	}
+	if s, err := Attachable(Quiet, NoShutdownHook); err == nil {
+		s.Close()
+		t.Fatal("Attachable used a directory others can write")
+	}
+	if _, err := LookupAttach(os.Getpid()); err == nil {
+		t.Fatal("LookupAttach used a directory others can write")
+	}
+
+	// nor may the directory be a symlink to a private directory.
+	t.Setenv("XDG_RUNTIME_DIR", t.TempDir())
+	private := filepath.Join(t.TempDir(), "private")
+	if err := os.Mkdir(private, 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(private, attachDir()); err != nil {
+		t.Fatal(err)
+	}
+	if s, err := Attachable(Quiet, NoShutdownHook); err == nil {
+		s.Close()
+		t.Fatal("Attachable used a symlink")
+	}
+}
+
+func TestAttachOnSignal(t *testing.T) {
+	t.Setenv("XDG_RUNTIME_DIR", t.TempDir())
+	stop, err := AttachOnSignal(ProfilePath(t.TempDir()), Quiet, NoShutdownHook)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stop()
+	if _, err := LookupAttach(os.Getpid()); err == nil {
+		t.Fatal("process is attachable before it was asked")
+	}
+	if err := RequestAttach(os.Getpid(), 5*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Attach(os.Getpid(), "status"); err != nil {
+		t.Fatal(err)
+	}
+	stop()
+	if _, err := LookupAttach(os.Getpid()); err == nil {
+		t.Fatal("discovery file remains after stop")
+	}
+}
+
+func TestRequestAttachWithoutSignal(t *testing.T) {
+	t.Setenv("XDG_RUNTIME_DIR", t.TempDir())
+	// were the process signalled, SIGUSR1 would terminate it.
+	if err := RequestAttach(os.Getpid(), time.Second); err == nil {
+		t.Fatal("RequestAttach succeeded for a process which did not call AttachOnSignal")
+	}
+}
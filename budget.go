@@ -0,0 +1,79 @@
+package profile
+
+import (
+	"fmt"
+	"time"
+)
+
+// budgetWindow is the period over which a Budget is measured.
+const budgetWindow = time.Hour
+
+// Budget limits the profiling performed by a Watcher, so that a
+// trigger whose condition persists, or a schedule which is too
+// frequent, cannot profile the process continuously. Over any hour,
+// the sessions started by the Watcher may run for at most maxActive,
+// a fraction of the hour such as 0.02, and at most maxCaptures times.
+// A zero limit is not enforced. Captures which would exceed the budget
+// are skipped. Budget only affects Watch.
+func Budget(maxActive float64, maxCaptures int) Option {
+	return func(p *Profile) error {
+		if maxActive < 0 || maxActive > 1 || maxCaptures < 0 {
+			return fmt.Errorf("profile: budget must be a fraction between 0 and 1 and a number of captures that is not negative")
+		}
+		p.budgetActive, p.budgetCaptures = maxActive, maxCaptures
+		return nil
+	}
+}
+
+// budget records the captures made by a Watcher to enforce Budget.
+type budget struct {
+	maxActive   time.Duration // within budgetWindow, or zero
+	maxCaptures int
+	captures    []capture
+}
+
+// capture records when a capture started and how long it ran for.
+type capture struct {
+	start time.Time
+	d     time.Duration
+}
+
+// allow reports whether a capture lasting d may start at now, and if
+// not, why not.
+func (b *budget) allow(now time.Time, d time.Duration) (bool, string) {
+	// forget captures which ended before the window
+	since := now.Add(-budgetWindow)
+	for len(b.captures) > 0 && b.captures[0].start.Add(b.captures[0].d).Before(since) {
+		b.captures = b.captures[1:]
+	}
+	if b.maxCaptures > 0 {
+		n := 0
+		for _, c := range b.captures {
+			if !c.start.Before(since) {
+				n++
+			}
+		}
+		if n >= b.maxCaptures {
+			return false, fmt.Sprintf("%d captures in the last %v", n, budgetWindow)
+		}
+	}
+	if b.maxActive > 0 {
+		var active time.Duration
+		for _, c := range b.captures {
+			start := c.start
+			if start.Before(since) {
+				start = since
+			}
+			active += c.start.Add(c.d).Sub(start)
+		}
+		if active+d > b.maxActive {
+			return false, fmt.Sprintf("profiling active for %v of the last %v", active.Round(time.Second), budgetWindow)
+		}
+	}
+	return true, ""
+}
+
+// record records a capture which started at start and lasted d.
+func (b *budget) record(start time.Time, d time.Duration) {
+	b.captures = append(b.captures, capture{start: start, d: d})
+}
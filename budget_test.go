@@ -0,0 +1,58 @@
+package profile
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBudget(t *testing.T) {
+	start := time.Date(2024, 3, 5, 12, 0, 0, 0, time.UTC)
+	b := budget{maxActive: time.Minute, maxCaptures: 3}
+
+	if ok, _ := b.allow(start, 2*time.Minute); ok {
+		t.Fatal("allowed a capture longer than the budget")
+	}
+	for i := 0; i < 2; i++ {
+		now := start.Add(time.Duration(i) * 10 * time.Minute)
+		if ok, why := b.allow(now, 30*time.Second); !ok {
+			t.Fatalf("capture %d: not allowed: %s", i, why)
+		}
+		b.record(now, 30*time.Second)
+	}
+	if ok, _ := b.allow(start.Add(20*time.Minute), time.Second); ok {
+		t.Fatal("allowed a capture exceeding the active time")
+	}
+	if ok, why := b.allow(start.Add(20*time.Minute), 0); !ok {
+		t.Fatalf("snapshot not allowed: %s", why)
+	}
+	b.record(start.Add(20*time.Minute), 0)
+	if ok, _ := b.allow(start.Add(30*time.Minute), 0); ok {
+		t.Fatal("allowed a capture exceeding the number of captures")
+	}
+
+	// the first capture is partly outside the window
+	if ok, why := b.allow(start.Add(time.Hour+15*time.Second), 15*time.Second); !ok {
+		t.Fatalf("capture not allowed after an hour: %s", why)
+	}
+	// all captures have left the window
+	if ok, why := b.allow(start.Add(2*time.Hour), time.Minute); !ok {
+		t.Fatalf("capture not allowed after two hours: %s", why)
+	}
+}
+
+func TestWatchBudget(t *testing.T) {
+	dir := t.TempDir()
+	trigger := WhenGoroutinesAbove(1)
+	trigger.Interval = 10 * time.Millisecond
+	trigger.Cooldown = 0
+	w, err := Watch(trigger, Budget(0, 2), ProfilePath(dir), Quiet, NoShutdownHook)
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitForFiles(t, w, 2)
+	time.Sleep(100 * time.Millisecond)
+	w.Stop()
+	if files := w.Files(); len(files) != 2 {
+		t.Fatalf("got files %q, want two captures within the budget", files)
+	}
+}
@@ -0,0 +1,58 @@
+package profile
+
+import (
+	"bytes"
+	"io"
+	"strings"
+)
+
+// BuildInfoComments adds the build information of the program, as
+// reported by debug.ReadBuildInfo, to the comments of each profile
+// written in the pprof format: the Go version, the path and version
+// of the main module, and build settings such as the VCS revision.
+// A profile copied from a server can then be matched to the binary
+// which wrote it; the comments are shown by go tool pprof -comments.
+func BuildInfoComments(p *Profile) error {
+	p.buildInfo = true
+	return nil
+}
+
+// commentWriter buffers a pprof profile, adding comments to it when
+// it is closed.
+type commentWriter struct {
+	w        io.WriteCloser
+	buf      bytes.Buffer
+	comments []string
+}
+
+func (c *commentWriter) Write(b []byte) (int, error) { return c.buf.Write(b) }
+
+// Close writes the profile, with its comments, and closes the
+// underlying writer. Data which is not a pprof profile is written
+// unchanged.
+func (c *commentWriter) Close() error {
+	data := c.buf.Bytes()
+	if prof, err := parseProto(data); err == nil && len(data) > 0 {
+		for _, s := range c.comments {
+			prof.comment = append(prof.comment, prof.addString(s))
+		}
+		if out, err := prof.encode(); err == nil {
+			data = out
+		}
+	}
+	_, err := c.w.Write(data)
+	if cerr := c.w.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// withBuildInfo wraps w, which receives the profile written to the
+// file name, to add build information comments if it is a pprof
+// profile and BuildInfoComments was given.
+func (p *Profile) withBuildInfo(w io.WriteCloser, name string) io.WriteCloser {
+	if !p.buildInfo || !strings.HasSuffix(name, ".pprof") {
+		return w
+	}
+	return &commentWriter{w: w, comments: buildComments()}
+}
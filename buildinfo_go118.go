@@ -0,0 +1,28 @@
+//go:build go1.18
+// +build go1.18
+
+package profile
+
+import "runtime/debug"
+
+// buildComments returns the program's build information as
+// key=value strings. The -ldflags setting is omitted as it may hold
+// values injected at build time which should not be disclosed.
+func buildComments() []string {
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		return nil
+	}
+	comments := []string{
+		"go.version=" + bi.GoVersion,
+		"main.path=" + bi.Main.Path,
+		"main.version=" + bi.Main.Version,
+	}
+	for _, s := range bi.Settings {
+		if s.Key == "-ldflags" {
+			continue
+		}
+		comments = append(comments, s.Key+"="+s.Value)
+	}
+	return comments
+}
@@ -0,0 +1,21 @@
+//go:build !go1.18
+// +build !go1.18
+
+package profile
+
+import (
+	"runtime"
+	"runtime/debug"
+)
+
+// buildComments returns the program's build information as
+// key=value strings.
+func buildComments() []string {
+	comments := []string{"go.version=" + runtime.Version()}
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		comments = append(comments,
+			"main.path="+bi.Main.Path,
+			"main.version="+bi.Main.Version)
+	}
+	return comments
+}
@@ -0,0 +1,31 @@
+package profile
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestBuildInfoComments(t *testing.T) {
+	for _, mode := range []Option{CPUProfile, GoroutineProfile} {
+		var buf bytes.Buffer
+		p, err := StartErr(mode, BuildInfoComments, WriteTo(&buf), Quiet, NoShutdownHook)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := p.Close(); err != nil {
+			t.Fatal(err)
+		}
+		prof, err := parseProto(buf.Bytes())
+		if err != nil {
+			t.Fatalf("%v: %v", p.Mode(), err)
+		}
+		var comments []string
+		for _, c := range prof.comment {
+			comments = append(comments, prof.stringTable[c])
+		}
+		if len(comments) == 0 || !strings.HasPrefix(comments[0], "go.version=go") {
+			t.Fatalf("%v: got comments %q, want build information", p.Mode(), comments)
+		}
+	}
+}
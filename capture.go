@@ -0,0 +1,47 @@
+package profile
+
+import "bytes"
+
+// CaptureInMemory collects profiles in memory rather than writing
+// them to files, for use in tests and by programs which forward
+// profiles themselves. No files or directories are created. Once
+// the session has stopped, the profile is returned by Bytes.
+// Unlike WriteTo, a session configured with CaptureInMemory may
+// use SwitchMode, in which case the profile of each mode is kept.
+// CaptureInMemory cannot be combined with WriteTo, ProfilePath or
+// ProfileFilename.
+func CaptureInMemory(p *Profile) error {
+	p.capture = true
+	return nil
+}
+
+// Bytes returns the profile of the given mode collected by a session
+// configured with CaptureInMemory, or nil if there is none. Bytes
+// should not be called until the session has stopped.
+func (p *Profile) Bytes(mode Mode) []byte {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if buf := p.captured[mode]; buf != nil {
+		return buf.Bytes()
+	}
+	return nil
+}
+
+// inMemory reports whether the session writes its profiles to
+// memory rather than to files.
+func (p *Profile) inMemory() bool {
+	return p.w != nil || p.capture
+}
+
+// captureBuffer returns a new buffer for the profile of the
+// session's current mode.
+func (p *Profile) captureBuffer() *bytes.Buffer {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.captured == nil {
+		p.captured = make(map[Mode]*bytes.Buffer)
+	}
+	buf := new(bytes.Buffer)
+	p.captured[p.mode] = buf
+	return buf
+}
@@ -0,0 +1,95 @@
+package profile
+
+import (
+	"fmt"
+	"io"
+	"runtime/pprof"
+	"time"
+)
+
+// CPUProfileChunks enables cpu profiling, restarting the profile
+// every interval so that it is written as a series of numbered files,
+// cpu-0001.pprof, cpu-0002.pprof and so on, rather than as one file
+// when the session stops. A crash during a long session then loses
+// at most one interval of samples. The chunks may be combined with
+// go tool pprof, which merges the profiles it is given. Sessions
+// using CPUProfileChunks cannot be paused.
+// It replaces any previously selected profiling mode.
+func CPUProfileChunks(interval time.Duration) Option {
+	return func(p *Profile) error {
+		if interval <= 0 {
+			return fmt.Errorf("profile: cpu profile chunk interval must be positive")
+		}
+		p.cpuChunkInterval = interval
+		return p.setMode(CPUMode)
+	}
+}
+
+func (prof *Profile) startCPUChunks() error {
+	n := 1
+	startChunk := func() (io.WriteCloser, string, error) {
+		w, fn, err := prof.create(fmt.Sprintf("cpu-%04d.pprof", n))
+		if err != nil {
+			return nil, fn, fmt.Errorf("profile: could not create cpu profile %q: %v", fn, err)
+		}
+		setCPUProfileRate(prof.cpuProfileRate)
+		if err := pprof.StartCPUProfile(w); err != nil {
+			w.Close()
+			return nil, fn, fmt.Errorf("profile: could not start cpu profile: %v", err)
+		}
+		n++
+		return w, fn, nil
+	}
+	stopChunk := func(w io.WriteCloser, fn string) error {
+		pprof.StopCPUProfile()
+		err := w.Close()
+		if err == nil {
+			prof.logAttrs("profile: cpu profile chunk written", "path", fn)
+		}
+		return err
+	}
+
+	w, fn, err := startChunk()
+	if err != nil {
+		return err
+	}
+	prof.logAttrs("profile: cpu profiling enabled", "path", fn)
+
+	quit := make(chan struct{})
+	done := make(chan error, 1)
+	go func() {
+		t := time.NewTicker(prof.cpuChunkInterval)
+		defer t.Stop()
+		var err error
+		for {
+			select {
+			case <-t.C:
+				if cerr := stopChunk(w, fn); err == nil {
+					err = cerr
+				}
+				var serr error
+				if w, fn, serr = startChunk(); serr != nil {
+					if err == nil {
+						err = serr
+					}
+					done <- err
+					return
+				}
+			case <-quit:
+				if cerr := stopChunk(w, fn); err == nil {
+					err = cerr
+				}
+				done <- err
+				return
+			}
+		}
+	}()
+
+	prof.closer = func() error {
+		close(quit)
+		err := <-done
+		prof.logf("profile: cpu profiling disabled")
+		return err
+	}
+	return nil
+}
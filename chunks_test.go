@@ -0,0 +1,37 @@
+package profile
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCPUProfileChunks(t *testing.T) {
+	dir := t.TempDir()
+	p, err := StartErr(CPUProfileChunks(20*time.Millisecond), ProfilePath(dir), Quiet, NoShutdownHook)
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(70 * time.Millisecond)
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+	files := p.Result().Files
+	if len(files) < 3 {
+		t.Fatalf("got %d chunks, want at least 3: %q", len(files), files)
+	}
+	for i, fn := range files {
+		if want := filepath.Join(dir, fmt.Sprintf("cpu-%04d.pprof", i+1)); fn != want {
+			t.Fatalf("got chunk %q, want %q", fn, want)
+		}
+		buf, err := ioutil.ReadFile(fn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := parseProto(buf); err != nil {
+			t.Fatalf("%s: %v", fn, err)
+		}
+	}
+}
@@ -0,0 +1,221 @@
+package profile
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// UploadCloudProfiler requests that the cpu, heap, goroutine, mutex
+// and block profiles written by the session are submitted to Google
+// Cloud Profiler when the session stops, as profiles of the named
+// service and version. See CloudProfilerUploader.
+func UploadCloudProfiler(service, version string) Option {
+	return Upload(&CloudProfilerUploader{Service: service, Version: version})
+}
+
+// CloudProfilerUploader is an Uploader which submits profiles to
+// Google Cloud Profiler using the createOffline method of its API,
+// so that they appear in the Cloud Console alongside those collected
+// by its agent. Files which are not profiles that Cloud Profiler
+// accepts, such as execution traces, are skipped. By default the
+// project and the access token of the instance's service account are
+// obtained from the metadata server, as is available on GCE, GKE and
+// Cloud Run; the service account requires the Cloud Profiler Agent
+// role.
+type CloudProfilerUploader struct {
+	// Service holds the name of the service, which must start with
+	// a lowercase letter and contain only lowercase letters,
+	// digits and hyphens.
+	Service string
+
+	// Version holds the version of the service. It may be blank.
+	Version string
+
+	// ProjectID holds the Google Cloud project to which profiles
+	// are submitted. If blank, the project is requested from the
+	// metadata server.
+	ProjectID string
+
+	// Labels hold additional labels of the profiles, for example
+	// {"zone": "us-east1-b"}.
+	Labels map[string]string
+
+	// Token returns the OAuth2 access token used to authorize
+	// requests. If nil, the token of the default service account
+	// is requested from the metadata server.
+	Token func(ctx context.Context) (string, error)
+
+	// Endpoint holds the base URL of the Cloud Profiler API. If
+	// blank, https://cloudprofiler.googleapis.com is used.
+	Endpoint string
+
+	// Client holds the HTTP client used to make requests. If
+	// nil, http.DefaultClient is used.
+	Client *http.Client
+}
+
+// cloudProfileTypes maps the names of the files written by sessions
+// to the Cloud Profiler profile types they hold.
+var cloudProfileTypes = map[string]string{
+	"cpu":       "CPU",
+	"mem":       "HEAP",
+	"heap":      "HEAP",
+	"allocs":    "HEAP_ALLOC",
+	"goroutine": "THREADS",
+	"mutex":     "CONTENTION",
+	"block":     "CONTENTION",
+}
+
+// cloudProfileType returns the Cloud Profiler profile type of the file
+// called name, for example cpu-20060102T150405Z.pprof, or blank if it
+// is not one which Cloud Profiler accepts.
+func cloudProfileType(name string) string {
+	if filepath.Ext(name) != ".pprof" {
+		return ""
+	}
+	name = strings.TrimSuffix(name, ".pprof")
+	if i := strings.IndexAny(name, "-_."); i >= 0 {
+		name = name[:i]
+	}
+	return cloudProfileTypes[name]
+}
+
+// isAllocsProfile reports whether p is an allocs profile, whose default
+// sample type is one of the allocation counts.
+func isAllocsProfile(p *protoProfile) bool {
+	i := p.defaultSampleType
+	if i <= 0 || i >= int64(len(p.stringTable)) {
+		return false
+	}
+	return strings.HasPrefix(p.stringTable[i], "alloc_")
+}
+
+// cloudProfile is the Profile resource of the Cloud Profiler API.
+type cloudProfile struct {
+	ProfileType  string            `json:"profileType"`
+	Deployment   cloudDeployment   `json:"deployment"`
+	Duration     string            `json:"duration,omitempty"`
+	ProfileBytes []byte            `json:"profileBytes"`
+	Labels       map[string]string `json:"labels,omitempty"`
+}
+
+type cloudDeployment struct {
+	ProjectID string            `json:"projectId"`
+	Target    string            `json:"target"`
+	Labels    map[string]string `json:"labels,omitempty"`
+}
+
+// Upload implements Uploader.
+func (c *CloudProfilerUploader) Upload(ctx context.Context, name string, r io.Reader, size int64) error {
+	typ := cloudProfileType(name)
+	if typ == "" {
+		return nil
+	}
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	prof := cloudProfile{
+		ProfileType:  typ,
+		Deployment:   cloudDeployment{ProjectID: c.ProjectID, Target: c.Service},
+		ProfileBytes: data,
+		Labels:       c.Labels,
+	}
+	if c.Version != "" {
+		prof.Deployment.Labels = map[string]string{"version": c.Version}
+	}
+	if p, err := parseProto(data); err == nil {
+		if p.durationNanos > 0 {
+			d := time.Duration(p.durationNanos)
+			prof.Duration = strconv.FormatFloat(d.Seconds(), 'f', -1, 64) + "s"
+		}
+		// a memory profile written by a session configured with
+		// MemProfileAllocs is named mem.pprof, like a heap profile,
+		// but defaults to showing allocations.
+		if typ == "HEAP" && isAllocsProfile(p) {
+			prof.ProfileType = "HEAP_ALLOC"
+		}
+	}
+
+	client := c.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	if prof.Deployment.ProjectID == "" {
+		if prof.Deployment.ProjectID, err = metadataProjectID(ctx, client); err != nil {
+			return fmt.Errorf("cloudprofiler: could not obtain project: %v", err)
+		}
+	}
+	token := c.Token
+	if token == nil {
+		token = func(ctx context.Context) (string, error) { return metadataToken(ctx, client) }
+	}
+	tok, err := token(ctx)
+	if err != nil {
+		return fmt.Errorf("cloudprofiler: could not obtain access token: %v", err)
+	}
+
+	body, err := json.Marshal(prof)
+	if err != nil {
+		return err
+	}
+	endpoint := c.Endpoint
+	if endpoint == "" {
+		endpoint = "https://cloudprofiler.googleapis.com"
+	}
+	u := strings.TrimRight(endpoint, "/") + "/v2/projects/" + url.PathEscape(prof.Deployment.ProjectID) + "/profiles:createOffline"
+	req, err := http.NewRequest("POST", u, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+tok)
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("cloudprofiler: submit %s profile %s: %s: %s", prof.ProfileType, name, resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+// metadataProjectID requests the id of the instance's project from the
+// GCE metadata server, see metadataToken.
+func metadataProjectID(ctx context.Context, client *http.Client) (string, error) {
+	req, err := http.NewRequest("GET", "http://"+metadataHost()+"/computeMetadata/v1/project/project-id", nil)
+	if err != nil {
+		return "", err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Metadata-Flavor", "Google")
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("metadata server: %s", resp.Status)
+	}
+	id, err := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+	if err != nil {
+		return "", err
+	}
+	if len(id) == 0 {
+		return "", fmt.Errorf("metadata server: no project id")
+	}
+	return strings.TrimSpace(string(id)), nil
+}
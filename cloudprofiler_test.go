@@ -0,0 +1,113 @@
+package profile
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"runtime/pprof"
+	"strings"
+	"testing"
+)
+
+func TestUploadCloudProfiler(t *testing.T) {
+	var submitted []cloudProfile
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/computeMetadata/v1/instance/service-accounts/default/token":
+			w.Write([]byte(`{"access_token":"secret","expires_in":3599,"token_type":"Bearer"}`))
+		case r.URL.Path == "/computeMetadata/v1/project/project-id":
+			w.Write([]byte("my-project"))
+		case r.Method == "POST" && r.URL.Path == "/v2/projects/my-project/profiles:createOffline":
+			if r.Header.Get("Authorization") != "Bearer secret" {
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+			var prof cloudProfile
+			if err := json.NewDecoder(r.Body).Decode(&prof); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			submitted = append(submitted, prof)
+			json.NewEncoder(w).Encode(prof)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	t.Setenv("GCE_METADATA_HOST", strings.TrimPrefix(srv.URL, "http://"))
+
+	cp := &CloudProfilerUploader{Service: "myservice", Version: "1.2.3", Endpoint: srv.URL}
+	p, err := StartErr(CPUProfile, Manifest, Upload(cp), ProfilePath(t.TempDir()), Quiet, NoShutdownHook)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if len(submitted) != 1 {
+		t.Fatalf("got %d profiles submitted, want 1", len(submitted))
+	}
+	prof := submitted[0]
+	if prof.ProfileType != "CPU" || prof.Deployment.ProjectID != "my-project" || prof.Deployment.Target != "myservice" || prof.Deployment.Labels["version"] != "1.2.3" {
+		t.Errorf("got profile %+v", prof)
+	}
+	if !strings.HasSuffix(prof.Duration, "s") {
+		t.Errorf("got duration %q", prof.Duration)
+	}
+	if _, err := parseProto(prof.ProfileBytes); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestCloudProfileType(t *testing.T) {
+	tests := map[string]string{
+		"cpu.pprof":                        "CPU",
+		"cpu-http-20060102T150405Z.pprof":  "CPU",
+		"mem.pprof":                        "HEAP",
+		"goroutine-20060102T150405Z.pprof": "THREADS",
+		"mutex.pprof":                      "CONTENTION",
+		"trace.out":                        "",
+		"leveldb.openIters.pprof":          "",
+		"manifest.json":                    "",
+	}
+	for name, want := range tests {
+		if got := cloudProfileType(name); got != want {
+			t.Errorf("%s: got %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestCloudProfilerAllocs(t *testing.T) {
+	var got string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var prof cloudProfile
+		if err := json.NewDecoder(r.Body).Decode(&prof); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		got = prof.ProfileType
+	}))
+	defer srv.Close()
+
+	cp := &CloudProfilerUploader{
+		Service:   "myservice",
+		ProjectID: "my-project",
+		Token:     func(context.Context) (string, error) { return "secret", nil },
+		Endpoint:  srv.URL,
+	}
+	for name, want := range map[string]string{"heap": "HEAP", "allocs": "HEAP_ALLOC"} {
+		var buf bytes.Buffer
+		if err := pprof.Lookup(name).WriteTo(&buf, 0); err != nil {
+			t.Fatal(err)
+		}
+		// both are written to mem.pprof by a memory profiling session.
+		if err := cp.Upload(context.Background(), "mem.pprof", &buf, int64(buf.Len())); err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("%s: got profile type %q, want %q", name, got, want)
+		}
+	}
+}
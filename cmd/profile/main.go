@@ -0,0 +1,57 @@
+// Command profile controls profiling in processes which called
+// profile.Attachable, or profile.AttachOnSignal, in which case the
+// process is first asked, with SIGUSR1, to become attachable. Other
+// processes are never signalled.
+//
+// Usage:
+//
+//	profile attach pid [command [args...]]
+//
+// For example
+//
+//	profile attach 1234 start cpu 30s
+//	profile attach 1234 snapshot heap
+//	profile attach 1234 stop
+//
+// The commands are those accepted by profile.ListenControl; the
+// default is status. The response of the process is printed to
+// standard output.
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/profile"
+)
+
+func main() {
+	if len(os.Args) < 3 || os.Args[1] != "attach" {
+		fmt.Fprintf(os.Stderr, "usage: profile attach pid [start [mode] [duration] | stop | status | snapshot [name...]]\n")
+		os.Exit(2)
+	}
+	pid, err := strconv.Atoi(os.Args[2])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "profile: invalid pid %q\n", os.Args[2])
+		os.Exit(2)
+	}
+	command := "status"
+	if len(os.Args) > 3 {
+		command = strings.Join(os.Args[3:], " ")
+	}
+	if _, err := profile.LookupAttach(pid); err != nil {
+		if rerr := profile.RequestAttach(pid, 5*time.Second); rerr != nil {
+			fmt.Fprintf(os.Stderr, "profile: %v\n", rerr)
+			os.Exit(1)
+		}
+	}
+	resp, err := profile.Attach(pid, command)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "profile: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Println(resp)
+}
@@ -0,0 +1,44 @@
+// Command profilectl controls profiling in a process which called
+// profile.ListenControl.
+//
+// Usage:
+//
+//	profilectl -socket path command [args...]
+//
+// For example
+//
+//	profilectl -socket /var/run/myapp/profile.sock start cpu 30s
+//	profilectl -socket /var/run/myapp/profile.sock snapshot heap goroutine
+//	profilectl -socket /var/run/myapp/profile.sock status
+//
+// The socket may also be given by the PROFILECTL_SOCKET environment
+// variable. The response of the process is printed to standard output.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/pkg/profile"
+)
+
+func main() {
+	socket := flag.String("socket", os.Getenv("PROFILECTL_SOCKET"), "path of the control socket")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: profilectl -socket path start [mode] [duration] | stop | status | snapshot [name...]\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if *socket == "" || flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	resp, err := profile.Control(*socket, strings.Join(flag.Args(), " "))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "profilectl: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Println(resp)
+}
@@ -0,0 +1,171 @@
+package profile
+
+import (
+	"fmt"
+)
+
+// Config describes a profiling session. It is an alternative to the
+// functional options accepted by Start, suited to settings loaded
+// from configuration files or command line flags.
+type Config struct {
+	// Mode selects the kind of profiling. The default is CPUMode.
+	Mode Mode
+
+	// Path holds the base path where profiling files are written.
+	// If blank, the base path will be generated by ioutil.TempDir.
+	Path string
+
+	// Filename overrides the default name of the profile file.
+	// It must not contain any path elements.
+	Filename string
+
+	// CPUProfileRate holds the sampling rate of cpu profiling in
+	// hertz. If zero, the runtime default is used. It is only valid
+	// with CPUMode.
+	CPUProfileRate int
+
+	// MemProfileRate holds the rate for memory profiling. If zero,
+	// DefaultMemProfileRate is used. It is only valid with MemMode.
+	MemProfileRate int
+
+	// MemProfileType selects the type of memory profile, either
+	// "heap" or "allocs". If blank, "heap" is used. It is only
+	// valid with MemMode.
+	MemProfileType string
+
+	// MutexProfileFraction holds the fraction of mutex contention
+	// events reported. If zero, every event is reported. It is
+	// only valid with MutexMode.
+	MutexProfileFraction int
+
+	// BlockProfileRate holds the rate for block profiling. If zero,
+	// every blocking event is sampled. It is only valid with
+	// BlockMode.
+	BlockProfileRate int
+
+	// CustomProfile holds the name of the profile written in
+	// CustomMode. It is only valid with CustomMode.
+	CustomProfile string
+
+	// Quiet suppresses informational messages during profiling.
+	Quiet bool
+
+	// NoShutdownHook disables the hook which stops profiling
+	// cleanly when the program receives SIGINT or SIGTERM.
+	NoShutdownHook bool
+}
+
+// Validate reports whether the configuration is valid.
+func (c *Config) Validate() error {
+	if !c.Mode.valid() {
+		return fmt.Errorf("profile: unknown mode %v", c.Mode)
+	}
+	if c.CPUProfileRate != 0 && c.Mode != CPUMode {
+		return fmt.Errorf("profile: cpu profile rate is not valid with %v profiling", c.Mode)
+	}
+	if c.CPUProfileRate < 0 {
+		return fmt.Errorf("profile: cpu profile rate must not be negative")
+	}
+	if c.Mode != MemMode {
+		if c.MemProfileRate != 0 {
+			return fmt.Errorf("profile: memory profile rate is not valid with %v profiling", c.Mode)
+		}
+		if c.MemProfileType != "" {
+			return fmt.Errorf("profile: memory profile type is not valid with %v profiling", c.Mode)
+		}
+	}
+	switch c.MemProfileType {
+	case "", "heap", "allocs":
+	default:
+		return fmt.Errorf("profile: unknown memory profile type %q", c.MemProfileType)
+	}
+	if c.MemProfileRate < 0 {
+		return fmt.Errorf("profile: memory profile rate must not be negative")
+	}
+	if c.MutexProfileFraction != 0 && c.Mode != MutexMode {
+		return fmt.Errorf("profile: mutex profile fraction is not valid with %v profiling", c.Mode)
+	}
+	if c.BlockProfileRate != 0 && c.Mode != BlockMode {
+		return fmt.Errorf("profile: block profile rate is not valid with %v profiling", c.Mode)
+	}
+	if (c.CustomProfile != "") != (c.Mode == CustomMode) {
+		return fmt.Errorf("profile: custom profiling requires CustomMode and a profile name")
+	}
+	return nil
+}
+
+// options returns the functional options equivalent to c.
+func (c *Config) options() []Option {
+	var mode Option
+	switch c.Mode {
+	case CPUMode:
+		mode = CPU()
+	case MemMode:
+		mode = Mem(c.MemProfileRate, c.MemProfileType)
+	case MutexMode:
+		mode = Mutex(c.MutexProfileFraction)
+	case BlockMode:
+		mode = Block(c.BlockProfileRate)
+	case TraceMode:
+		mode = Trace()
+	case ThreadCreateMode:
+		mode = ThreadCreate()
+	case GoroutineMode:
+		mode = Goroutine()
+	case CustomMode:
+		mode = CustomProfile(c.CustomProfile)
+	default:
+		mode = func(p *Profile) error { return p.selectMode(c.Mode) }
+	}
+	options := []Option{
+		mode,
+		ProfilePath(c.Path),
+		ProfileFilename(c.Filename),
+	}
+	if c.CPUProfileRate != 0 {
+		options = append(options, CPUProfileRate(c.CPUProfileRate))
+	}
+	if c.Quiet {
+		options = append(options, Quiet)
+	}
+	if c.NoShutdownHook {
+		options = append(options, NoShutdownHook)
+	}
+	return options
+}
+
+// StartConfig validates cfg and starts a new profiling session.
+// The caller should call the Stop method on the value returned
+// to cleanly stop profiling.
+func StartConfig(cfg Config) (*Profile, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return StartErr(cfg.options()...)
+}
+
+// ParseMode returns the Mode named by s, which must be one of
+// the values returned by Mode.String.
+func ParseMode(s string) (Mode, error) {
+	for m := CPUMode; m < numModes; m++ {
+		if m.String() == s {
+			return m, nil
+		}
+	}
+	return 0, fmt.Errorf("profile: unknown mode %q", s)
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (m Mode) MarshalText() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (m *Mode) UnmarshalText(text []byte) error {
+	mode, err := ParseMode(string(text))
+	if err != nil {
+		return err
+	}
+	*m = mode
+	return nil
+}
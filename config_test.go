@@ -0,0 +1,64 @@
+package profile
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+var validateConfigTests = []struct {
+	cfg   Config
+	valid bool
+}{{
+	cfg:   Config{},
+	valid: true,
+}, {
+	cfg:   Config{Mode: MemMode, MemProfileRate: 2048, MemProfileType: "allocs"},
+	valid: true,
+}, {
+	cfg:   Config{Mode: CPUMode, MemProfileRate: 2048},
+	valid: false,
+}, {
+	cfg:   Config{Mode: BlockMode, MemProfileType: "heap"},
+	valid: false,
+}, {
+	cfg:   Config{Mode: MemMode, MemProfileType: "stack"},
+	valid: false,
+}, {
+	cfg:   Config{Mode: CPUMode, CPUProfileRate: 500},
+	valid: true,
+}, {
+	cfg:   Config{Mode: MemMode, CPUProfileRate: 500},
+	valid: false,
+}, {
+	cfg:   Config{Mode: CustomMode, CustomProfile: "leveldb.openIters"},
+	valid: true,
+}, {
+	cfg:   Config{Mode: CustomMode},
+	valid: false,
+}, {
+	cfg:   Config{Mode: Mode(99)},
+	valid: false,
+}}
+
+func TestConfigValidate(t *testing.T) {
+	for _, tt := range validateConfigTests {
+		err := tt.cfg.Validate()
+		if got := err == nil; got != tt.valid {
+			t.Errorf("%+v.Validate(): got %v, want valid %v", tt.cfg, err, tt.valid)
+		}
+	}
+}
+
+func TestConfigUnmarshalJSON(t *testing.T) {
+	var cfg Config
+	if err := json.Unmarshal([]byte(`{"Mode": "mutex", "Path": "/tmp", "Quiet": true}`), &cfg); err != nil {
+		t.Fatal(err)
+	}
+	want := Config{Mode: MutexMode, Path: "/tmp", Quiet: true}
+	if cfg != want {
+		t.Fatalf("got %+v, want %+v", cfg, want)
+	}
+	if err := json.Unmarshal([]byte(`{"Mode": "bogus"}`), &cfg); err == nil {
+		t.Fatal("expected error")
+	}
+}
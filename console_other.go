@@ -0,0 +1,8 @@
+//go:build !windows
+// +build !windows
+
+package profile
+
+// installConsoleHandler does nothing; only Windows has console
+// control events.
+func installConsoleHandler() {}
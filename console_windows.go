@@ -0,0 +1,58 @@
+package profile
+
+import (
+	"os"
+	"syscall"
+)
+
+var procSetConsoleCtrlHandler = syscall.NewLazyDLL("kernel32.dll").NewProc("SetConsoleCtrlHandler")
+
+// Console control events, see the documentation of
+// SetConsoleCtrlHandler.
+const (
+	ctrlCEvent        = 0
+	ctrlBreakEvent    = 1
+	ctrlCloseEvent    = 2
+	ctrlLogoffEvent   = 5
+	ctrlShutdownEvent = 6
+)
+
+// installConsoleHandler registers a console control handler which
+// passes console events to the shutdown hook as signals: CTRL+C and
+// CTRL+BREAK as os.Interrupt, and closing the console, logging off
+// and shutting down as syscall.SIGTERM. Older versions of Go do not
+// deliver the latter at all, and Windows ends the process as soon as
+// the handler for them returns, so the handler waits for the hook to
+// write the profiles first.
+func installConsoleHandler() {
+	procSetConsoleCtrlHandler.Call(syscall.NewCallback(consoleCtrlHandler), 1)
+}
+
+func consoleCtrlHandler(event uintptr) uintptr {
+	var sig os.Signal
+	switch event {
+	case ctrlCEvent, ctrlBreakEvent:
+		sig = os.Interrupt
+	case ctrlCloseEvent, ctrlLogoffEvent, ctrlShutdownEvent:
+		sig = syscall.SIGTERM
+	default:
+		return 0
+	}
+	hook.mu.Lock()
+	hooked, c, flushed := hook.signals[sig], hook.c, hook.flushed
+	hook.mu.Unlock()
+	if !hooked {
+		// leave the event to the next handler, such as the
+		// Go runtime's.
+		return 0
+	}
+	select {
+	case c <- sig:
+	default:
+		// the hook is already handling a signal.
+	}
+	if sig == syscall.SIGTERM {
+		<-flushed
+	}
+	return 1
+}
@@ -0,0 +1,17 @@
+//go:build go1.20
+// +build go1.20
+
+package profile
+
+import (
+	"runtime/metrics"
+	"time"
+)
+
+// readMutexWait returns the total time goroutines have spent blocked
+// on sync.Mutex and sync.RWMutex.
+func readMutexWait() (time.Duration, error) {
+	samples := []metrics.Sample{{Name: "/sync/mutex/wait/total:seconds"}}
+	metrics.Read(samples)
+	return time.Duration(samples[0].Value.Float64() * float64(time.Second)), nil
+}
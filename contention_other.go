@@ -0,0 +1,13 @@
+//go:build !go1.20
+// +build !go1.20
+
+package profile
+
+import (
+	"errors"
+	"time"
+)
+
+func readMutexWait() (time.Duration, error) {
+	return 0, errors.New("profile: WhenContentionAbove requires Go 1.20 or later")
+}
@@ -0,0 +1,56 @@
+package profile
+
+import (
+	"fmt"
+	"time"
+)
+
+// WhenContentionAbove returns a Trigger which, when goroutines spend
+// more than wait per second blocked on sync.Mutex and sync.RWMutex,
+// writes mutex and block profiles recording every event for the
+// trigger's Duration. Contention is measured with the
+// /sync/mutex/wait/total:seconds metric of package runtime/metrics,
+// which costs nothing when there is no contention, so mutex and block
+// profiling are only enabled while the profiles are collected; their
+// previous rates are then restored. For example
+//
+//	WhenContentionAbove(500 * time.Millisecond)
+//
+// fires when, on average, goroutines wait for locks for half of every
+// second. WhenContentionAbove requires Go 1.20 or later; Watch
+// reports an error otherwise.
+func WhenContentionAbove(wait time.Duration) Trigger {
+	return Trigger{
+		Interval: DefaultTriggerInterval,
+		Cooldown: DefaultTriggerCooldown,
+		Duration: DefaultTriggerDuration,
+		name:     "contentionabove",
+		modes:    []Mode{MutexMode, BlockMode},
+		check: func() (func() (bool, string), error) {
+			if wait <= 0 {
+				return nil, fmt.Errorf("profile: WhenContentionAbove requires a positive wait")
+			}
+			last, err := readMutexWait()
+			if err != nil {
+				return nil, err
+			}
+			lastTime := time.Now()
+			return func() (bool, string) {
+				total, err := readMutexWait()
+				now := time.Now()
+				if err != nil {
+					return false, ""
+				}
+				perSecond := time.Duration(float64(total-last) / now.Sub(lastTime).Seconds())
+				last, lastTime = total, now
+				if perSecond <= wait {
+					return false, ""
+				}
+				return true, fmt.Sprintf("lock contention of %v per second above %v", perSecond.Round(time.Millisecond), wait)
+			}, nil
+		},
+		capture: func(w *Watcher) error {
+			return w.sessions([]Mode{MutexMode, BlockMode}, w.trigger.Duration)
+		},
+	}
+}
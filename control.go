@@ -0,0 +1,158 @@
+package profile
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// controlTimeout bounds how long a control connection may take to
+// send its command and read the response.
+const controlTimeout = 10 * time.Second
+
+// ControlServer accepts commands which control profiling sessions on
+// a unix domain socket. See ListenControl.
+type ControlServer struct {
+	l  net.Listener
+	c  controller
+	wg sync.WaitGroup
+
+	// discovery holds the path of the file written by Attachable,
+	// which is removed by Close.
+	discovery string
+}
+
+// ListenControl listens for commands on the unix domain socket at
+// path, which is replaced if it is a socket left by an earlier
+// process. Each connection sends one command, a line of words, and
+// receives one line in response, either a JSON description of the
+// session or a line beginning "error: ". The commands are
+//
+//	start [mode] [duration]  start a session, see ParseMode and Duration
+//	stop                     stop the running session
+//	status                   describe the current or last session
+//	snapshot [name...]       write the named pprof.Lookup profiles, heap and goroutine by default
+//
+// At most one session started by the server runs at a time. Sessions
+// are started with the given options, and snapshots are written to
+// the directory they select. Access to the server is controlled by
+// the permissions of the socket. See Control and the profilectl
+// command for a client.
+func ListenControl(path string, options ...Option) (*ControlServer, error) {
+	if fi, err := os.Lstat(path); err == nil && fi.Mode()&os.ModeSocket != 0 {
+		os.Remove(path)
+	}
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("profile: could not listen for control commands: %v", err)
+	}
+	s := &ControlServer{l: l, c: controller{options: options}}
+	s.wg.Add(1)
+	go s.serve()
+	return s, nil
+}
+
+// Close stops accepting commands and removes the socket, and the
+// discovery file written by Attachable. Any running session is not
+// stopped.
+func (s *ControlServer) Close() error {
+	if s.discovery != "" {
+		os.Remove(s.discovery)
+	}
+	err := s.l.Close()
+	s.wg.Wait()
+	return err
+}
+
+func (s *ControlServer) serve() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.l.Accept()
+		if err != nil {
+			return
+		}
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.handle(conn)
+		}()
+	}
+}
+
+func (s *ControlServer) handle(conn net.Conn) {
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(controlTimeout))
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil && line == "" {
+		return
+	}
+	v, err := s.exec(strings.Fields(line))
+	if err != nil {
+		fmt.Fprintf(conn, "error: %v\n", err)
+		return
+	}
+	json.NewEncoder(conn).Encode(v)
+}
+
+// exec executes a command.
+func (s *ControlServer) exec(args []string) (interface{}, error) {
+	if len(args) == 0 {
+		return nil, fmt.Errorf("profile: empty command")
+	}
+	cmd, args := args[0], args[1:]
+	switch cmd {
+	case "start":
+		if len(args) > 2 {
+			return nil, fmt.Errorf("profile: usage: start [mode] [duration]")
+		}
+		var mode *Mode
+		var d time.Duration
+		for _, arg := range args {
+			if m, err := ParseMode(arg); err == nil && mode == nil {
+				mode = &m
+				continue
+			}
+			var err error
+			if d, err = time.ParseDuration(arg); err != nil || d <= 0 {
+				return nil, fmt.Errorf("profile: invalid mode or duration %q", arg)
+			}
+		}
+		return s.c.start(mode, d)
+	case "stop":
+		return s.c.stop()
+	case "status":
+		return s.c.status(), nil
+	case "snapshot":
+		return s.c.snapshot(args)
+	default:
+		return nil, fmt.Errorf("profile: unknown command %q", cmd)
+	}
+}
+
+// Control sends command to the server listening on the unix domain
+// socket at path, see ListenControl, and returns its response.
+func Control(path, command string) (string, error) {
+	conn, err := net.DialTimeout("unix", path, controlTimeout)
+	if err != nil {
+		return "", err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(controlTimeout))
+	if _, err := fmt.Fprintf(conn, "%s\n", strings.TrimSpace(command)); err != nil {
+		return "", err
+	}
+	resp, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	resp = strings.TrimSuffix(resp, "\n")
+	if strings.HasPrefix(resp, "error: ") {
+		return "", fmt.Errorf("%s", strings.TrimPrefix(resp, "error: "))
+	}
+	return resp, nil
+}
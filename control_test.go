@@ -0,0 +1,80 @@
+package profile
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestControl(t *testing.T) {
+	dir := t.TempDir()
+	sock := filepath.Join(t.TempDir(), "profile.sock")
+	s, err := ListenControl(sock, ProfilePath(dir), Quiet, NoShutdownHook)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	do := func(command string) sessionStatus {
+		t.Helper()
+		resp, err := Control(sock, command)
+		if err != nil {
+			t.Fatalf("%s: %v", command, err)
+		}
+		var st sessionStatus
+		if err := json.Unmarshal([]byte(resp), &st); err != nil {
+			t.Fatalf("%s: %v", command, err)
+		}
+		return st
+	}
+	fail := func(command, want string) {
+		t.Helper()
+		if _, err := Control(sock, command); err == nil || !strings.Contains(err.Error(), want) {
+			t.Fatalf("%s: got error %v, want %q", command, err, want)
+		}
+	}
+
+	if st := do("status"); st.Running {
+		t.Fatalf("got initial status %+v", st)
+	}
+	fail("stop", "no session is running")
+	fail("start bogus", "invalid mode or duration")
+	fail("frobnicate", "unknown command")
+
+	if st := do("start goroutine 1h"); !st.Running || *st.Mode != GoroutineMode {
+		t.Fatalf("got status %+v after start", st)
+	}
+	fail("start", "already running")
+	if st := do("stop"); st.Running || len(st.Files) != 1 || st.Files[0] != filepath.Join(dir, "goroutine.pprof") {
+		t.Fatalf("got status %+v after stop", st)
+	}
+
+	do("start mem")
+	st := do("stop")
+	data, err := ioutil.ReadFile(filepath.Join(dir, "mem.pprof"))
+	if err != nil {
+		t.Fatalf("got status %+v after stop: %v", st, err)
+	}
+	if p, err := parseProto(data); err != nil || p.period == 0 {
+		t.Fatalf("got memory profile with period 0, or error %v", err)
+	}
+
+	st = do("snapshot heap")
+	if len(st.Files) != 1 {
+		t.Fatalf("got snapshot files %q", st.Files)
+	}
+	if matched, _ := filepath.Match(filepath.Join(dir, "heap-*.pprof"), st.Files[0]); !matched {
+		t.Fatalf("got snapshot file %q", st.Files[0])
+	}
+	fail("snapshot bogus", "unknown profile")
+	fail("snapshot ../heap", "invalid snapshot profile name")
+
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Control(sock, "status"); err == nil {
+		t.Fatal("expected error after Close")
+	}
+}
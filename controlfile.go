@@ -0,0 +1,97 @@
+package profile
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+)
+
+// ControlFile returns a Trigger which profiles the process each time
+// the file at path is created or modified, for example by touch, so
+// that profiling can be driven by shell scripts and configuration
+// management. The file may hold the name of a mode, as accepted by
+// ParseMode, optionally followed by a duration, as accepted by
+// time.ParseDuration, for example
+//
+//	echo "cpu 10s" > /var/run/myapp/profile-now
+//
+// If the file is empty, a cpu profile is taken. Profiles which show
+// the state of the process, such as memory and goroutine profiles,
+// are written immediately; others are collected for the duration from
+// the file or, if none is given, the trigger's Duration. Options given
+// to Watch are validated for cpu profiling.
+func ControlFile(path string) Trigger {
+	return Trigger{
+		Interval: DefaultTriggerInterval,
+		Duration: DefaultTriggerDuration,
+		name:     "control",
+		modes:    []Mode{CPUMode},
+		check: func() (func() (bool, string), error) {
+			if path == "" {
+				return nil, fmt.Errorf("profile: ControlFile requires a path")
+			}
+			var last time.Time
+			if fi, err := os.Stat(path); err == nil {
+				last = fi.ModTime()
+			}
+			return func() (bool, string) {
+				fi, err := os.Stat(path)
+				if err != nil || !fi.ModTime().After(last) {
+					return false, ""
+				}
+				last = fi.ModTime()
+				return true, fmt.Sprintf("%s modified", path)
+			}, nil
+		},
+		capture: func(w *Watcher) error {
+			buf, err := ioutil.ReadFile(path)
+			if err != nil {
+				return err
+			}
+			mode, d, err := parseControl(string(buf), w.trigger.Duration)
+			if err != nil {
+				return fmt.Errorf("%s: %v", path, err)
+			}
+			return w.session(mode, d)
+		},
+	}
+}
+
+// parseControl parses the contents of a control file, returning the
+// mode and how long to profile for.
+func parseControl(s string, d time.Duration) (Mode, time.Duration, error) {
+	fields := strings.Fields(s)
+	if len(fields) > 2 {
+		return 0, 0, fmt.Errorf("want a mode and an optional duration, got %q", s)
+	}
+	mode := CPUMode
+	if len(fields) > 0 {
+		var err error
+		if mode, err = ParseMode(fields[0]); err != nil {
+			return 0, 0, err
+		}
+	}
+	if len(fields) > 1 {
+		var err error
+		if d, err = time.ParseDuration(fields[1]); err != nil || d < 0 {
+			return 0, 0, fmt.Errorf("invalid duration %q", fields[1])
+		}
+	}
+	if mode.snapshot() {
+		d = 0
+	}
+	return mode, d, nil
+}
+
+// snapshot reports whether profiles of mode m show the state of the
+// process when they are written, rather than activity while the
+// session runs.
+func (m Mode) snapshot() bool {
+	switch m {
+	case MemMode, ThreadCreateMode, GoroutineMode, HeapDumpMode, DiagnosticMode:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,54 @@
+package profile
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParseControl(t *testing.T) {
+	tests := []struct {
+		s    string
+		mode Mode
+		d    time.Duration
+	}{
+		{"", CPUMode, time.Minute},
+		{"cpu\n", CPUMode, time.Minute},
+		{"cpu 10s", CPUMode, 10 * time.Second},
+		{"mutex 1m30s", MutexMode, 90 * time.Second},
+		{"goroutine", GoroutineMode, 0},
+		{"mem 10s", MemMode, 0},
+	}
+	for _, tt := range tests {
+		mode, d, err := parseControl(tt.s, time.Minute)
+		if err != nil || mode != tt.mode || d != tt.d {
+			t.Errorf("%q: got %v, %v, %v, want %v, %v", tt.s, mode, d, err, tt.mode, tt.d)
+		}
+	}
+	for _, s := range []string{"heap", "cpu soon", "cpu -1s", "cpu 1s 2s"} {
+		if _, _, err := parseControl(s, time.Minute); err == nil {
+			t.Errorf("%q: expected error", s)
+		}
+	}
+}
+
+func TestControlFile(t *testing.T) {
+	dir := t.TempDir()
+	control := filepath.Join(t.TempDir(), "profile-now")
+	trigger := ControlFile(control)
+	trigger.Interval = 10 * time.Millisecond
+	w, err := Watch(trigger, ProfilePath(dir), Quiet, NoShutdownHook)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Stop()
+	if err := ioutil.WriteFile(control, []byte("goroutine\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	files := waitForFiles(t, w, 1)
+	w.Stop()
+	if matched, _ := filepath.Match(filepath.Join(dir, "goroutine-control-*.pprof"), files[0]); !matched {
+		t.Fatalf("got file %q, want a goroutine-control profile", files[0])
+	}
+}
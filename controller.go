@@ -0,0 +1,140 @@
+package profile
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+var (
+	errRunning    = errors.New("profile: a session is already running")
+	errNotRunning = errors.New("profile: no session is running")
+)
+
+// controller manages the sessions started remotely by Handler and
+// ListenControl, at most one of which runs at a time.
+type controller struct {
+	options []Option
+
+	mu sync.Mutex
+	p  *Profile // the current or last session, or nil
+}
+
+// sessionStatus describes the current or last session of a controller.
+type sessionStatus struct {
+	Running bool       `json:"running"`
+	Mode    *Mode      `json:"mode,omitempty"`
+	Started *time.Time `json:"started,omitempty"`
+	Dir     string     `json:"dir,omitempty"`
+	Files   []string   `json:"files,omitempty"`
+	Err     string     `json:"error,omitempty"`
+}
+
+// start starts a session with the controller's options and the given
+// mode, unless mode is nil, which is stopped after d, unless d is zero.
+func (c *controller) start(mode *Mode, d time.Duration) (sessionStatus, error) {
+	options := append([]Option(nil), c.options...)
+	if mode != nil {
+		m := *mode
+		options = append(options, func(p *Profile) error { return p.useMode(m) })
+	}
+	if d > 0 {
+		options = append(options, Duration(d))
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.running() {
+		return sessionStatus{}, errRunning
+	}
+	p, err := StartErr(options...)
+	if err != nil {
+		return sessionStatus{}, err
+	}
+	c.p = p
+	return c.statusLocked(), nil
+}
+
+// stop stops the running session.
+func (c *controller) stop() (sessionStatus, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.running() {
+		return sessionStatus{}, errNotRunning
+	}
+	c.p.Stop()
+	return c.statusLocked(), nil
+}
+
+// status returns the status of the current or last session.
+func (c *controller) status() sessionStatus {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.statusLocked()
+}
+
+// running reports whether the controller's session is running.
+// c.mu must be held.
+func (c *controller) running() bool {
+	if c.p == nil {
+		return false
+	}
+	select {
+	case <-c.p.Done():
+		return false
+	default:
+		return true
+	}
+}
+
+// statusLocked returns the status of the controller's session.
+// c.mu must be held.
+func (c *controller) statusLocked() sessionStatus {
+	var st sessionStatus
+	if p := c.p; p != nil {
+		mode, started := p.mode, p.started
+		st.Mode, st.Started, st.Dir = &mode, &started, p.dir
+		if st.Running = c.running(); st.Running {
+			st.Files = p.Files()
+		} else {
+			res := p.Result()
+			st.Files = res.Files
+			if res.Err != nil {
+				st.Err = res.Err.Error()
+			}
+		}
+	}
+	return st
+}
+
+// snapshot writes the named profiles, or heap and goroutine profiles
+// if none are named, to the directory selected by the controller's
+// options, returning a status listing the files written.
+func (c *controller) snapshot(names []string) (sessionStatus, error) {
+	if len(names) == 0 {
+		names = []string{"heap", "goroutine"}
+	}
+	for _, name := range names {
+		if !validSnapshotName(name) {
+			return sessionStatus{}, fmt.Errorf("profile: invalid snapshot profile name %q", name)
+		}
+	}
+	p, err := configure(c.options...)
+	if err != nil {
+		return sessionStatus{}, err
+	}
+	if p.inMemory() {
+		return sessionStatus{}, errors.New("profile: snapshots cannot be written with WriteTo or CaptureInMemory")
+	}
+	if err := p.prepare(); err != nil {
+		return sessionStatus{}, err
+	}
+	ts := time.Now().UTC().Format(timestampLayout)
+	for _, name := range names {
+		if _, err := p.writeSnapshot(name, ts, 0); err != nil {
+			return sessionStatus{Dir: p.dir, Files: p.Files()}, fmt.Errorf("profile: could not write %s snapshot: %v", name, err)
+		}
+	}
+	return sessionStatus{Dir: p.dir, Files: p.Files()}, nil
+}
@@ -0,0 +1,206 @@
+package profile
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"runtime"
+	"runtime/pprof"
+	"sync"
+)
+
+// cpuProfile is a cpu profile which may be paused and resumed.
+type cpuProfile struct {
+	mu sync.Mutex
+
+	// hz holds the sampling rate, or zero for the runtime default.
+	hz int
+
+	// out holds the destination of the profile.
+	out io.Writer
+
+	// file is set if out is a file, in which case the samples
+	// collected before the profile is first paused are written
+	// directly to it.
+	file *outputFile
+
+	// segments holds the samples collected each time the profile
+	// is started or resumed that have not been written to file.
+	// They are merged and written to out when the profile stops.
+	segments []*bytes.Buffer
+
+	paused  bool
+	stopped bool
+}
+
+var errStopped = errors.New("profile: session has been stopped")
+
+func newCPUProfile(w io.Writer, hz int) *cpuProfile {
+	c := &cpuProfile{out: w, hz: hz}
+	if f, ok := w.(*outputFile); ok {
+		c.file = f
+	}
+	return c
+}
+
+func (c *cpuProfile) start() error {
+	if c.file != nil {
+		c.setRate()
+		return pprof.StartCPUProfile(c.file)
+	}
+	return c.startSegment()
+}
+
+// startSegment starts collecting samples into a new segment.
+func (c *cpuProfile) startSegment() error {
+	var buf bytes.Buffer
+	c.setRate()
+	if err := pprof.StartCPUProfile(&buf); err != nil {
+		return err
+	}
+	c.segments = append(c.segments, &buf)
+	return nil
+}
+
+func (c *cpuProfile) setRate() { setCPUProfileRate(c.hz) }
+
+// setCPUProfileRate sets the sampling rate ahead of
+// pprof.StartCPUProfile, which does not otherwise allow the rate to
+// be changed. If hz is zero the runtime default is used.
+func setCPUProfileRate(hz int) {
+	if hz > 0 {
+		runtime.SetCPUProfileRate(hz)
+	}
+}
+
+func (c *cpuProfile) pause() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.stopped {
+		return errStopped
+	}
+	if !c.paused {
+		pprof.StopCPUProfile()
+		c.paused = true
+	}
+	return nil
+}
+
+func (c *cpuProfile) resume() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.stopped {
+		return errStopped
+	}
+	if !c.paused {
+		return nil
+	}
+	if err := c.startSegment(); err != nil {
+		return fmt.Errorf("profile: could not resume cpu profile: %v", err)
+	}
+	c.paused = false
+	return nil
+}
+
+// stop stops the profile and writes any collected segments to the
+// destination, merging them with the samples already in the file.
+func (c *cpuProfile) stop() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.paused {
+		pprof.StopCPUProfile()
+	}
+	c.paused, c.stopped = true, true
+	return c.flush()
+}
+
+func (c *cpuProfile) flush() error {
+	var data [][]byte
+	if c.file != nil {
+		if len(c.segments) == 0 {
+			return nil
+		}
+		if _, err := c.file.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		buf, err := ioutil.ReadAll(c.file)
+		if err != nil {
+			return err
+		}
+		data = append(data, buf)
+	}
+	for _, seg := range c.segments {
+		data = append(data, seg.Bytes())
+	}
+	if len(data) == 1 {
+		_, err := c.out.Write(data[0])
+		return err
+	}
+
+	merged, err := parseProto(data[0])
+	if err != nil {
+		return err
+	}
+	for _, d := range data[1:] {
+		p, err := parseProto(d)
+		if err != nil {
+			return err
+		}
+		if err := merged.merge(p); err != nil {
+			return err
+		}
+	}
+	out, err := merged.encode()
+	if err != nil {
+		return err
+	}
+	if c.file != nil {
+		if err := c.file.Truncate(0); err != nil {
+			return err
+		}
+		_, err = c.file.WriteAt(out, 0)
+		return err
+	}
+	_, err = c.out.Write(out)
+	return err
+}
+
+// Pause temporarily stops the collection of cpu profiling samples,
+// for example to exclude a warm up phase from the profile. Pause
+// returns an error if the session is not a cpu profile.
+func (p *Profile) Pause() error {
+	if p.disabled {
+		return nil
+	}
+	p.runMu.Lock()
+	defer p.runMu.Unlock()
+	if p.cpu == nil {
+		return fmt.Errorf("profile: cannot pause %v profile", p.mode)
+	}
+	if err := p.cpu.pause(); err != nil {
+		return err
+	}
+	p.logf("profile: cpu profiling paused")
+	return nil
+}
+
+// Resume resumes the collection of cpu profiling samples after a
+// call to Pause. Samples collected after resuming are merged into
+// the same profile file when the session is stopped.
+func (p *Profile) Resume() error {
+	if p.disabled {
+		return nil
+	}
+	p.runMu.Lock()
+	defer p.runMu.Unlock()
+	if p.cpu == nil {
+		return fmt.Errorf("profile: cannot resume %v profile", p.mode)
+	}
+	if err := p.cpu.resume(); err != nil {
+		return err
+	}
+	p.logf("profile: cpu profiling resumed")
+	return nil
+}
@@ -0,0 +1,59 @@
+package profile
+
+import (
+	"fmt"
+	"runtime"
+	"time"
+)
+
+// WhenCPUAbove returns a Trigger which captures a cpu profile, lasting
+// the trigger's Duration, once the cpu used by the process has been
+// above percent of the capacity given by GOMAXPROCS for at least the
+// sustained period. Measuring the cpu used by the process is not
+// supported on all platforms; Watch reports an error if it is not.
+func WhenCPUAbove(percent float64, sustained time.Duration) Trigger {
+	return Trigger{
+		Interval: DefaultTriggerInterval,
+		Cooldown: DefaultTriggerCooldown,
+		Duration: DefaultTriggerDuration,
+		name:     "cpuabove",
+		modes:    []Mode{CPUMode},
+		check: func() (func() (bool, string), error) {
+			if percent <= 0 || percent > 100 || sustained < 0 {
+				return nil, fmt.Errorf("profile: WhenCPUAbove requires a percentage between 0 and 100 and a sustained period that is not negative")
+			}
+			last, err := processCPUTime()
+			if err != nil {
+				return nil, fmt.Errorf("profile: WhenCPUAbove: %v", err)
+			}
+			lastTime := time.Now()
+			var above time.Time // when usage rose above percent
+			return func() (bool, string) {
+				cpu, err := processCPUTime()
+				now := time.Now()
+				if err != nil {
+					return false, ""
+				}
+				usage := 100 * float64(cpu-last) / float64(now.Sub(lastTime)) / float64(runtime.GOMAXPROCS(0))
+				start := lastTime
+				last, lastTime = cpu, now
+				if usage <= percent {
+					above = time.Time{}
+					return false, ""
+				}
+				if above.IsZero() {
+					// usage was measured over the interval
+					// which has just ended.
+					above = start
+				}
+				if now.Sub(above) < sustained {
+					return false, ""
+				}
+				return true, fmt.Sprintf("cpu usage %.0f%% above %.0f%% for %v", usage, percent, now.Sub(above).Round(time.Second))
+			}, nil
+		},
+		capture: func(w *Watcher) error {
+			return w.session(CPUMode, w.trigger.Duration)
+		},
+	}
+}
@@ -0,0 +1,16 @@
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd
+
+package profile
+
+import (
+	"fmt"
+	"runtime"
+	"time"
+)
+
+// processCPUTime returns the user and system cpu time used by the
+// process.
+func processCPUTime() (time.Duration, error) {
+	return 0, fmt.Errorf("measuring process cpu time is not supported on %s", runtime.GOOS)
+}
@@ -0,0 +1,201 @@
+package profile
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// UploadDatadog requests that the cpu, heap, goroutine, mutex and
+// block profiles written by the session are submitted to Datadog's
+// profile intake, in the given site, for example datadoghq.com or
+// datadoghq.eu, when the session stops. Combine it with Snapshot and
+// UploadAsWritten to feed Datadog's continuous profiler while the
+// program runs. See DatadogUploader.
+func UploadDatadog(apiKey, site, service, env, version string) Option {
+	return Upload(&DatadogUploader{APIKey: apiKey, Site: site, Service: service, Env: env, Version: version})
+}
+
+// DatadogUploader is an Uploader which submits profiles to Datadog's
+// profile intake, as its agentless profiling clients do, so that they
+// appear in Datadog's profiling UI. Each file is submitted as a
+// separate profile, covering the period recorded in it. Files which
+// are not profiles that Datadog accepts, such as execution traces,
+// are skipped.
+type DatadogUploader struct {
+	// APIKey holds the Datadog API key.
+	APIKey string
+
+	// Site holds the Datadog site, for example datadoghq.com, the
+	// default, or datadoghq.eu.
+	Site string
+
+	// Service, Env and Version hold the unified service tags of
+	// the profiles. Service is required.
+	Service, Env, Version string
+
+	// Tags hold additional tags of the profiles, each in the form
+	// key:value.
+	Tags []string
+
+	// Endpoint holds the URL profiles are submitted to. If blank,
+	// https://intake.profile.<Site>/api/v2/profile is used, so
+	// that an Endpoint of a local Datadog agent, such as
+	// http://localhost:8126/profiling/v1/input, may be given
+	// instead of an APIKey.
+	Endpoint string
+
+	// Client holds the HTTP client used to make requests. If
+	// nil, http.DefaultClient is used.
+	Client *http.Client
+}
+
+// datadogAttachments maps the names of the files written by sessions
+// to the names of the attachments Datadog expects.
+var datadogAttachments = map[string]string{
+	"cpu":       "cpu.pprof",
+	"mem":       "heap.pprof",
+	"heap":      "heap.pprof",
+	"goroutine": "goroutines.pprof",
+	"mutex":     "mutex.pprof",
+	"block":     "block.pprof",
+}
+
+// datadogAttachment returns the name of the attachment holding the file
+// called name, for example cpu-20060102T150405Z.pprof, or blank if it
+// is not a profile which Datadog accepts.
+func datadogAttachment(name string) string {
+	if filepath.Ext(name) != ".pprof" {
+		return ""
+	}
+	name = strings.TrimSuffix(name, ".pprof")
+	if i := strings.IndexAny(name, "-_."); i >= 0 {
+		name = name[:i]
+	}
+	return datadogAttachments[name]
+}
+
+// datadogEvent describes the profile in a submission.
+type datadogEvent struct {
+	Attachments []string `json:"attachments"`
+	Tags        string   `json:"tags_profiler"`
+	Start       string   `json:"start"`
+	End         string   `json:"end"`
+	Family      string   `json:"family"`
+	Version     string   `json:"version"`
+}
+
+// Upload implements Uploader.
+func (d *DatadogUploader) Upload(ctx context.Context, name string, r io.Reader, size int64) error {
+	attachment := datadogAttachment(name)
+	if attachment == "" {
+		return nil
+	}
+	if d.Service == "" {
+		return fmt.Errorf("datadog: Service is required")
+	}
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	// the period covered by the profile, or its time if it is not
+	// collected over time.
+	end := time.Now()
+	start := end
+	if p, err := parseProto(data); err == nil && p.timeNanos > 0 {
+		start = time.Unix(0, p.timeNanos)
+		end = start.Add(time.Duration(p.durationNanos))
+	}
+	if !end.After(start) {
+		end = start.Add(time.Second)
+	}
+	tags := []string{"service:" + d.Service, "runtime:go", "language:go", "runtime_version:" + runtime.Version()}
+	if d.Env != "" {
+		tags = append(tags, "env:"+d.Env)
+	}
+	if d.Version != "" {
+		tags = append(tags, "version:"+d.Version)
+	}
+	tags = append(tags, d.Tags...)
+	event := datadogEvent{
+		Attachments: []string{attachment},
+		Tags:        strings.Join(tags, ","),
+		Start:       start.UTC().Format(time.RFC3339Nano),
+		End:         end.UTC().Format(time.RFC3339Nano),
+		Family:      "go",
+		Version:     "4",
+	}
+
+	ev, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for _, part := range []struct {
+		name, contentType string
+		data              []byte
+	}{
+		{"event", "application/json", ev},
+		{attachment, "application/octet-stream", data},
+	} {
+		h := make(textproto.MIMEHeader)
+		h.Set("Content-Disposition", fmt.Sprintf(`form-data; name=%q; filename=%q`, part.name, part.name))
+		h.Set("Content-Type", part.contentType)
+		w, err := mw.CreatePart(h)
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write(part.data); err != nil {
+			return err
+		}
+	}
+	if err := mw.Close(); err != nil {
+		return err
+	}
+
+	endpoint := d.Endpoint
+	if endpoint == "" {
+		site := d.Site
+		if site == "" {
+			site = "datadoghq.com"
+		}
+		endpoint = "https://intake.profile." + site + "/api/v2/profile"
+	}
+	req, err := http.NewRequest("POST", endpoint, &body)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	if d.APIKey != "" {
+		req.Header.Set("DD-API-KEY", d.APIKey)
+	}
+	req.Header.Set("DD-EVP-ORIGIN", "github.com/pkg/profile")
+	client := d.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("datadog: submit %s: %s: %s", name, resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+package profile
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestUploadDatadog(t *testing.T) {
+	var mu sync.Mutex
+	var events []datadogEvent
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v2/profile" || r.Header.Get("DD-API-KEY") != "secret" {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		if err := r.ParseMultipartForm(1 << 20); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		f, _, err := r.FormFile("event")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		defer f.Close()
+		var ev datadogEvent
+		if err := json.NewDecoder(f).Decode(&ev); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		for _, name := range ev.Attachments {
+			a, _, err := r.FormFile(name)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			data, _ := ioutil.ReadAll(a)
+			a.Close()
+			if _, err := parseProto(data); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		mu.Lock()
+		events = append(events, ev)
+		mu.Unlock()
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer srv.Close()
+
+	dd := &DatadogUploader{APIKey: "secret", Service: "myservice", Env: "prod", Version: "1.2.3", Endpoint: srv.URL + "/api/v2/profile"}
+	p, err := StartErr(GoroutineProfile, Snapshot(time.Millisecond), Upload(dd), UploadAsWritten, ProfilePath(t.TempDir()), Quiet, NoShutdownHook)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// snapshots are submitted while the session runs.
+	for {
+		mu.Lock()
+		n := len(events)
+		mu.Unlock()
+		if n > 0 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != len(p.Result().Files) {
+		t.Errorf("got %d profiles submitted, want %d", len(events), len(p.Result().Files))
+	}
+	ev := events[0]
+	if len(ev.Attachments) != 1 || ev.Attachments[0] != "goroutines.pprof" || ev.Family != "go" {
+		t.Errorf("got event %+v", ev)
+	}
+	for _, tag := range []string{"service:myservice", "env:prod", "version:1.2.3"} {
+		if !strings.Contains(ev.Tags, tag) {
+			t.Errorf("got tags %q, want %s", ev.Tags, tag)
+		}
+	}
+	start, serr := time.Parse(time.RFC3339Nano, ev.Start)
+	end, eerr := time.Parse(time.RFC3339Nano, ev.End)
+	if serr != nil || eerr != nil || !end.After(start) {
+		t.Errorf("got period %s to %s", ev.Start, ev.End)
+	}
+}
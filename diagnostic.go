@@ -0,0 +1,49 @@
+package profile
+
+import (
+	"fmt"
+	"runtime/pprof"
+)
+
+// DiagnosticSnapshot writes the profiles most useful for triaging a
+// hung or deadlocked program when the session stops: the stack of
+// every goroutine as text, the goroutine profile, and the thread
+// creation profile. As the session is stopped by the shutdown hook,
+// sending SIGINT to a program which appears hung records where each
+// goroutine is blocked before the program exits.
+// It replaces any previously selected profiling mode.
+func DiagnosticSnapshot(p *Profile) error { return p.setMode(DiagnosticMode) }
+
+// diagnosticProfiles lists the profiles written by DiagnosticSnapshot.
+var diagnosticProfiles = []struct {
+	name, filename string
+	debug          int
+}{
+	{"goroutine", "goroutine.txt", 2},
+	{"goroutine", "goroutine.pprof", 0},
+	{"threadcreate", "threadcreate.pprof", 0},
+}
+
+func (prof *Profile) startDiagnostic() error {
+	prof.logAttrs("profile: diagnostic snapshot enabled", "path", prof.dir)
+	prof.closer = func() error {
+		var err error
+		for _, d := range diagnosticProfiles {
+			w, fn, werr := prof.create(d.filename)
+			if werr != nil {
+				werr = fmt.Errorf("could not create %s profile %q: %v", d.name, fn, werr)
+			} else {
+				werr = pprof.Lookup(d.name).WriteTo(w, d.debug)
+				if cerr := w.Close(); werr == nil {
+					werr = cerr
+				}
+			}
+			if err == nil {
+				err = werr
+			}
+		}
+		prof.logAttrs("profile: diagnostic snapshot written", "path", prof.dir)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,46 @@
+package profile
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+)
+
+// dumpOnSignal calls dump each time one of sigs is received, until
+// the returned stop function is called. dump is passed the number of
+// the dump, starting from 1. stop waits for any dump in progress to
+// complete.
+func dumpOnSignal(sigs []os.Signal, dump func(n int)) (stop func()) {
+	if len(sigs) == 0 {
+		return func() {}
+	}
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, sigs...)
+	quit := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for n := 1; ; n++ {
+			select {
+			case <-c:
+				dump(n)
+			case <-quit:
+				return
+			}
+		}
+	}()
+	return func() {
+		signal.Stop(c)
+		close(quit)
+		<-done
+	}
+}
+
+// numberedFilename returns fn with n inserted before its extension,
+// for example heap.dump becomes heap-1.dump.
+func numberedFilename(fn string, n int) string {
+	ext := filepath.Ext(fn)
+	return fmt.Sprintf("%s-%d%s", strings.TrimSuffix(fn, ext), n, ext)
+}
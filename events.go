@@ -0,0 +1,101 @@
+package profile
+
+import "time"
+
+// An EventKind identifies what happened to a session, see Event.
+type EventKind int
+
+// Kinds of event.
+const (
+	// EventStarted is delivered when the session begins profiling.
+	EventStarted EventKind = iota + 1
+
+	// EventSnapshotWritten is delivered when a snapshot, see
+	// Snapshot, SnapshotSignal and Watchdog, has been written.
+	EventSnapshotWritten
+
+	// EventStopped is delivered once the session has stopped and
+	// its data has been written. It is the last event delivered.
+	EventStopped
+
+	// EventError is delivered when something fails, for example a
+	// snapshot which could not be written.
+	EventError
+)
+
+func (k EventKind) String() string {
+	switch k {
+	case EventStarted:
+		return "started"
+	case EventSnapshotWritten:
+		return "snapshot written"
+	case EventStopped:
+		return "stopped"
+	case EventError:
+		return "error"
+	default:
+		return "unknown"
+	}
+}
+
+// An Event describes something which happened to a session, see
+// Profile.Events.
+type Event struct {
+	// Kind identifies what happened.
+	Kind EventKind
+
+	// Mode holds the kind of profiling performed by the session.
+	Mode Mode
+
+	// Time holds when the event happened.
+	Time time.Time
+
+	// Path holds the file written by EventSnapshotWritten, or the
+	// first file written by EventStarted.
+	Path string
+
+	// Err holds the error for EventError, and for EventStopped, the
+	// error reported by the session's Result.
+	Err error
+}
+
+// eventBuffer holds the number of events which may be waiting to be
+// received from the channel returned by Events. The channel has room
+// for one more, reserved for EventStopped.
+const eventBuffer = 64
+
+// Events returns a channel on which the session's events are
+// delivered, so that a supervising goroutine can react to them
+// without callbacks or reading log messages. The channel is closed
+// after EventStopped has been delivered. Other events are not
+// delivered while the channel is full, so it should be received from
+// promptly, but EventStopped is always delivered.
+func (p *Profile) Events() <-chan Event { return p.events }
+
+// sendEvent delivers an event of the given kind, unless the channel
+// returned by Events is full or closed. Room is kept for EventStopped,
+// which is sent at most once.
+func (p *Profile) sendEvent(kind EventKind, path string, err error) {
+	p.eventsMu.Lock()
+	defer p.eventsMu.Unlock()
+	if p.events == nil || p.eventsClosed {
+		return
+	}
+	if kind != EventStopped && len(p.events) >= eventBuffer {
+		return
+	}
+	select {
+	case p.events <- Event{Kind: kind, Mode: p.mode, Time: time.Now(), Path: path, Err: err}:
+	default:
+	}
+}
+
+// closeEvents closes the channel returned by Events.
+func (p *Profile) closeEvents() {
+	p.eventsMu.Lock()
+	defer p.eventsMu.Unlock()
+	if p.events != nil && !p.eventsClosed {
+		p.eventsClosed = true
+		close(p.events)
+	}
+}
@@ -0,0 +1,67 @@
+package profile
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestEvents(t *testing.T) {
+	dir := t.TempDir()
+	p, err := StartErr(GoroutineProfile, Snapshot(time.Millisecond), ProfilePath(dir), Quiet, NoShutdownHook)
+	if err != nil {
+		t.Fatal(err)
+	}
+	events := p.Events()
+	ev := <-events
+	if want := filepath.Join(dir, "goroutine.pprof"); ev.Kind != EventStarted || ev.Mode != GoroutineMode || ev.Path != want {
+		t.Errorf("got first event %+v, want %v of %s", ev, EventStarted, want)
+	}
+	ev = <-events
+	if ev.Kind != EventSnapshotWritten || filepath.Dir(ev.Path) != dir {
+		t.Errorf("got event %+v, want %v", ev, EventSnapshotWritten)
+	}
+
+	p.logError(errors.New("profile: something failed"))
+	p.Stop()
+	var kinds []EventKind
+	var last Event
+	for ev := range events {
+		if ev.Kind == EventError && ev.Err.Error() != "profile: something failed" {
+			t.Errorf("got error event %+v", ev)
+		}
+		kinds = append(kinds, ev.Kind)
+		last = ev
+	}
+	if last.Kind != EventStopped || last.Err != nil {
+		t.Errorf("got last event %+v, want %v", last, EventStopped)
+	}
+	found := false
+	for _, k := range kinds {
+		found = found || k == EventError
+	}
+	if !found {
+		t.Errorf("got events %v, want %v", kinds, EventError)
+	}
+}
+
+func TestEventsFull(t *testing.T) {
+	p, err := StartErr(GoroutineProfile, ProfilePath(t.TempDir()), Quiet, NoShutdownHook)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2*eventBuffer; i++ {
+		p.logError(errors.New("profile: something failed"))
+	}
+	p.Stop()
+	var n int
+	var last Event
+	for ev := range p.Events() {
+		n++
+		last = ev
+	}
+	if n != eventBuffer+1 || last.Kind != EventStopped {
+		t.Errorf("got %d events ending with %+v, want %d ending with %v", n, last, eventBuffer+1, EventStopped)
+	}
+}
@@ -0,0 +1,18 @@
+//go:build go1.21
+// +build go1.21
+
+package profile_test
+
+import (
+	"log/slog"
+	"os"
+
+	"github.com/pkg/profile"
+)
+
+func ExampleWithSlog() {
+	// log messages as JSON records, with the mode and the path of the
+	// profile as attributes.
+	logger := slog.New(slog.NewJSONHandler(os.Stderr, nil))
+	defer profile.Start(profile.CPUProfile, profile.WithSlog(logger)).Stop()
+}
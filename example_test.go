@@ -1,8 +1,14 @@
 package profile_test
 
 import (
+	"bytes"
+	"context"
 	"flag"
+	"log"
+	"net/http"
 	"os"
+	"sync"
+	"time"
 
 	"github.com/pkg/profile"
 )
@@ -49,6 +55,27 @@ func ExampleNoShutdownHook() {
 	defer profile.Start(profile.NoShutdownHook).Stop()
 }
 
+func ExampleShutdownOnQuit() {
+	// write the profile when the process receives SIGQUIT, as well as
+	// SIGINT and SIGTERM.
+	defer profile.Start(profile.ShutdownOnQuit).Stop()
+}
+
+func ExampleShutdownNotify() {
+	// shut down gracefully on SIGINT or SIGTERM, once the shutdown
+	// hook has written the profile.
+	c := make(chan os.Signal, 1)
+	defer profile.Start(profile.ShutdownNotify(c)).Stop()
+
+	<-c
+}
+
+func ExampleShutdownTimeout() {
+	// exit at most ten seconds after an interrupt, even if the
+	// profile has not been uploaded.
+	defer profile.Start(profile.UploadHTTP("https://example.com/profiles", nil), profile.ShutdownTimeout(10*time.Second)).Stop()
+}
+
 func ExampleStart_withFlags() {
 	// use the flags package to selectively enable profiling.
 	mode := flag.String("profile.mode", "", "enable profiling mode, one of [cpu, mem, mutex, block]")
@@ -66,3 +93,589 @@ func ExampleStart_withFlags() {
 		// do nothing
 	}
 }
+
+func ExampleStartErr() {
+	// start a CPU profile, handling any error rather
+	// than exiting the program.
+	p, err := profile.StartErr(profile.CPUProfile)
+	if err != nil {
+		log.Print(err)
+		return
+	}
+	defer p.Stop()
+}
+
+func ExampleStartWithContext() {
+	// stop profiling when ctx is cancelled, then wait
+	// for the profile to be written.
+	ctx, cancel := context.WithCancel(context.Background())
+	p, err := profile.StartWithContext(ctx, profile.CPUProfile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	// ... run the program until it is time to shut down.
+	cancel()
+	<-p.Done()
+}
+
+func ExampleProfile_Pause() {
+	// exclude a warm up phase from the cpu profile.
+	p := profile.Start(profile.CPUProfile)
+	defer p.Stop()
+	p.Pause()
+	// ... warm up caches.
+	p.Resume()
+}
+
+func ExampleStartConfig() {
+	// configure the profiling session from a struct, for
+	// example one decoded from a configuration file.
+	p, err := profile.StartConfig(profile.Config{
+		Mode:           profile.MemMode,
+		MemProfileRate: 2048,
+		Path:           ".",
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer p.Stop()
+}
+
+func ExampleWriteTo() {
+	// write the profile to a buffer rather than to a file.
+	var buf bytes.Buffer
+	p := profile.Start(profile.MemProfile, profile.WriteTo(&buf))
+	// ... run the code to be profiled.
+	p.Stop()
+	log.Printf("memory profile is %d bytes", buf.Len())
+}
+
+func ExampleOnStop() {
+	// report where the profile was written once it has been flushed.
+	defer profile.Start(profile.OnStop(func(r profile.Result) {
+		if r.Err != nil {
+			log.Printf("%v profile failed: %v", r.Mode, r.Err)
+			return
+		}
+		log.Printf("%v profile written to %v", r.Mode, r.Files)
+	})).Stop()
+}
+
+func ExampleDuration() {
+	// collect a cpu profile for the first 30 seconds of the program.
+	p := profile.Start(profile.CPUProfile, profile.Duration(30*time.Second))
+
+	// ...
+
+	<-p.Done()
+	log.Printf("cpu profile written to %v", p.Result().Files)
+}
+
+func ExampleHandler() {
+	// control profiling remotely, for example with
+	// curl -X POST 'localhost:6060/debug/profile/start?mode=cpu&seconds=30'
+	http.Handle("/debug/profile/", profile.Handler(profile.ProfilePath("/var/log/myapp")))
+	log.Fatal(http.ListenAndServe("localhost:6060", nil))
+}
+
+func ExampleWhenCPUAbove() {
+	// capture a 10 second cpu profile whenever cpu usage has been
+	// above 80% for 30 seconds, at most once an hour.
+	trigger := profile.WhenCPUAbove(80, 30*time.Second)
+	trigger.Duration = 10 * time.Second
+	trigger.Cooldown = time.Hour
+	w, err := profile.Watch(trigger, profile.ProfilePath("/var/log/myapp"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer w.Stop()
+}
+
+func ExampleWhenHeapAbove() {
+	// write heap and allocs profiles when the heap grows beyond 1GB.
+	w, err := profile.Watch(profile.WhenHeapAbove(1<<30), profile.MemProfileHeapAndAllocs)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer w.Stop()
+}
+
+func ExampleWhenGoroutinesAbove() {
+	// write the stacks of every goroutine, at most once every
+	// 15 minutes, while there are more than 10000 goroutines.
+	trigger := profile.WhenGoroutinesAbove(10000)
+	trigger.Cooldown = 15 * time.Minute
+	w, err := profile.Watch(trigger)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer w.Stop()
+}
+
+func ExampleWhenGCPauseAbove() {
+	// capture a memory profile and an execution trace when a gc
+	// pause of 10ms or more is seen.
+	w, err := profile.Watch(profile.WhenGCPauseAbove(10 * time.Millisecond))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer w.Stop()
+}
+
+func ExampleSchedule() {
+	// take a 30 second cpu profile every 15 minutes, keeping the
+	// last day of profiles.
+	w, err := profile.Watch(profile.Schedule("*/15 * * * *", profile.CPUMode, 30*time.Second),
+		profile.ProfilePath("/var/log/myapp"), profile.Retention(96))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer w.Stop()
+}
+
+func ExampleSampleWindow() {
+	// profile the cpu for 10 seconds of every 10 minutes.
+	w, err := profile.Watch(profile.SampleWindow(10*time.Second, 10*time.Minute))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer w.Stop()
+}
+
+func ExampleWhenNearMemLimit() {
+	// write heap and allocs profiles when memory use reaches
+	// 90% of GOMEMLIMIT.
+	w, err := profile.Watch(profile.WhenNearMemLimit(0.9))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer w.Stop()
+}
+
+func ExampleControlFile() {
+	// profile when /var/run/myapp/profile-now is touched, or
+	// written with a mode and duration such as "mutex 30s".
+	w, err := profile.Watch(profile.ControlFile("/var/run/myapp/profile-now"), profile.ProfilePath("/var/log/myapp"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer w.Stop()
+}
+
+func ExampleListenControl() {
+	// accept commands such as
+	// profilectl -socket /var/run/myapp/profile.sock start cpu 30s
+	s, err := profile.ListenControl("/var/run/myapp/profile.sock", profile.ProfilePath("/var/log/myapp"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer s.Close()
+}
+
+func ExampleWhenContentionAbove() {
+	// record every contention event for 30 seconds when goroutines
+	// spend more than 200ms of each second waiting for locks.
+	w, err := profile.Watch(profile.WhenContentionAbove(200 * time.Millisecond))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer w.Stop()
+}
+
+func ExampleBudget() {
+	// profile for at most 2% of each hour, and at most four times
+	// an hour, however often cpu usage is high.
+	w, err := profile.Watch(profile.WhenCPUAbove(80, time.Minute), profile.Budget(0.02, 4))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer w.Stop()
+}
+
+func ExampleAttachable() {
+	// allow profiling to be started later with, for example,
+	// profile attach <pid> start cpu 30s
+	s, err := profile.Attachable(profile.ProfilePath("/var/log/myapp"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer s.Close()
+}
+
+func ExampleStartWithSignals() {
+	// run until interrupted, returning once the profile is written.
+	ctx, stop, err := profile.StartWithSignals(context.Background(), profile.CPUProfile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer stop()
+
+	<-ctx.Done()
+}
+
+func ExampleExit() {
+	// os.Exit does not run deferred calls, so exit with
+	// profile.Exit, which stops the session first.
+	defer profile.Start(profile.MemProfile).Stop()
+
+	if _, err := os.Stat("config.json"); err != nil {
+		log.Print(err)
+		profile.Exit(1)
+	}
+}
+
+func ExampleMain() {
+	// write the profile when run returns, even though the session
+	// is never stopped.
+	profile.Main(func() {
+		profile.Start(profile.MemProfile)
+		// ...
+	})
+}
+
+func ExampleRun() {
+	// profile until the service's context is done, alongside the
+	// service's other goroutines, for example in an errgroup.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := profile.Run(ctx, profile.CPUProfile, profile.Duration(time.Minute)); err != nil {
+		log.Print(err)
+	}
+}
+
+func ExampleJSONEvents() {
+	// write messages as JSON events on standard output, for example
+	// {"event":"profile_start","mode":"cpu","file":"cpu.pprof",...}.
+	defer profile.Start(profile.CPUProfile, profile.JSONEvents(os.Stdout)).Stop()
+}
+
+func ExampleVerbosity() {
+	// log only failures to write the profile.
+	defer profile.Start(profile.CPUProfile, profile.Verbosity(profile.LogErrors)).Stop()
+}
+
+func ExampleMetricsHandler() {
+	// serve metrics about profiling, for example to alert if
+	// continuous profiling stops.
+	http.Handle("/metrics/profile", profile.MetricsHandler())
+	defer profile.Start(profile.CPUProfile).Stop()
+}
+
+func ExampleReportProgress() {
+	// log the size of the trace every ten minutes.
+	defer profile.Start(profile.TraceProfile, profile.ReportProgress(10*time.Minute, nil)).Stop()
+}
+
+func ExampleOnProfileWritten() {
+	// log each file as soon as it is written.
+	written := profile.OnProfileWritten(func(path, mode string, size int64) {
+		log.Printf("%s profile %s written, %d bytes", mode, path, size)
+	})
+	defer profile.Start(profile.MemProfile, written).Stop()
+}
+
+func ExampleProfile_Events() {
+	// report failures to write snapshots from a supervising goroutine.
+	p := profile.Start(profile.GoroutineProfile, profile.Snapshot(time.Minute))
+	defer p.Stop()
+	go func() {
+		for ev := range p.Events() {
+			if ev.Kind == profile.EventError {
+				log.Printf("profiling failed: %v", ev.Err)
+			}
+		}
+	}()
+}
+
+func ExampleOnError() {
+	// carry on without profiling if the session cannot be started,
+	// rather than exiting.
+	onError := profile.OnError(func(err error) {
+		log.Printf("profiling failed: %v", err)
+	})
+	defer profile.Start(profile.CPUProfile, profile.ProfilePath("/var/lib/myapp"), onError).Stop()
+}
+
+func ExampleOverhead() {
+	// record the cost of profiling alongside the profile.
+	p := profile.Start(profile.MemProfileRate(1), profile.OnStop(func(r profile.Result) {
+		log.Printf("%v profiling overhead: %v", r.Mode, r.Overhead)
+	}))
+	defer p.Stop()
+}
+
+func ExampleLogSummary() {
+	// log the duration, samples and file sizes of the session when it stops.
+	defer profile.Start(profile.CPUProfile, profile.LogSummary).Stop()
+}
+
+func ExampleHTTPMiddleware() {
+	// label each request's samples, and profile one request in a thousand.
+	h := profile.HTTPMiddleware(http.DefaultServeMux, profile.MiddlewareOptions{
+		Handler:    "api",
+		SampleRate: 0.001,
+		Options:    []profile.Option{profile.ProfilePath("/var/lib/myapp/profiles")},
+	})
+	log.Fatal(http.ListenAndServe("localhost:8080", h))
+}
+
+func ExampleServePprof() {
+	// allow profiles to be pulled with go tool pprof while writing a
+	// memory profile for the whole run.
+	s, err := profile.ServePprof("localhost:6060")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer s.Close()
+	defer profile.Start(profile.MemProfile).Stop()
+}
+
+func ExampleDoRPC() {
+	// label the samples of an RPC handler, as a gRPC interceptor would
+	// using the method name from its info argument.
+	handler := func(ctx context.Context) {}
+	profile.DoRPC(context.Background(), "/helloworld.Greeter/SayHello", handler)
+}
+
+func ExampleEnabled() {
+	// use a flag to decide whether to profile, without branching.
+	cpuprofile := flag.Bool("cpuprofile", false, "write a cpu profile")
+	flag.Parse()
+	defer profile.Start(profile.Enabled(*cpuprofile)).Stop()
+}
+
+func ExampleNew() {
+	// prepare a cpu profile during initialisation ...
+	p, err := profile.New(profile.CPUProfile, profile.ProfilePath("."))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer p.Stop()
+
+	// ... and begin collecting samples once the program
+	// has reached a steady state.
+	if err := p.Begin(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func ExampleMem() {
+	// profile allocations, sampling on average one
+	// allocation per 512 bytes.
+	defer profile.Start(profile.Mem(512, "allocs")).Stop()
+}
+
+func ExampleHeapDumpProfile() {
+	// write a full heap dump when the program exits.
+	defer profile.Start(profile.HeapDumpProfile).Stop()
+}
+
+func ExampleGCTraceProfile() {
+	// record garbage collections alongside a heap profile.
+	defer profile.Start(profile.GCTraceProfile).Stop()
+	defer profile.Start(profile.MemProfile).Stop()
+}
+
+func ExampleTraceFlightRecorder() {
+	// keep only the last ten seconds of execution trace,
+	// writing it out when the program exits.
+	defer profile.Start(profile.TraceFlightRecorder(10 * time.Second)).Stop()
+}
+
+func ExampleCPUProfileRate() {
+	// sample at 500Hz for a more detailed profile of a short run.
+	defer profile.Start(profile.CPUProfileRate(500)).Stop()
+}
+
+func ExampleAllProfiles() {
+	// write every runtime profile to the current directory on exit.
+	defer profile.Start(profile.AllProfiles, profile.ProfilePath(".")).Stop()
+}
+
+func ExampleWithLabels() {
+	// label cpu samples with the job being run, so profiles from
+	// different jobs can be told apart with pprof -tagfocus.
+	defer profile.Start(profile.CPUProfile, profile.WithLabels("job", "reindex")).Stop()
+}
+
+func ExampleDiagnosticSnapshot() {
+	// record every goroutine's stack when the program is
+	// interrupted, to find out why it appears hung.
+	defer profile.Start(profile.DiagnosticSnapshot).Stop()
+}
+
+func ExampleMemStatsProfile() {
+	// record memory statistics every ten seconds alongside
+	// a heap profile.
+	defer profile.Start(profile.MemStatsProfile, profile.MemStatsInterval(10*time.Second), profile.ProfilePath(".")).Stop()
+	defer profile.Start(profile.MemProfile, profile.ProfilePath(".")).Stop()
+}
+
+func ExampleExpvarSnapshot() {
+	// write the program's expvar counters next to the cpu profile.
+	defer profile.Start(profile.CPUProfile, profile.ExpvarSnapshot).Stop()
+}
+
+func ExampleProfile_Recover() {
+	prof := profile.Start(profile.CPUProfile)
+	defer prof.Stop()
+
+	// flush the cpu profile and record every goroutine's
+	// stack if the worker panics.
+	go func() {
+		defer prof.Recover()
+		// ...
+	}()
+}
+
+func ExampleCatchPanic() {
+	// flush every running session and record every goroutine's
+	// stack if main panics.
+	defer profile.Start(profile.CPUProfile).Stop()
+	defer profile.CatchPanic()
+}
+
+func ExampleWatchdog() {
+	// dump every goroutine's stack if the cache lock cannot be
+	// acquired within 30 seconds.
+	var cacheMu sync.Mutex
+	heartbeat := func() {
+		cacheMu.Lock()
+		cacheMu.Unlock()
+	}
+	defer profile.Start(profile.CPUProfile, profile.Watchdog(heartbeat, 30*time.Second)).Stop()
+}
+
+func ExampleUploadS3() {
+	// copy the cpu profile to S3 when the program exits, using
+	// credentials from the environment.
+	defer profile.Start(profile.CPUProfile, profile.UploadS3("my-profiles", "myservice/")).Stop()
+}
+
+func ExampleUploadGCS() {
+	// copy the heap profile to Cloud Storage when the program
+	// exits, authorized as the instance's service account.
+	defer profile.Start(profile.MemProfile, profile.UploadGCS("my-profiles", "myservice/")).Stop()
+}
+
+func ExampleUploadCloudProfiler() {
+	// submit a heap profile to Cloud Profiler when the program exits,
+	// using the project and service account of the instance.
+	defer profile.Start(profile.MemProfile, profile.UploadCloudProfiler("myservice", "1.2.3")).Stop()
+}
+
+func ExampleUploadDatadog() {
+	// feed Datadog's continuous profiler with a heap profile every
+	// minute while the program runs.
+	dd := profile.UploadDatadog(os.Getenv("DD_API_KEY"), "datadoghq.com", "myservice", "prod", "1.2.3")
+	defer profile.Start(profile.MemProfile, profile.Snapshot(time.Minute), dd, profile.UploadAsWritten).Stop()
+}
+
+func ExampleUploadHTTP() {
+	// send the cpu profile to a collector when the program exits,
+	// giving up after ten seconds.
+	header := http.Header{"Authorization": {"Bearer " + os.Getenv("COLLECTOR_TOKEN")}}
+	defer profile.Start(profile.CPUProfile,
+		profile.UploadHTTP("https://collector.example.com/profiles", header),
+		profile.UploadTimeout(10*time.Second)).Stop()
+}
+
+func ExampleTimestamp() {
+	// keep the cpu profile of every run in the current directory.
+	defer profile.Start(profile.CPUProfile, profile.ProfilePath("."), profile.Timestamp).Stop()
+}
+
+func ExampleProfileFilenameTemplate() {
+	// name the profile after the host and process which wrote it.
+	defer profile.Start(profile.CPUProfile,
+		profile.ProfileFilenameTemplate("{mode}-{hostname}-{pid}-{tag}.pprof"),
+		profile.ProfileTag("canary")).Stop()
+}
+
+func ExampleRetention() {
+	// keep the cpu profiles of the last five runs.
+	defer profile.Start(profile.CPUProfile, profile.ProfilePath("."), profile.Timestamp, profile.Retention(5)).Stop()
+}
+
+func ExampleProfileFileMode() {
+	// make the profile readable only by the user running the program.
+	defer profile.Start(profile.CPUProfile,
+		profile.ProfilePath("/var/lib/myservice/profiles"),
+		profile.ProfileDirMode(0700),
+		profile.ProfileFileMode(0600)).Stop()
+}
+
+func ExampleArchiveOutput() {
+	// package the cpu profile and expvar counters into one file.
+	defer profile.Start(profile.CPUProfile, profile.ExpvarSnapshot, profile.ArchiveOutput).Stop()
+}
+
+func ExampleCaptureInMemory() {
+	p := profile.Start(profile.CPUProfile, profile.CaptureInMemory)
+	// ...
+	p.Stop()
+
+	// forward the profile elsewhere.
+	_ = p.Bytes(profile.CPUMode)
+}
+
+func ExampleLatestSymlink() {
+	// keep every run's profile, with cpu-latest.pprof linking
+	// to the newest.
+	defer profile.Start(profile.CPUProfile, profile.ProfilePath("."), profile.Timestamp, profile.LatestSymlink).Stop()
+}
+
+func ExampleBuildInfoComments() {
+	// record the VCS revision of the binary in the profile,
+	// see go tool pprof -comments.
+	defer profile.Start(profile.CPUProfile, profile.BuildInfoComments).Stop()
+}
+
+func ExampleTextFormat() {
+	// write a heap profile which can be read without go tool pprof.
+	defer profile.Start(profile.MemProfile, profile.TextFormat).Stop()
+}
+
+func ExampleDualFormat() {
+	// write both goroutine.pprof and goroutine.txt.
+	defer profile.Start(profile.GoroutineProfile, profile.DualFormat).Stop()
+}
+
+func ExampleCPUProfileChunks() {
+	// write a new cpu profile every ten minutes, so that little
+	// is lost if the program crashes.
+	defer profile.Start(profile.CPUProfileChunks(10 * time.Minute)).Stop()
+}
+
+func ExampleRunDir() {
+	// write each run's profiles to a new directory under ./profiles.
+	defer profile.Start(profile.CPUProfile, profile.ProfilePath("profiles"), profile.RunDir("")).Stop()
+}
+
+func ExampleProfileTempDir() {
+	// create a unique directory, such as /var/log/myapp/profiles/cpu-123456,
+	// for the profile.
+	defer profile.Start(profile.CPUProfile, profile.ProfileTempDir("/var/log/myapp/profiles", "cpu-")).Stop()
+}
+
+func ExampleMaxRuns() {
+	// keep the profile directories of the last ten runs, removing
+	// any which are more than a week old.
+	defer profile.Start(profile.CPUProfile, profile.MaxRuns(10), profile.MaxAge(7*24*time.Hour)).Stop()
+}
+
+func ExampleManifest() {
+	// describe the files written by the session in manifest.json.
+	defer profile.Start(profile.CPUProfile, profile.Manifest).Stop()
+}
+
+func ExampleSnapshot() {
+	// write a heap profile every minute, mem-0001.pprof and so on,
+	// to watch a leak develop.
+	defer profile.Start(profile.MemProfile, profile.Snapshot(time.Minute)).Stop()
+}
+
+func ExampleMemProfileHeapAndAllocs() {
+	// write both heap and allocs profiles from one session.
+	defer profile.Start(profile.MemProfileHeapAndAllocs).Stop()
+}
@@ -0,0 +1,46 @@
+//go:build !windows && !plan9 && !js && !wasip1
+// +build !windows,!plan9,!js,!wasip1
+
+package profile_test
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/pkg/profile"
+)
+
+func ExampleToggleSignal() {
+	// start a cpu profile when the process receives SIGUSR1, for
+	// example from kill -USR1 <pid>, and write it on the next SIGUSR1.
+	defer profile.Start(profile.CPUProfile, profile.ToggleSignal(syscall.SIGUSR1)).Stop()
+}
+
+func ExampleSnapshotSignal() {
+	// write heap and goroutine snapshots whenever the process
+	// receives SIGUSR2, while the cpu profile is collected.
+	defer profile.Start(profile.CPUProfile, profile.SnapshotSignal(syscall.SIGUSR2)).Stop()
+}
+
+func ExampleRotateSignal() {
+	// start a new cpu profile, named with the time, each time the
+	// process receives SIGHUP.
+	defer profile.Start(profile.CPUProfile, profile.RotateSignal(syscall.SIGHUP)).Stop()
+}
+
+func ExampleShutdownSignals() {
+	// write the profile when the process receives SIGHUP or SIGTERM,
+	// but not SIGINT.
+	defer profile.Start(profile.ShutdownSignals(syscall.SIGHUP, syscall.SIGTERM)).Stop()
+}
+
+func ExampleShutdownNoExit() {
+	// handle SIGINT and SIGTERM in the application, which shuts
+	// down gracefully after the shutdown hook writes the profile.
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+	defer profile.Start(profile.ShutdownNoExit).Stop()
+
+	<-c
+}
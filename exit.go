@@ -0,0 +1,30 @@
+package profile
+
+import "os"
+
+// Go has no equivalent of atexit: returning from main, or calling
+// os.Exit, ends the program without running deferred calls, so the
+// data of any session which has not been stopped is lost. Exit and
+// Main stop every running session first.
+
+// Exit stops every running session, writing its data, and then exits
+// the program with the given status. Programs should call Exit in
+// place of os.Exit while profiling.
+func Exit(code int) {
+	StopActive()
+	os.Exit(code)
+}
+
+// Main calls main, typically the body of the program's main function,
+// and then stops every running session, writing its data, even if the
+// program never calls Stop:
+//
+//	func main() {
+//		profile.Main(run)
+//	}
+//
+// Sessions are also stopped if main panics, before the panic resumes.
+func Main(main func()) {
+	defer StopActive()
+	main()
+}
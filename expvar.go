@@ -0,0 +1,41 @@
+package profile
+
+import (
+	"expvar"
+	"fmt"
+	"path/filepath"
+)
+
+// ExpvarSnapshot writes the variables published with package expvar
+// to expvar.json in the profile directory when the session stops,
+// giving the runtime profiles application level context. The file
+// has the same format as the /debug/vars endpoint.
+func ExpvarSnapshot(p *Profile) error {
+	p.expvar = true
+	return nil
+}
+
+// writeExpvar writes the expvar snapshot for ExpvarSnapshot.
+func (p *Profile) writeExpvar() error {
+	fn := filepath.Join(p.dir, p.outputName("expvar.json"))
+	f, err := p.createFile(fn)
+	if err != nil {
+		return fmt.Errorf("profile: could not create expvar snapshot %q: %v", fn, err)
+	}
+	fmt.Fprintf(f, "{\n")
+	first := true
+	expvar.Do(func(kv expvar.KeyValue) {
+		if !first {
+			fmt.Fprintf(f, ",\n")
+		}
+		first = false
+		fmt.Fprintf(f, "%q: %s", kv.Key, kv.Value)
+	})
+	fmt.Fprintf(f, "\n}\n")
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("profile: could not write expvar snapshot %q: %v", fn, err)
+	}
+	p.addFile(fn)
+	p.logAttrs("profile: expvar snapshot written", "path", fn)
+	return nil
+}
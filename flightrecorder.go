@@ -0,0 +1,72 @@
+package profile
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// TraceFlightRecorder enables flight recording of the execution trace.
+// Rather than writing the entire trace, which can be enormous for long
+// sessions, the runtime retains roughly the last window of execution
+// in memory. The retained trace is written when the session stops and
+// each time one of the given signals is received, the latter to
+// numbered files. If window is zero, the runtime's default is used.
+// Flight recording requires Go 1.25 or later and may run concurrently
+// with a TraceProfile session.
+// It replaces any previously selected profiling mode.
+func TraceFlightRecorder(window time.Duration, sig ...os.Signal) Option {
+	return func(p *Profile) error {
+		if window < 0 {
+			return fmt.Errorf("profile: flight recorder window must not be negative")
+		}
+		p.flightRecorderWindow = window
+		p.flightRecorderSignals = sig
+		return p.setMode(FlightRecorderMode)
+	}
+}
+
+func (prof *Profile) startFlightRecorder() error {
+	fr, err := newFlightRecorder(prof.flightRecorderWindow)
+	if err != nil {
+		return err
+	}
+	w, fn, err := prof.create("trace.out")
+	if err != nil {
+		return fmt.Errorf("profile: could not create trace output file %q: %v", fn, err)
+	}
+	if err := fr.Start(); err != nil {
+		w.Close()
+		return fmt.Errorf("profile: could not start flight recorder: %v", err)
+	}
+
+	stop := dumpOnSignal(prof.flightRecorderSignals, func(n int) {
+		dn := numberedFilename(fn, n)
+		f, err := prof.createFile(dn)
+		if err == nil {
+			_, err = fr.WriteTo(f)
+			if cerr := f.Close(); err == nil {
+				err = cerr
+			}
+		}
+		if err != nil {
+			prof.logAttrs(fmt.Sprintf("profile: could not write flight recording %q", dn), "error", err)
+			return
+		}
+		prof.addFile(dn)
+		prof.logAttrs("profile: flight recording written", "path", dn)
+	})
+
+	prof.logAttrs("profile: trace flight recorder enabled", "path", fn)
+	prof.closer = func() error {
+		stop()
+		_, err := fr.WriteTo(w)
+		fr.Stop()
+		if cerr := w.Close(); err == nil {
+			err = cerr
+		}
+		prof.logAttrs("profile: trace flight recorder disabled", "path", fn)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,21 @@
+//go:build go1.25
+// +build go1.25
+
+package profile
+
+import (
+	"io"
+	"runtime/trace"
+	"time"
+)
+
+// flightRecorder is implemented by *trace.FlightRecorder.
+type flightRecorder interface {
+	Start() error
+	Stop()
+	WriteTo(w io.Writer) (int64, error)
+}
+
+func newFlightRecorder(window time.Duration) (flightRecorder, error) {
+	return trace.NewFlightRecorder(trace.FlightRecorderConfig{MinAge: window}), nil
+}
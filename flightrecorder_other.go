@@ -0,0 +1,21 @@
+//go:build !go1.25
+// +build !go1.25
+
+package profile
+
+import (
+	"errors"
+	"io"
+	"time"
+)
+
+// flightRecorder is implemented by *trace.FlightRecorder.
+type flightRecorder interface {
+	Start() error
+	Stop()
+	WriteTo(w io.Writer) (int64, error)
+}
+
+func newFlightRecorder(window time.Duration) (flightRecorder, error) {
+	return nil, errors.New("profile: trace flight recorder requires Go 1.25 or later")
+}
@@ -0,0 +1,31 @@
+//go:build go1.25
+// +build go1.25
+
+package profile
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestTraceFlightRecorder(t *testing.T) {
+	var buf bytes.Buffer
+	p, err := StartErr(TraceFlightRecorder(time.Second), WriteTo(&buf), Quiet, NoShutdownHook)
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(10 * time.Millisecond)
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(buf.Bytes(), []byte("go 1.")) {
+		t.Fatalf("output does not look like an execution trace: %q", buf.Bytes()[:min(len(buf.Bytes()), 16)])
+	}
+}
+
+func TestTraceFlightRecorderInvalid(t *testing.T) {
+	if _, err := New(TraceFlightRecorder(time.Second), CPUProfile); err == nil {
+		t.Fatal("expected error combining TraceFlightRecorder settings with CPU profiling")
+	}
+}
@@ -0,0 +1,52 @@
+package profile
+
+import (
+	"io"
+	"runtime/pprof"
+)
+
+// createLookup creates the output for the runtime/pprof profile
+// called name, in the format selected for the session.
+func (prof *Profile) createLookup(name string) (io.WriteCloser, string, error) {
+	if !prof.dualFormat {
+		return prof.create(prof.lookupFilename(name))
+	}
+	pw, pfn, err := prof.create(name + ".pprof")
+	if err != nil {
+		return nil, pfn, err
+	}
+	tw, tfn, err := prof.create(name + ".txt")
+	if err != nil {
+		pw.Close()
+		return nil, tfn, err
+	}
+	return &dualOutput{proto: pw, text: tw}, pfn + ", " + tfn, nil
+}
+
+// dualOutput is the output of a profile written by DualFormat.
+type dualOutput struct {
+	proto, text io.WriteCloser
+}
+
+func (d *dualOutput) Write(b []byte) (int, error) { return d.proto.Write(b) }
+
+// write writes p to both outputs, using the text format given by
+// debug, or the default text format if debug is zero.
+func (d *dualOutput) write(p *pprof.Profile, debug int) error {
+	if debug == 0 {
+		debug = 1
+	}
+	err := p.WriteTo(d.proto, 0)
+	if terr := p.WriteTo(d.text, debug); err == nil {
+		err = terr
+	}
+	return err
+}
+
+func (d *dualOutput) Close() error {
+	err := d.proto.Close()
+	if cerr := d.text.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
@@ -0,0 +1,15 @@
+//go:build go1.22
+// +build go1.22
+
+package profile
+
+import "runtime/metrics"
+
+// readGCPauses returns the histogram of gc pauses, where buckets has
+// one more element than counts.
+func readGCPauses() (counts []uint64, buckets []float64, err error) {
+	samples := []metrics.Sample{{Name: "/sched/pauses/total/gc:seconds"}}
+	metrics.Read(samples)
+	h := samples[0].Value.Float64Histogram()
+	return append([]uint64(nil), h.Counts...), h.Buckets, nil
+}
@@ -0,0 +1,10 @@
+//go:build !go1.22
+// +build !go1.22
+
+package profile
+
+import "errors"
+
+func readGCPauses() (counts []uint64, buckets []float64, err error) {
+	return nil, nil, errors.New("profile: WhenGCPauseAbove requires Go 1.22 or later")
+}
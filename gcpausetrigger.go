@@ -0,0 +1,62 @@
+package profile
+
+import (
+	"fmt"
+	"time"
+)
+
+// DefaultGCPauseTraceDuration is the default length of the execution
+// trace captured by WhenGCPauseAbove.
+const DefaultGCPauseTraceDuration = 5 * time.Second
+
+// WhenGCPauseAbove returns a Trigger which, when the runtime reports
+// a garbage collection pause of at least limit, writes a memory
+// profile and then an execution trace lasting the trigger's Duration,
+// DefaultGCPauseTraceDuration unless changed. Pauses are read from the
+// /sched/pauses/total/gc:seconds histogram of package runtime/metrics,
+// so a pause is only detected with the precision of its buckets.
+// WhenGCPauseAbove requires Go 1.22 or later; Watch reports an error
+// otherwise.
+func WhenGCPauseAbove(limit time.Duration) Trigger {
+	return Trigger{
+		Interval: DefaultTriggerInterval,
+		Cooldown: DefaultTriggerCooldown,
+		Duration: DefaultGCPauseTraceDuration,
+		name:     "gcpauseabove",
+		modes:    []Mode{MemMode, TraceMode},
+		check: func() (func() (bool, string), error) {
+			if limit <= 0 {
+				return nil, fmt.Errorf("profile: WhenGCPauseAbove requires a positive limit")
+			}
+			last, buckets, err := readGCPauses()
+			if err != nil {
+				return nil, err
+			}
+			return func() (bool, string) {
+				counts, _, err := readGCPauses()
+				if err != nil {
+					return false, ""
+				}
+				var n uint64
+				var longest float64
+				for i := range counts {
+					if d := counts[i] - last[i]; d > 0 && buckets[i] >= limit.Seconds() {
+						n += d
+						longest = buckets[i]
+					}
+				}
+				last = counts
+				if n == 0 {
+					return false, ""
+				}
+				return true, fmt.Sprintf("%d gc pauses of at least %v, the longest at least %v", n, limit, time.Duration(longest*float64(time.Second)))
+			}, nil
+		},
+		capture: func(w *Watcher) error {
+			if err := w.session(MemMode, 0); err != nil {
+				return err
+			}
+			return w.session(TraceMode, w.trigger.Duration)
+		},
+	}
+}
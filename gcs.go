@@ -0,0 +1,126 @@
+package profile
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// UploadGCS requests that the files written by the session are
+// uploaded to the named Google Cloud Storage bucket, under prefix,
+// when the session stops. See GCSUploader.
+func UploadGCS(bucket, prefix string) Option {
+	return Upload(&GCSUploader{Bucket: bucket, Prefix: prefix})
+}
+
+// GCSUploader is an Uploader which writes files to Google Cloud
+// Storage using the JSON API. By default the access token of the
+// instance's service account is obtained from the metadata server,
+// as is available on GCE, GKE and Cloud Run.
+type GCSUploader struct {
+	// Bucket holds the name of the bucket.
+	Bucket string
+
+	// Prefix is prepended to the name of each uploaded file to
+	// form its object name, for example "profiles/myservice/".
+	Prefix string
+
+	// Token returns the OAuth2 access token used to authorize
+	// uploads. If nil, the token of the default service account
+	// is requested from the metadata server.
+	Token func(ctx context.Context) (string, error)
+
+	// Endpoint holds the base URL of the storage service. If
+	// blank, https://storage.googleapis.com is used.
+	Endpoint string
+
+	// Client holds the HTTP client used to make requests. If
+	// nil, http.DefaultClient is used.
+	Client *http.Client
+}
+
+// Upload implements Uploader.
+func (g *GCSUploader) Upload(ctx context.Context, name string, r io.Reader, size int64) error {
+	client := g.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	token := g.Token
+	if token == nil {
+		token = func(ctx context.Context) (string, error) { return metadataToken(ctx, client) }
+	}
+	tok, err := token(ctx)
+	if err != nil {
+		return fmt.Errorf("gcs: could not obtain access token: %v", err)
+	}
+
+	endpoint := g.Endpoint
+	if endpoint == "" {
+		endpoint = "https://storage.googleapis.com"
+	}
+	object := g.Prefix + name
+	u := strings.TrimRight(endpoint, "/") + "/upload/storage/v1/b/" + url.PathEscape(g.Bucket) +
+		"/o?uploadType=media&name=" + url.QueryEscape(object)
+	req, err := http.NewRequest("POST", u, r)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.ContentLength = size
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("Authorization", "Bearer "+tok)
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("gcs: upload %s/%s: %s: %s", g.Bucket, object, resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+// metadataToken requests an access token for the default service
+// account from the GCE metadata server.
+func metadataToken(ctx context.Context, client *http.Client) (string, error) {
+	req, err := http.NewRequest("GET", "http://"+metadataHost()+"/computeMetadata/v1/instance/service-accounts/default/token", nil)
+	if err != nil {
+		return "", err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Metadata-Flavor", "Google")
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("metadata server: %s", resp.Status)
+	}
+	var tok struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tok); err != nil {
+		return "", err
+	}
+	if tok.AccessToken == "" {
+		return "", fmt.Errorf("metadata server: no access token")
+	}
+	return tok.AccessToken, nil
+}
+
+// metadataHost returns the address of the GCE metadata server, which
+// the GCE_METADATA_HOST environment variable overrides.
+func metadataHost() string {
+	if host := os.Getenv("GCE_METADATA_HOST"); host != "" {
+		return host
+	}
+	return "metadata.google.internal"
+}
@@ -0,0 +1,46 @@
+package profile
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestUploadGCS(t *testing.T) {
+	uploaded := make(map[string]int)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/computeMetadata/v1/instance/service-accounts/default/token":
+			if r.Header.Get("Metadata-Flavor") != "Google" {
+				http.Error(w, "missing Metadata-Flavor", http.StatusForbidden)
+				return
+			}
+			w.Write([]byte(`{"access_token":"secret","expires_in":3599,"token_type":"Bearer"}`))
+		case r.Method == "POST" && r.URL.Path == "/upload/storage/v1/b/profiles/o":
+			if r.Header.Get("Authorization") != "Bearer secret" {
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+			body, _ := ioutil.ReadAll(r.Body)
+			uploaded[r.URL.Query().Get("name")] = len(body)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	t.Setenv("GCE_METADATA_HOST", strings.TrimPrefix(srv.URL, "http://"))
+
+	gcs := &GCSUploader{Bucket: "profiles", Prefix: "svc/", Endpoint: srv.URL}
+	p, err := StartErr(GoroutineProfile, Upload(gcs), ProfilePath(t.TempDir()), Quiet, NoShutdownHook)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if n := uploaded["svc/goroutine.pprof"]; n == 0 {
+		t.Fatalf("goroutine profile was not uploaded, got %v", uploaded)
+	}
+}
@@ -0,0 +1,119 @@
+package profile
+
+import (
+	"encoding/json"
+	"fmt"
+	"runtime"
+	"time"
+)
+
+// DefaultGCTraceInterval is the default interval at which GC activity
+// is sampled by GCTraceProfile.
+const DefaultGCTraceInterval = time.Second
+
+// GCTraceProfile enables GC tracing. Each garbage collection completed
+// during the session is recorded as a line of JSON in the output file,
+// giving the time the collection ended, the stop the world pause it
+// caused, and the state of the heap when the collection was observed.
+// Run a GCTraceProfile session alongside a MemProfile session to
+// correlate GC behaviour with the heap profile.
+// It replaces any previously selected profiling mode.
+func GCTraceProfile(p *Profile) error { return p.setMode(GCTraceMode) }
+
+// GCTraceInterval controls how often GCTraceProfile samples GC
+// activity. The runtime retains the details of the last 256 garbage
+// collections, so collections are only lost if more than 256 occur
+// during an interval. The default is DefaultGCTraceInterval.
+func GCTraceInterval(d time.Duration) Option {
+	return func(p *Profile) error {
+		if d <= 0 {
+			return fmt.Errorf("profile: GC trace interval must be positive")
+		}
+		p.gcTraceInterval = d
+		return nil
+	}
+}
+
+// gcEvent is the record written by GCTraceProfile for each
+// garbage collection.
+type gcEvent struct {
+	NumGC         uint32    `json:"num_gc"`
+	End           time.Time `json:"end"`
+	PauseNs       uint64    `json:"pause_ns"`
+	HeapAlloc     uint64    `json:"heap_alloc"`
+	HeapInuse     uint64    `json:"heap_inuse"`
+	NextGC        uint64    `json:"next_gc"`
+	GCCPUFraction float64   `json:"gc_cpu_fraction"`
+}
+
+func (prof *Profile) startGCTrace() error {
+	w, fn, err := prof.create("gctrace.jsonl")
+	if err != nil {
+		return fmt.Errorf("profile: could not create gc trace %q: %v", fn, err)
+	}
+	interval := prof.gcTraceInterval
+	if interval == 0 {
+		interval = DefaultGCTraceInterval
+	}
+
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	last := ms.NumGC
+
+	enc := json.NewEncoder(w)
+	sample := func() error {
+		runtime.ReadMemStats(&ms)
+		first := last + 1
+		if ms.NumGC-last > uint32(len(ms.PauseNs)) {
+			first = ms.NumGC - uint32(len(ms.PauseNs)) + 1
+		}
+		for n := first; n <= ms.NumGC; n++ {
+			i := (n + uint32(len(ms.PauseNs)) - 1) % uint32(len(ms.PauseNs))
+			err := enc.Encode(gcEvent{
+				NumGC:         n,
+				End:           time.Unix(0, int64(ms.PauseEnd[i])),
+				PauseNs:       ms.PauseNs[i],
+				HeapAlloc:     ms.HeapAlloc,
+				HeapInuse:     ms.HeapInuse,
+				NextGC:        ms.NextGC,
+				GCCPUFraction: ms.GCCPUFraction,
+			})
+			if err != nil {
+				return err
+			}
+		}
+		last = ms.NumGC
+		return nil
+	}
+
+	quit := make(chan struct{})
+	done := make(chan error, 1)
+	go func() {
+		t := time.NewTicker(interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-t.C:
+				if err := sample(); err != nil {
+					done <- err
+					return
+				}
+			case <-quit:
+				done <- sample()
+				return
+			}
+		}
+	}()
+
+	prof.logAttrs("profile: gc tracing enabled", "path", fn)
+	prof.closer = func() error {
+		close(quit)
+		err := <-done
+		if cerr := w.Close(); err == nil {
+			err = cerr
+		}
+		prof.logAttrs("profile: gc tracing disabled", "path", fn)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+package profile
+
+import (
+	"bytes"
+	"encoding/json"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestGCTrace(t *testing.T) {
+	var buf bytes.Buffer
+	p, err := StartErr(GCTraceProfile, GCTraceInterval(time.Millisecond), WriteTo(&buf), Quiet, NoShutdownHook)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		runtime.GC()
+		time.Sleep(5 * time.Millisecond)
+	}
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var events []gcEvent
+	dec := json.NewDecoder(&buf)
+	for dec.More() {
+		var ev gcEvent
+		if err := dec.Decode(&ev); err != nil {
+			t.Fatal(err)
+		}
+		events = append(events, ev)
+	}
+	if len(events) < 3 {
+		t.Fatalf("got %d events, want at least 3", len(events))
+	}
+	for i := 1; i < len(events); i++ {
+		if events[i].NumGC != events[i-1].NumGC+1 {
+			t.Fatalf("events not consecutive: %d followed by %d", events[i-1].NumGC, events[i].NumGC)
+		}
+	}
+}
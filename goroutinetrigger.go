@@ -0,0 +1,37 @@
+package profile
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// WhenGoroutinesAbove returns a Trigger which writes the stacks of
+// every goroutine, in the format of GoroutineProfileFullStacks, when
+// the number of goroutines exceeds n. A growing number of goroutines
+// is the most common sign of a goroutine leak. While the number stays
+// above n the stacks are written no more often than the trigger's
+// Cooldown.
+func WhenGoroutinesAbove(n int) Trigger {
+	return Trigger{
+		Interval: DefaultTriggerInterval,
+		Cooldown: DefaultTriggerCooldown,
+		Duration: DefaultTriggerDuration,
+		name:     "goroutinesabove",
+		modes:    []Mode{GoroutineMode},
+		options:  []Option{GoroutineProfileFullStacks},
+		check: func() (func() (bool, string), error) {
+			if n < 1 {
+				return nil, fmt.Errorf("profile: WhenGoroutinesAbove requires a positive number of goroutines")
+			}
+			return func() (bool, string) {
+				if g := runtime.NumGoroutine(); g > n {
+					return true, fmt.Sprintf("%d goroutines above %d", g, n)
+				}
+				return false, ""
+			}, nil
+		},
+		capture: func(w *Watcher) error {
+			return w.session(GoroutineMode, 0)
+		},
+	}
+}
@@ -0,0 +1,141 @@
+package profile
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+	"runtime/pprof"
+	"strconv"
+	"time"
+)
+
+// Handler returns an http.Handler which lets profiling sessions be
+// controlled remotely. Each session is started with the given options,
+// followed by those from the request. The handler serves the
+// following paths, matched on the last element of the request path so
+// that it may be mounted under any prefix, for example
+// /debug/profile/:
+//
+//	POST start?mode=cpu&seconds=30  start a session, see ParseMode and Duration
+//	POST stop                       stop the running session
+//	GET  snapshot?name=heap&debug=0 write the named pprof.Lookup profile in the response
+//	GET  status                     describe the current or last session
+//
+// At most one session started by the handler runs at a time. The
+// start, stop and status endpoints respond with the JSON status
+// of the session.
+func Handler(options ...Option) http.Handler {
+	return &handler{c: controller{options: options}}
+}
+
+type handler struct {
+	c controller
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch path.Base(r.URL.Path) {
+	case "start":
+		if !requireMethod(w, r, "POST") {
+			return
+		}
+		h.start(w, r)
+	case "stop":
+		if !requireMethod(w, r, "POST") {
+			return
+		}
+		st, err := h.c.stop()
+		writeStatus(w, st, err)
+	case "snapshot":
+		if !requireMethod(w, r, "GET") {
+			return
+		}
+		snapshot(w, r)
+	case "status":
+		if !requireMethod(w, r, "GET") {
+			return
+		}
+		writeStatus(w, h.c.status(), nil)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func requireMethod(w http.ResponseWriter, r *http.Request, method string) bool {
+	if r.Method != method {
+		w.Header().Set("Allow", method)
+		http.Error(w, fmt.Sprintf("%s requires %s", r.URL.Path, method), http.StatusMethodNotAllowed)
+		return false
+	}
+	return true
+}
+
+func (h *handler) start(w http.ResponseWriter, r *http.Request) {
+	var mode *Mode
+	if s := r.FormValue("mode"); s != "" {
+		m, err := ParseMode(s)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		mode = &m
+	}
+	var d time.Duration
+	if s := r.FormValue("seconds"); s != "" {
+		seconds, err := strconv.ParseFloat(s, 64)
+		if err != nil || seconds <= 0 {
+			http.Error(w, fmt.Sprintf("profile: invalid seconds %q", s), http.StatusBadRequest)
+			return
+		}
+		d = time.Duration(seconds * float64(time.Second))
+	}
+	st, err := h.c.start(mode, d)
+	writeStatus(w, st, err)
+}
+
+// writeStatus writes the status returned by a controller, or its error.
+func writeStatus(w http.ResponseWriter, st sessionStatus, err error) {
+	switch err {
+	case nil:
+	case errRunning, errNotRunning:
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	default:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(st)
+}
+
+// snapshot writes the profile named by the request, in the format
+// selected by its debug parameter, to w.
+func snapshot(w http.ResponseWriter, r *http.Request) {
+	name := r.FormValue("name")
+	if name == "" {
+		name = "heap"
+	}
+	if !validSnapshotName(name) {
+		http.Error(w, fmt.Sprintf("profile: invalid profile name %q", name), http.StatusBadRequest)
+		return
+	}
+	serveLookup(w, r, name)
+}
+
+// serveLookup writes the named pprof.Lookup profile, in the format
+// selected by the request's debug parameter, to w.
+func serveLookup(w http.ResponseWriter, r *http.Request, name string) {
+	lp := pprof.Lookup(name)
+	if lp == nil {
+		http.Error(w, fmt.Sprintf("profile: unknown profile %q", name), http.StatusNotFound)
+		return
+	}
+	debug, _ := strconv.Atoi(r.FormValue("debug"))
+	if debug > 0 {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	} else {
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name+".pprof"))
+	}
+	lp.WriteTo(w, debug)
+}
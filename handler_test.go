@@ -0,0 +1,76 @@
+package profile
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+func TestHandler(t *testing.T) {
+	dir := t.TempDir()
+	srv := httptest.NewServer(Handler(ProfilePath(dir), Quiet, NoShutdownHook))
+	defer srv.Close()
+
+	do := func(method, path string, want int) sessionStatus {
+		t.Helper()
+		req, err := http.NewRequest(method, srv.URL+"/debug/profile/"+path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, _ := ioutil.ReadAll(resp.Body)
+		if resp.StatusCode != want {
+			t.Fatalf("%s %s: got status %d, want %d: %s", method, path, resp.StatusCode, want, body)
+		}
+		var st sessionStatus
+		if want == http.StatusOK {
+			if err := json.Unmarshal(body, &st); err != nil {
+				t.Fatalf("%s %s: %v", method, path, err)
+			}
+		}
+		return st
+	}
+
+	if st := do("GET", "status", http.StatusOK); st.Running || st.Mode != nil {
+		t.Fatalf("got initial status %+v", st)
+	}
+	do("GET", "start", http.StatusMethodNotAllowed)
+	do("POST", "stop", http.StatusConflict)
+	do("POST", "start?mode=bogus", http.StatusBadRequest)
+	do("POST", "start?seconds=-1", http.StatusBadRequest)
+
+	if st := do("POST", "start?mode=goroutine", http.StatusOK); !st.Running || *st.Mode != GoroutineMode {
+		t.Fatalf("got status %+v after start", st)
+	}
+	do("POST", "start?mode=goroutine", http.StatusConflict)
+	st := do("POST", "stop", http.StatusOK)
+	if want := filepath.Join(dir, "goroutine.pprof"); st.Running || len(st.Files) != 1 || st.Files[0] != want {
+		t.Fatalf("got status %+v after stop, want files [%s]", st, want)
+	}
+	if st := do("GET", "status", http.StatusOK); st.Running || *st.Mode != GoroutineMode {
+		t.Fatalf("got status %+v after stop", st)
+	}
+
+	resp, err := http.Get(srv.URL + "/debug/profile/snapshot?name=goroutine")
+	if err != nil {
+		t.Fatal(err)
+	}
+	buf, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := parseProto(buf); err != nil {
+		t.Fatalf("snapshot: %v", err)
+	}
+	do("GET", "snapshot?name=bogus", http.StatusNotFound)
+	do("GET", "snapshot?name=..%2Fheap", http.StatusBadRequest)
+	do("GET", "bogus", http.StatusNotFound)
+}
@@ -0,0 +1,76 @@
+package profile
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"runtime/debug"
+)
+
+// HeapDumpProfile enables heap dumps. A full dump of the heap, in the
+// format described by https://golang.org/s/go15heapdump, is written
+// when the session stops. Unlike a memory profile, which records a
+// sample of allocation stacks, a heap dump contains every object on
+// the heap, so the file will be at least as large as the heap and
+// writing it stops the world for the duration.
+// It replaces any previously selected profiling mode.
+func HeapDumpProfile(p *Profile) error { return p.setMode(HeapDumpMode) }
+
+// HeapDumpSignal requests an additional heap dump each time one of
+// the given signals is received while a HeapDumpProfile session is
+// running. Each dump is written to a numbered file alongside the
+// dump written when the session stops.
+func HeapDumpSignal(sig ...os.Signal) Option {
+	return func(p *Profile) error {
+		if len(sig) == 0 {
+			return fmt.Errorf("profile: HeapDumpSignal requires at least one signal")
+		}
+		p.heapDumpSignals = sig
+		return nil
+	}
+}
+
+func (prof *Profile) startHeapDump() error {
+	if prof.inMemory() {
+		return fmt.Errorf("profile: heap dumps cannot be written with WriteTo or CaptureInMemory")
+	}
+	w, fn, err := prof.create("heap.dump")
+	if err != nil {
+		return fmt.Errorf("profile: could not create heap dump %q: %v", fn, err)
+	}
+	f := w.(*outputFile)
+
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	prof.logAttrs("profile: heap dump enabled", "path", fn)
+	prof.logf("profile: warning: heap dumps are at least as large as the heap, currently %d MB", ms.HeapSys>>20)
+
+	stop := dumpOnSignal(prof.heapDumpSignals, func(n int) {
+		dn := numberedFilename(fn, n)
+		if err := prof.writeHeapDump(dn); err != nil {
+			prof.logAttrs(fmt.Sprintf("profile: could not write heap dump %q", dn), "error", err)
+			return
+		}
+		prof.addFile(dn)
+		prof.logAttrs("profile: heap dump written", "path", dn)
+	})
+
+	prof.closer = func() error {
+		stop()
+		debug.WriteHeapDump(f.Fd())
+		err := f.Close()
+		prof.logAttrs("profile: heap dump disabled", "path", fn)
+		return err
+	}
+	return nil
+}
+
+// writeHeapDump writes a heap dump to a new file named fn.
+func (prof *Profile) writeHeapDump(fn string) error {
+	f, err := prof.createFile(fn)
+	if err != nil {
+		return err
+	}
+	debug.WriteHeapDump(f.Fd())
+	return f.Close()
+}
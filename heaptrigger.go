@@ -0,0 +1,45 @@
+package profile
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// WhenHeapAbove returns a Trigger which writes a memory profile when
+// the bytes allocated to heap objects, as reported by
+// runtime.MemStats.HeapAlloc, rise above the given number of bytes.
+// The trigger fires again only once the heap has fallen below the
+// threshold and risen above it again, and no more often than the
+// trigger's Cooldown. Pass MemProfileHeapAndAllocs, or another memory
+// profiling option, to Watch to choose the profiles written.
+func WhenHeapAbove(bytes uint64) Trigger {
+	return Trigger{
+		Interval: DefaultTriggerInterval,
+		Cooldown: DefaultTriggerCooldown,
+		Duration: DefaultTriggerDuration,
+		name:     "heapabove",
+		modes:    []Mode{MemMode},
+		check: func() (func() (bool, string), error) {
+			if bytes == 0 {
+				return nil, fmt.Errorf("profile: WhenHeapAbove requires a positive number of bytes")
+			}
+			armed := true
+			return func() (bool, string) {
+				var ms runtime.MemStats
+				runtime.ReadMemStats(&ms)
+				if ms.HeapAlloc <= bytes {
+					armed = true
+					return false, ""
+				}
+				if !armed {
+					return false, ""
+				}
+				armed = false
+				return true, fmt.Sprintf("heap of %d bytes above %d", ms.HeapAlloc, bytes)
+			}, nil
+		},
+		capture: func(w *Watcher) error {
+			return w.session(MemMode, 0)
+		},
+	}
+}
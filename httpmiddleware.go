@@ -0,0 +1,235 @@
+package profile
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/rand"
+	"net/http"
+	"runtime/pprof"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// MiddlewareOptions configure the handler returned by HTTPMiddleware.
+type MiddlewareOptions struct {
+	// Handler holds the value of the handler label, for example
+	// the name of the service. If empty, the label is omitted.
+	Handler string
+
+	// Route returns the value of the route label for r. If nil,
+	// the request's path is used; servers with paths containing
+	// identifiers should give the pattern which matched instead,
+	// to keep the number of distinct labels small.
+	Route func(r *http.Request) string
+
+	// SampleRate holds the fraction of requests, between 0 and 1,
+	// for which a cpu profile is captured. If zero, no profiles
+	// are captured.
+	SampleRate float64
+
+	// Options hold the options for the sessions capturing cpu
+	// profiles, for example ProfilePath.
+	Options []Option
+}
+
+// HTTPMiddleware returns an http.Handler which calls next with pprof
+// labels attached to the goroutine serving each request, so that its
+// samples can be attributed to the handler and route, for example with
+// pprof's -tagfocus flag. Once the response status is written, a
+// status label is added to the samples which follow.
+//
+// If opts.SampleRate is positive, a cpu profile covering the request
+// is captured for that fraction of requests, by a session started with
+// opts.Options, CPUProfile and Timestamp. The profile covers the whole
+// process while the request is served; use its labels to focus on the
+// request. The names of the files written include http, for example
+// cpu-http-20060102T150405Z.pprof. A request is not profiled if
+// another cpu profile is being captured, or if one was captured less
+// than a second ago, so that each is written to its own file. The
+// sessions do not install the shutdown hook, and are Quiet unless
+// opts.Options give another Verbosity. Profiles are written to the
+// directory of the first session, unless opts.Options give one, and
+// are finished after the response is written, so that writing them
+// does not delay it.
+func HTTPMiddleware(next http.Handler, opts MiddlewareOptions) http.Handler {
+	return &middleware{next: next, opts: opts, sampler: sampler{name: "http", rate: opts.SampleRate, options: opts.Options}}
+}
+
+type middleware struct {
+	next    http.Handler
+	opts    MiddlewareOptions
+	sampler sampler
+}
+
+func (m *middleware) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var kv []string
+	if m.opts.Handler != "" {
+		kv = append(kv, "handler", m.opts.Handler)
+	}
+	route := r.URL.Path
+	if m.opts.Route != nil {
+		route = m.opts.Route(r)
+	}
+	kv = append(kv, "route", route)
+
+	if p := m.sampler.sample(); p != nil {
+		defer m.sampler.finish(p)
+	}
+	pprof.Do(r.Context(), pprof.Labels(kv...), func(ctx context.Context) {
+		m.next.ServeHTTP(wrapWriter(&statusWriter{ResponseWriter: w, ctx: ctx}), r.WithContext(ctx))
+	})
+}
+
+// sampler starts sessions capturing cpu profiles of a fraction of the
+// requests served, see HTTPMiddleware and RPCProfiler.
+type sampler struct {
+	// name is added to the names of the files written.
+	name    string
+	rate    float64
+	options []Option
+
+	mu   sync.Mutex
+	last time.Time
+	// dir holds the directory created by the first session, if
+	// the options do not give one.
+	dir string
+
+	// wg counts the sessions being finished.
+	wg sync.WaitGroup
+}
+
+// sample starts a session capturing a cpu profile if the request has
+// been chosen to be profiled, returning nil otherwise.
+func (s *sampler) sample() *Profile {
+	if s.rate <= 0 || rand.Float64() >= s.rate {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if time.Since(s.last) < time.Second || profiling(CPUMode) {
+		return nil
+	}
+	options := append([]Option{Quiet}, s.options...)
+	options = append(options, CPUProfile, NoShutdownHook, func(p *Profile) error {
+		p.trigger, p.timestamp = s.name, true
+		if s.dir != "" && p.path == "" && !p.inMemory() {
+			p.path, p.tempParent, p.tempPattern = s.dir, "", ""
+		}
+		return nil
+	})
+	p, err := New(options...)
+	if err != nil {
+		log.Printf("profile: could not profile %s request: %v", s.name, err)
+		return nil
+	}
+	if err := p.Begin(); err != nil {
+		p.logAttrs(fmt.Sprintf("profile: could not profile %s request", s.name), "error", err)
+		return nil
+	}
+	if s.dir == "" && p.path == "" && !p.runDir {
+		s.dir = p.dir
+	}
+	s.last = time.Now()
+	return p
+}
+
+// finish stops a session started by sample without waiting for its
+// profile to be written.
+func (s *sampler) finish(p *Profile) {
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		p.Stop()
+	}()
+}
+
+// profiling reports whether a session of the given mode is running.
+func profiling(mode Mode) bool {
+	mu.Lock()
+	defer mu.Unlock()
+	_, ok := active[mode.String()]
+	return ok
+}
+
+// statusWriter adds a status label to the goroutine serving a request
+// once its status is written. See wrapWriter for the optional
+// interfaces of the underlying ResponseWriter.
+type statusWriter struct {
+	http.ResponseWriter
+	ctx   context.Context
+	wrote bool
+}
+
+func (w *statusWriter) WriteHeader(code int) {
+	if !w.wrote {
+		w.wrote = true
+		pprof.SetGoroutineLabels(pprof.WithLabels(w.ctx, pprof.Labels("status", strconv.Itoa(code))))
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	if !w.wrote {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Unwrap returns the underlying ResponseWriter, for
+// http.ResponseController.
+func (w *statusWriter) Unwrap() http.ResponseWriter { return w.ResponseWriter }
+
+// wrapWriter returns w implementing those of http.Flusher,
+// http.Hijacker and http.Pusher which its underlying ResponseWriter
+// implements, and no others, so that handlers can detect them as if
+// they were not wrapped.
+func wrapWriter(w *statusWriter) http.ResponseWriter {
+	f, isFlusher := w.ResponseWriter.(http.Flusher)
+	h, isHijacker := w.ResponseWriter.(http.Hijacker)
+	p, isPusher := w.ResponseWriter.(http.Pusher)
+	switch {
+	case isFlusher && isHijacker && isPusher:
+		return struct {
+			*statusWriter
+			http.Flusher
+			http.Hijacker
+			http.Pusher
+		}{w, f, h, p}
+	case isFlusher && isHijacker:
+		return struct {
+			*statusWriter
+			http.Flusher
+			http.Hijacker
+		}{w, f, h}
+	case isFlusher && isPusher:
+		return struct {
+			*statusWriter
+			http.Flusher
+			http.Pusher
+		}{w, f, p}
+	case isHijacker && isPusher:
+		return struct {
+			*statusWriter
+			http.Hijacker
+			http.Pusher
+		}{w, h, p}
+	case isFlusher:
+		return struct {
+			*statusWriter
+			http.Flusher
+		}{w, f}
+	case isHijacker:
+		return struct {
+			*statusWriter
+			http.Hijacker
+		}{w, h}
+	case isPusher:
+		return struct {
+			*statusWriter
+			http.Pusher
+		}{w, p}
+	}
+	return w
+}
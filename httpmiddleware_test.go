@@ -0,0 +1,110 @@
+package profile
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime/pprof"
+	"testing"
+	"time"
+)
+
+func TestHTTPMiddleware(t *testing.T) {
+	dir := t.TempDir()
+	var handler, route string
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handler, _ = pprof.Label(r.Context(), "handler")
+		route, _ = pprof.Label(r.Context(), "route")
+		w.WriteHeader(http.StatusTeapot)
+	})
+	h := HTTPMiddleware(next, MiddlewareOptions{
+		Handler:    "api",
+		SampleRate: 1,
+		Options:    []Option{ProfilePath(dir), Quiet, NoShutdownHook},
+	})
+
+	for i := 0; i < 2; i++ {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", "/users", nil))
+		if w.Code != http.StatusTeapot {
+			t.Errorf("got status %d, want %d", w.Code, http.StatusTeapot)
+		}
+	}
+	h.(*middleware).sampler.wg.Wait()
+	if handler != "api" || route != "/users" {
+		t.Errorf("got labels handler=%q route=%q, want api and /users", handler, route)
+	}
+
+	// the second request follows too soon after the first to be profiled.
+	files, err := filepath.Glob(filepath.Join(dir, "cpu-http-*.pprof"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 {
+		t.Errorf("got files %q, want one cpu profile", files)
+	}
+}
+
+func TestHTTPMiddlewareHijack(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h, ok := w.(http.Hijacker)
+		if !ok {
+			t.Error("ResponseWriter does not implement http.Hijacker")
+			return
+		}
+		conn, rw, err := h.Hijack()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+		rw.WriteString("HTTP/1.1 101 Switching Protocols\r\nConnection: close\r\n\r\n")
+		rw.Flush()
+	})
+	srv := httptest.NewServer(HTTPMiddleware(next, MiddlewareOptions{}))
+	defer srv.Close()
+	resp, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Errorf("got status %d, want %d", resp.StatusCode, http.StatusSwitchingProtocols)
+	}
+
+	// httptest.ResponseRecorder is a Flusher, but neither a Hijacker
+	// nor a Pusher.
+	w := wrapWriter(&statusWriter{ResponseWriter: httptest.NewRecorder()})
+	if _, ok := w.(http.Flusher); !ok {
+		t.Error("ResponseWriter does not implement http.Flusher")
+	}
+	if _, ok := w.(http.Hijacker); ok {
+		t.Error("ResponseWriter implements http.Hijacker")
+	}
+	if _, ok := w.(http.Pusher); ok {
+		t.Error("ResponseWriter implements http.Pusher")
+	}
+}
+
+func TestSampler(t *testing.T) {
+	s := &sampler{name: "http", rate: 1}
+	var dirs []string
+	for i := 0; i < 2; i++ {
+		p := s.sample()
+		if p == nil {
+			t.Fatal("request was not sampled")
+		}
+		if !p.noShutdownHook || !p.quiet {
+			t.Errorf("got noShutdownHook %v, quiet %v, want both", p.noShutdownHook, p.quiet)
+		}
+		dirs = append(dirs, p.Dir())
+		s.finish(p)
+		s.wg.Wait()
+		s.last = time.Time{}
+	}
+	defer os.RemoveAll(dirs[0])
+	if dirs[0] != dirs[1] {
+		t.Errorf("got directories %q, want one directory for every session", dirs)
+	}
+}
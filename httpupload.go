@@ -0,0 +1,76 @@
+package profile
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// UploadHTTP requests that each file written by the session is sent
+// to url in the body of a POST request when the session stops. The
+// given headers, for example an Authorization header, are added to
+// each request. See HTTPUploader.
+func UploadHTTP(url string, headers http.Header) Option {
+	return Upload(&HTTPUploader{URL: url, Header: headers})
+}
+
+// HTTPUploader is an Uploader which sends each file to a collector
+// service as the body of a POST request. The name of the file is
+// given by the X-Profile-Name request header, and the profiling mode
+// of the session which wrote it, and the host and process id of the
+// program, by the X-Profile-Mode, X-Profile-Host and X-Profile-Pid
+// headers.
+type HTTPUploader struct {
+	// URL holds the address files are sent to.
+	URL string
+
+	// Header holds additional headers sent with each request.
+	Header http.Header
+
+	// Client holds the HTTP client used to make requests. If
+	// nil, http.DefaultClient is used.
+	Client *http.Client
+}
+
+// Upload implements Uploader.
+func (h *HTTPUploader) Upload(ctx context.Context, name string, r io.Reader, size int64) error {
+	req, err := http.NewRequest("POST", h.URL, r)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.ContentLength = size
+	for k, vs := range h.Header {
+		for _, v := range vs {
+			req.Header.Add(k, v)
+		}
+	}
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("X-Profile-Name", name)
+	if mode, ok := uploadMode(ctx); ok {
+		req.Header.Set("X-Profile-Mode", mode.String())
+	}
+	if host, err := os.Hostname(); err == nil {
+		req.Header.Set("X-Profile-Host", host)
+	}
+	req.Header.Set("X-Profile-Pid", strconv.Itoa(os.Getpid()))
+	client := h.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("http: post %s: %s: %s", name, resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package profile
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestUploadHTTP(t *testing.T) {
+	uploaded := make(map[string]int)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		host, _ := os.Hostname()
+		if r.Header.Get("X-Profile-Mode") != "goroutine" || r.Header.Get("X-Profile-Host") != host || r.Header.Get("X-Profile-Pid") != strconv.Itoa(os.Getpid()) {
+			http.Error(w, fmt.Sprintf("missing metadata headers: %v", r.Header), http.StatusBadRequest)
+			return
+		}
+		body, _ := ioutil.ReadAll(r.Body)
+		uploaded[r.Header.Get("X-Profile-Name")] = len(body)
+	}))
+	defer srv.Close()
+
+	header := http.Header{"Authorization": {"Bearer secret"}}
+	p, err := StartErr(GoroutineProfile, UploadHTTP(srv.URL, header), ProfilePath(t.TempDir()), Quiet, NoShutdownHook)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if n := uploaded["goroutine.pprof"]; n == 0 {
+		t.Fatalf("goroutine profile was not uploaded, got %v", uploaded)
+	}
+}
+
+func TestUploadTimeout(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	p, err := StartErr(GoroutineProfile, UploadHTTP(srv.URL, nil), UploadTimeout(10*time.Millisecond), ProfilePath(t.TempDir()), Quiet, NoShutdownHook)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = p.Close()
+	if err == nil || !strings.Contains(err.Error(), "could not upload") {
+		t.Fatalf("expected upload to time out, got %v", err)
+	}
+}
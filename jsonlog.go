@@ -0,0 +1,91 @@
+package profile
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+)
+
+// JSONEvents writes the session's messages to w as single line JSON
+// events, in place of the standard logger, for programs which parse
+// the output of the profiled program. For example:
+//
+//	{"event":"profile_start","mode":"cpu","file":"/tmp/profile123/cpu.pprof","time":"..."}
+//
+// The event field is profile_start or profile_stop when profiling
+// starts or stops, snapshot when a snapshot is written, file when
+// another file, such as a manifest, is written, error when something
+// fails, and message for other messages, whose text is held by the msg
+// field. JSONEvents replaces an earlier WithSlog. Quiet suppresses the
+// events.
+func JSONEvents(w io.Writer) Option {
+	return func(p *Profile) error {
+		if w == nil {
+			return fmt.Errorf("profile: JSONEvents requires a writer")
+		}
+		var mu sync.Mutex
+		enc := json.NewEncoder(w)
+		p.logger = func(msg string, attrs ...interface{}) {
+			ev := newJSONEvent(msg, attrs)
+			mu.Lock()
+			defer mu.Unlock()
+			enc.Encode(ev)
+		}
+		return nil
+	}
+}
+
+// jsonEvent is the form of the events written by JSONEvents.
+type jsonEvent struct {
+	Event string    `json:"event"`
+	Mode  Mode      `json:"mode"`
+	Name  string    `json:"name,omitempty"`
+	File  string    `json:"file,omitempty"`
+	Files []string  `json:"files,omitempty"`
+	Rate  int       `json:"rate,omitempty"`
+	Error string    `json:"error,omitempty"`
+	Msg   string    `json:"msg,omitempty"`
+	Time  time.Time `json:"time"`
+}
+
+// newJSONEvent returns the event for a message logged by logAttrs.
+func newJSONEvent(msg string, attrs []interface{}) jsonEvent {
+	ev := jsonEvent{Time: time.Now().UTC()}
+	for i := 0; i+1 < len(attrs); i += 2 {
+		v := attrs[i+1]
+		switch attrs[i] {
+		case "mode":
+			ev.Mode, _ = v.(Mode)
+		case "name":
+			ev.Name, _ = v.(string)
+		case "path":
+			if files, ok := v.([]string); ok {
+				ev.Files = files
+			} else {
+				ev.File = fmt.Sprint(v)
+			}
+		case "rate":
+			ev.Rate, _ = v.(int)
+		case "error":
+			ev.Error = fmt.Sprint(v)
+		}
+	}
+	switch {
+	case ev.Error != "":
+		ev.Event, ev.Msg = "error", msg
+	case strings.HasSuffix(msg, " enabled"):
+		ev.Event = "profile_start"
+	case strings.HasSuffix(msg, " disabled"):
+		ev.Event = "profile_stop"
+	case strings.HasSuffix(msg, " snapshot written"):
+		ev.Event = "snapshot"
+	case strings.HasSuffix(msg, " written"):
+		ev.Event = "file"
+	default:
+		ev.Event, ev.Msg = "message", msg
+	}
+	return ev
+}
@@ -0,0 +1,69 @@
+package profile
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestJSONEvents(t *testing.T) {
+	dir := t.TempDir()
+	var buf bytes.Buffer
+	p, err := StartErr(CPUProfile, JSONEvents(&buf), ProfilePath(dir), NoShutdownHook)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Stop()
+
+	fn := filepath.Join(dir, "cpu.pprof")
+	want := []jsonEvent{
+		{Event: "profile_start", Mode: CPUMode, File: fn},
+		{Event: "profile_stop", Mode: CPUMode, File: fn},
+	}
+	dec := json.NewDecoder(&buf)
+	for _, w := range want {
+		var got jsonEvent
+		if err := dec.Decode(&got); err != nil {
+			t.Fatal(err)
+		}
+		if got.Time.IsZero() {
+			t.Errorf("event %+v has no time", got)
+		}
+		if got.Event != w.Event || got.Mode != w.Mode || got.File != w.File || got.Msg != "" {
+			t.Errorf("got event %+v, want %+v", got, w)
+		}
+	}
+	if dec.More() {
+		t.Errorf("unexpected events after %+v", want)
+	}
+}
+
+func TestNewJSONEvent(t *testing.T) {
+	tests := []struct {
+		msg   string
+		attrs []interface{}
+		want  jsonEvent
+	}{
+		{"heap snapshot written", []interface{}{"mode", MemMode, "name", "heap", "path", "heap.pprof"},
+			jsonEvent{Event: "snapshot", Mode: MemMode, Name: "heap", File: "heap.pprof"}},
+		{"memory profiling enabled", []interface{}{"mode", MemMode, "rate", 4096, "path", []string{"heap.pprof", "allocs.pprof"}},
+			jsonEvent{Event: "profile_start", Mode: MemMode, Rate: 4096, Files: []string{"heap.pprof", "allocs.pprof"}}},
+		{"manifest written", []interface{}{"mode", CPUMode, "path", "manifest.json"},
+			jsonEvent{Event: "file", Mode: CPUMode, File: "manifest.json"}},
+		{"could not write cpu profile", []interface{}{"mode", CPUMode, "error", errors.New("disk full")},
+			jsonEvent{Event: "error", Mode: CPUMode, Error: "disk full", Msg: "could not write cpu profile"}},
+		{"cpu profiling paused", []interface{}{"mode", CPUMode},
+			jsonEvent{Event: "message", Mode: CPUMode, Msg: "cpu profiling paused"}},
+	}
+	for _, tt := range tests {
+		got := newJSONEvent(tt.msg, tt.attrs)
+		got.Time = tt.want.Time
+		gotJSON, _ := json.Marshal(got)
+		wantJSON, _ := json.Marshal(tt.want)
+		if !bytes.Equal(gotJSON, wantJSON) {
+			t.Errorf("%s: got %s, want %s", tt.msg, gotJSON, wantJSON)
+		}
+	}
+}
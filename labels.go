@@ -0,0 +1,42 @@
+package profile
+
+import (
+	"context"
+	"fmt"
+	"runtime/pprof"
+)
+
+// WithLabels attaches pprof labels, given as alternating keys and
+// values, to the samples recorded by the session so that profiles
+// from different jobs or tenants can be told apart, for example
+// with pprof's -tagfocus flag. The labels are applied to the
+// goroutine which starts the session, replacing any labels it
+// already has, and are inherited by the goroutines it goes on to
+// create. Use Profile.Do to label work on other goroutines.
+func WithLabels(kv ...string) Option {
+	return func(p *Profile) error {
+		if len(kv)%2 != 0 {
+			return fmt.Errorf("profile: WithLabels requires an even number of arguments")
+		}
+		p.labels = append(p.labels, kv...)
+		return nil
+	}
+}
+
+// Do calls f with a copy of ctx carrying the session's labels, as
+// set by WithLabels, applying them to the current goroutine for the
+// duration of the call. See pprof.Do.
+func (p *Profile) Do(ctx context.Context, f func(context.Context)) {
+	if len(p.labels) == 0 {
+		f(ctx)
+		return
+	}
+	pprof.Do(ctx, pprof.Labels(p.labels...), f)
+}
+
+// setLabels applies the session's labels to the calling goroutine.
+func (p *Profile) setLabels() {
+	if len(p.labels) > 0 {
+		pprof.SetGoroutineLabels(pprof.WithLabels(context.Background(), pprof.Labels(p.labels...)))
+	}
+}
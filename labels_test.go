@@ -0,0 +1,59 @@
+package profile
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+)
+
+// labelValues returns the values of the string label key found in
+// the samples of the cpu profile buf.
+func labelValues(t *testing.T, buf []byte, key string) map[string]bool {
+	t.Helper()
+	prof, err := parseProto(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	values := make(map[string]bool)
+	for _, s := range prof.sample {
+		for _, l := range s.label {
+			if prof.stringTable[l.key] == key {
+				values[prof.stringTable[l.str]] = true
+			}
+		}
+	}
+	return values
+}
+
+func spin(d time.Duration) {
+	for end := time.Now().Add(d); time.Now().Before(end); {
+	}
+}
+
+func TestWithLabels(t *testing.T) {
+	var buf bytes.Buffer
+	p, err := StartErr(CPUProfile, WithLabels("job", "start"), WriteTo(&buf), Quiet, NoShutdownHook)
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		p.Do(context.Background(), func(context.Context) { spin(200 * time.Millisecond) })
+	}()
+	spin(200 * time.Millisecond)
+	<-done
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if values := labelValues(t, buf.Bytes(), "job"); !values["start"] {
+		t.Fatalf("no samples labelled job=start, got %v", values)
+	}
+}
+
+func TestWithLabelsOdd(t *testing.T) {
+	if _, err := New(CPUProfile, WithLabels("job")); err == nil {
+		t.Fatal("expected error with an odd number of label arguments")
+	}
+}
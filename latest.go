@@ -0,0 +1,58 @@
+package profile
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// LatestSymlink maintains a symbolic link to the newest of each kind
+// of file written to the profile directory, so that the latest
+// profile can always be found at the same path, for example
+//
+//	go tool pprof cpu-latest.pprof
+//
+// The link is named after the file, with the timestamp added by
+// Timestamp or the {ts} placeholder replaced by "latest", or with
+// "-latest" added before its extension. The links are updated when
+// the session stops.
+func LatestSymlink(p *Profile) error {
+	p.latestSymlink = true
+	return nil
+}
+
+// latestName returns the name of the link to the file fn.
+func (p *Profile) latestName(fn string) string {
+	base := filepath.Base(fn)
+	if ts := p.started.UTC().Format(timestampLayout); strings.Contains(base, ts) {
+		base = strings.Replace(base, ts, "latest", -1)
+	} else {
+		ext := filepath.Ext(base)
+		base = strings.TrimSuffix(base, ext) + "-latest" + ext
+	}
+	return filepath.Join(filepath.Dir(fn), base)
+}
+
+// updateSymlinks points the latest links at the session's files.
+func (p *Profile) updateSymlinks() error {
+	var err error
+	for _, fn := range p.Files() {
+		link := p.latestName(fn)
+		tmp := link + ".tmp"
+		os.Remove(tmp)
+		lerr := os.Symlink(filepath.Base(fn), tmp)
+		if lerr == nil {
+			lerr = os.Rename(tmp, link)
+		}
+		if lerr != nil {
+			os.Remove(tmp)
+			if err == nil {
+				err = fmt.Errorf("profile: could not link %s: %v", link, lerr)
+			}
+			continue
+		}
+		p.logf("profile: linked %s", link)
+	}
+	return err
+}
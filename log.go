@@ -0,0 +1,108 @@
+package profile
+
+import (
+	"fmt"
+	"log"
+	"strings"
+)
+
+// A LogLevel selects which messages a session logs, see Verbosity.
+type LogLevel int
+
+// Log levels, from the fewest messages to the most.
+const (
+	// LogSilent logs nothing, like Quiet.
+	LogSilent LogLevel = -2
+
+	// LogErrors logs only failures, such as a profile which could
+	// not be written.
+	LogErrors LogLevel = -1
+
+	// LogInfo, the default, also logs when profiling starts and
+	// stops and when files are written.
+	LogInfo LogLevel = 0
+
+	// LogDebug also logs details of the session's progress.
+	LogDebug LogLevel = 1
+)
+
+// Verbosity selects which messages the session logs. Unlike Quiet,
+// which is the same as Verbosity(LogSilent), Verbosity(LogErrors)
+// still reports failures to write profiles. Verbosity replaces an
+// earlier Quiet.
+func Verbosity(level LogLevel) Option {
+	return func(p *Profile) error {
+		if level < LogSilent || level > LogDebug {
+			return fmt.Errorf("profile: unknown log level %d", level)
+		}
+		p.verbosity, p.quiet = level, level == LogSilent
+		return nil
+	}
+}
+
+// logf logs an informational message.
+func (p *Profile) logf(format string, args ...interface{}) {
+	p.logAttrs(fmt.Sprintf(format, args...))
+}
+
+// debugf logs a message at LogDebug.
+func (p *Profile) debugf(format string, args ...interface{}) {
+	if p.verbosity >= LogDebug {
+		p.emit(fmt.Sprintf(format, args...), nil)
+	}
+}
+
+// logError logs err, whose message begins "profile: ", as a failure.
+func (p *Profile) logError(err error) {
+	p.logAttrs("profile", "error", strings.TrimPrefix(err.Error(), "profile: "))
+}
+
+// logAttrs logs msg, for example "profile: cpu profiling enabled",
+// with attributes given as alternating keys and values, as for
+// log/slog. Messages with an error attribute are logged at LogErrors,
+// and delivered as an EventError and to the functions registered by
+// OnError, others at LogInfo.
+func (p *Profile) logAttrs(msg string, attrs ...interface{}) {
+	level := LogInfo
+	for i := 0; i+1 < len(attrs); i += 2 {
+		if attrs[i] == "error" {
+			level = LogErrors
+			err := fmt.Errorf("%s: %v", msg, attrs[i+1])
+			p.sendEvent(EventError, "", err)
+			for _, fn := range p.onError {
+				fn(err)
+			}
+		}
+	}
+	if p.verbosity >= level {
+		p.emit(msg, attrs)
+	}
+}
+
+// emit writes a message logged by the session. The session's mode is
+// added to the attributes passed to a structured logger. Messages
+// written to the standard logger have the values of the rate, path
+// and error attributes added to them, for example
+// "profile: memory profiling enabled (rate 4096), mem.pprof".
+func (p *Profile) emit(msg string, attrs []interface{}) {
+	if p.logger != nil {
+		p.logger(strings.TrimPrefix(msg, "profile: "), append([]interface{}{"mode", p.mode}, attrs...)...)
+		return
+	}
+	var rate, path, err string
+	for i := 0; i+1 < len(attrs); i += 2 {
+		v := attrs[i+1]
+		switch attrs[i] {
+		case "rate":
+			rate = fmt.Sprintf(" (rate %v)", v)
+		case "path":
+			if paths, ok := v.([]string); ok {
+				v = strings.Join(paths, ", ")
+			}
+			path = fmt.Sprintf(", %v", v)
+		case "error":
+			err = fmt.Sprintf(": %v", v)
+		}
+	}
+	log.Print(msg + rate + path + err)
+}
@@ -0,0 +1,46 @@
+package profile
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"strings"
+	"testing"
+)
+
+func TestVerbosity(t *testing.T) {
+	defer log.SetFlags(log.Flags())
+	defer log.SetOutput(log.Writer())
+	log.SetFlags(0)
+
+	tests := []struct {
+		level LogLevel
+		want  []string
+	}{
+		{LogSilent, nil},
+		{LogErrors, []string{"profile: could not write cpu profile: disk full"}},
+		{LogInfo, []string{"profile: cpu profiling enabled, cpu.pprof", "profile: could not write cpu profile: disk full"}},
+		{LogDebug, []string{"profile: writing profiles to /tmp", "profile: cpu profiling enabled, cpu.pprof", "profile: could not write cpu profile: disk full"}},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		log.SetOutput(&buf)
+		p := &Profile{mode: CPUMode}
+		if err := Verbosity(tt.level)(p); err != nil {
+			t.Fatal(err)
+		}
+		p.debugf("profile: writing profiles to %s", "/tmp")
+		p.logAttrs("profile: cpu profiling enabled", "path", "cpu.pprof")
+		p.logError(errors.New("profile: could not write cpu profile: disk full"))
+		var got []string
+		if s := strings.TrimSuffix(buf.String(), "\n"); s != "" {
+			got = strings.Split(s, "\n")
+		}
+		if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+			t.Errorf("level %d: got %q, want %q", tt.level, got, tt.want)
+		}
+	}
+	if err := Verbosity(LogDebug + 1)(&Profile{}); err == nil {
+		t.Error("expected error for unknown log level")
+	}
+}
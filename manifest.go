@@ -0,0 +1,150 @@
+package profile
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Manifest writes manifest.json to the profile directory when the
+// session stops. The manifest lists each file written by the
+// session, with its size and the kind of profiling which produced
+// it, together with the times the session started and stopped and
+// the settings it used, so that tooling can ingest the directory
+// without having to guess what each file is.
+func Manifest(p *Profile) error {
+	p.manifest = true
+	return nil
+}
+
+// manifest is written to manifest.json by Manifest.
+type manifest struct {
+	Mode    Mode            `json:"mode"`
+	Start   time.Time       `json:"start"`
+	Stop    time.Time       `json:"stop"`
+	Files   []manifestFile  `json:"files"`
+	Options manifestOptions `json:"options"`
+}
+
+// manifestFile describes a file written by the session. Name is
+// relative to the profile directory.
+type manifestFile struct {
+	Name string      `json:"name"`
+	Mode Mode        `json:"mode"`
+	Size int64       `json:"size"`
+	Perm os.FileMode `json:"perm"`
+}
+
+// manifestOptions records the settings of the session which affect
+// the content of its files.
+type manifestOptions struct {
+	Path                 string   `json:"path,omitempty"`
+	Filename             string   `json:"filename,omitempty"`
+	Tag                  string   `json:"tag,omitempty"`
+	CPUProfileRate       int      `json:"cpu_profile_rate,omitempty"`
+	MemProfileRate       int      `json:"mem_profile_rate,omitempty"`
+	MemProfileType       string   `json:"mem_profile_type,omitempty"`
+	MutexProfileFraction int      `json:"mutex_profile_fraction,omitempty"`
+	BlockProfileRate     int      `json:"block_profile_rate,omitempty"`
+	CustomProfile        string   `json:"custom_profile,omitempty"`
+	Debug                int      `json:"debug,omitempty"`
+	DualFormat           bool     `json:"dual_format,omitempty"`
+	BuildInfo            bool     `json:"build_info,omitempty"`
+	Labels               []string `json:"labels,omitempty"`
+	Timestamp            bool     `json:"timestamp,omitempty"`
+	RunID                string   `json:"run_id,omitempty"`
+	TraceSummary         bool     `json:"trace_summary,omitempty"`
+	Expvar               bool     `json:"expvar,omitempty"`
+	CPUProfileChunks     string   `json:"cpu_profile_chunks,omitempty"`
+	GCTraceInterval      string   `json:"gc_trace_interval,omitempty"`
+	MemStatsInterval     string   `json:"memstats_interval,omitempty"`
+}
+
+// manifestOptions returns the settings recorded in the manifest.
+func (p *Profile) manifestOptions() manifestOptions {
+	opts := manifestOptions{
+		Path:                 p.path,
+		Filename:             p.fname,
+		Tag:                  p.tag,
+		CPUProfileRate:       p.cpuProfileRate,
+		MemProfileRate:       p.memProfileRate,
+		MutexProfileFraction: p.mutexProfileFraction,
+		BlockProfileRate:     p.blockProfileRate,
+		CustomProfile:        p.customProfile,
+		Debug:                p.debug,
+		DualFormat:           p.dualFormat,
+		BuildInfo:            p.buildInfo,
+		Labels:               p.labels,
+		Timestamp:            p.timestamp,
+		TraceSummary:         p.traceSummary,
+		Expvar:               p.expvar,
+	}
+	if p.mode == MemMode {
+		opts.MemProfileType = p.memProfileType
+		if p.memProfileBoth {
+			opts.MemProfileType = "heap,allocs"
+		}
+	}
+	if p.runDir {
+		opts.RunID = filepath.Base(p.dir)
+	}
+	if p.cpuChunkInterval != 0 {
+		opts.CPUProfileChunks = p.cpuChunkInterval.String()
+	}
+	if p.gcTraceInterval != 0 {
+		opts.GCTraceInterval = p.gcTraceInterval.String()
+	}
+	if p.memStatsInterval != 0 {
+		opts.MemStatsInterval = p.memStatsInterval.String()
+	}
+	return opts
+}
+
+// writeManifest writes the manifest for Manifest.
+func (p *Profile) writeManifest() error {
+	m := manifest{
+		Mode:    p.mode,
+		Start:   p.started,
+		Stop:    time.Now(),
+		Files:   []manifestFile{},
+		Options: p.manifestOptions(),
+	}
+	for _, name := range p.Files() {
+		fi, err := os.Stat(name)
+		if err != nil {
+			return fmt.Errorf("profile: could not describe %q in manifest: %v", name, err)
+		}
+		rel, err := filepath.Rel(p.dir, name)
+		if err != nil {
+			rel = filepath.Base(name)
+		}
+		m.Files = append(m.Files, manifestFile{
+			Name: filepath.ToSlash(rel),
+			Mode: p.mode,
+			Size: fi.Size(),
+			Perm: fi.Mode().Perm(),
+		})
+	}
+	buf, err := json.MarshalIndent(m, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	fn := filepath.Join(p.dir, p.outputName("manifest.json"))
+	f, err := p.createFile(fn)
+	if err != nil {
+		return fmt.Errorf("profile: could not create manifest %q: %v", fn, err)
+	}
+	_, err = f.Write(append(buf, '\n'))
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("profile: could not write manifest %q: %v", fn, err)
+	}
+	p.addFile(fn)
+	p.logAttrs("profile: manifest written", "path", fn)
+	return nil
+}
@@ -0,0 +1,47 @@
+package profile
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestManifest(t *testing.T) {
+	dir := t.TempDir()
+	p, err := StartErr(MemProfileHeapAndAllocs, Manifest, ProfilePath(dir), Quiet, NoShutdownHook)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+	files := p.Result().Files
+	if want := filepath.Join(dir, "manifest.json"); files[len(files)-1] != want {
+		t.Fatalf("got files %q, want %q last", files, want)
+	}
+	buf, err := ioutil.ReadFile(files[len(files)-1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	var m manifest
+	if err := json.Unmarshal(buf, &m); err != nil {
+		t.Fatal(err)
+	}
+	if m.Mode != MemMode || m.Start.IsZero() || m.Stop.Before(m.Start) {
+		t.Fatalf("got mode %v, start %v, stop %v", m.Mode, m.Start, m.Stop)
+	}
+	if m.Options.MemProfileType != "heap,allocs" || m.Options.Path != dir {
+		t.Fatalf("got options %+v", m.Options)
+	}
+	var names []string
+	for _, f := range m.Files {
+		if f.Size == 0 || f.Mode != MemMode {
+			t.Errorf("%s: got size %d, mode %v", f.Name, f.Size, f.Mode)
+		}
+		names = append(names, f.Name)
+	}
+	if len(names) != 2 || names[0] != "heap.pprof" || names[1] != "allocs.pprof" {
+		t.Fatalf("got manifest files %q", names)
+	}
+}
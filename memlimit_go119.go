@@ -0,0 +1,27 @@
+//go:build go1.19
+// +build go1.19
+
+package profile
+
+import (
+	"math"
+	"runtime/debug"
+	"runtime/metrics"
+)
+
+// readMemLimit returns the memory used by the runtime, as counted
+// against the soft memory limit, and the limit, which is zero if no
+// limit is set.
+func readMemLimit() (used, limit int64, err error) {
+	limit = debug.SetMemoryLimit(-1)
+	if limit == math.MaxInt64 {
+		limit = 0
+	}
+	samples := []metrics.Sample{
+		{Name: "/memory/classes/total:bytes"},
+		{Name: "/memory/classes/heap/released:bytes"},
+	}
+	metrics.Read(samples)
+	used = int64(samples[0].Value.Uint64() - samples[1].Value.Uint64())
+	return used, limit, nil
+}
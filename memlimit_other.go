@@ -0,0 +1,10 @@
+//go:build !go1.19
+// +build !go1.19
+
+package profile
+
+import "errors"
+
+func readMemLimit() (used, limit int64, err error) {
+	return 0, 0, errors.New("profile: WhenNearMemLimit requires Go 1.19 or later")
+}
@@ -0,0 +1,51 @@
+//go:build go1.19
+// +build go1.19
+
+package profile
+
+import (
+	"math"
+	"path/filepath"
+	"runtime/debug"
+	"testing"
+	"time"
+)
+
+func TestWhenNearMemLimit(t *testing.T) {
+	used, _, err := readMemLimit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a limit well above the memory in use, but below twice it.
+	defer debug.SetMemoryLimit(debug.SetMemoryLimit(used * 3 / 2))
+
+	dir := t.TempDir()
+	trigger := WhenNearMemLimit(0.5)
+	trigger.Interval = 10 * time.Millisecond
+	w, err := Watch(trigger, ProfilePath(dir), Quiet, NoShutdownHook)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := waitForFiles(t, w, 2)
+	w.Stop()
+	for i, name := range []string{"heap", "allocs"} {
+		if matched, _ := filepath.Match(filepath.Join(dir, name+"-nearmemlimit-*.pprof"), files[i]); !matched {
+			t.Fatalf("got file %q, want a %s-nearmemlimit profile", files[i], name)
+		}
+	}
+}
+
+func TestWhenNearMemLimitUnset(t *testing.T) {
+	defer debug.SetMemoryLimit(debug.SetMemoryLimit(math.MaxInt64))
+	trigger := WhenNearMemLimit(0.01)
+	trigger.Interval = 10 * time.Millisecond
+	w, err := Watch(trigger, ProfilePath(t.TempDir()), Quiet, NoShutdownHook)
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	w.Stop()
+	if files := w.Files(); len(files) != 0 {
+		t.Fatalf("got files %q without a memory limit", files)
+	}
+}
@@ -0,0 +1,49 @@
+package profile
+
+import (
+	"fmt"
+)
+
+// WhenNearMemLimit returns a Trigger which writes heap and allocs
+// profiles when the memory used by the Go runtime exceeds fraction of
+// the soft memory limit set by GOMEMLIMIT or debug.SetMemoryLimit,
+// capturing the heap before the garbage collector starts to run
+// continuously to stay within the limit. Like WhenHeapAbove, the
+// trigger fires again only once memory use has fallen below the
+// threshold. It never fires if no limit is set.
+// WhenNearMemLimit requires Go 1.19 or later; Watch reports an error
+// otherwise.
+func WhenNearMemLimit(fraction float64) Trigger {
+	return Trigger{
+		Interval: DefaultTriggerInterval,
+		Cooldown: DefaultTriggerCooldown,
+		Duration: DefaultTriggerDuration,
+		name:     "nearmemlimit",
+		modes:    []Mode{MemMode},
+		options:  []Option{MemProfileHeapAndAllocs},
+		check: func() (func() (bool, string), error) {
+			if fraction <= 0 || fraction > 1 {
+				return nil, fmt.Errorf("profile: WhenNearMemLimit requires a fraction between 0 and 1")
+			}
+			if _, _, err := readMemLimit(); err != nil {
+				return nil, err
+			}
+			armed := true
+			return func() (bool, string) {
+				used, limit, err := readMemLimit()
+				if err != nil || limit <= 0 || float64(used) <= fraction*float64(limit) {
+					armed = true
+					return false, ""
+				}
+				if !armed {
+					return false, ""
+				}
+				armed = false
+				return true, fmt.Sprintf("memory use of %d bytes above %.0f%% of the %d byte limit", used, 100*fraction, limit)
+			}, nil
+		},
+		capture: func(w *Watcher) error {
+			return w.session(MemMode, 0)
+		},
+	}
+}
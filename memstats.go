@@ -0,0 +1,86 @@
+package profile
+
+import (
+	"encoding/json"
+	"fmt"
+	"runtime"
+	"time"
+)
+
+// MemStatsProfile records runtime.MemStats as a line of JSON in the
+// output file when the session stops and, if MemStatsInterval is
+// given, periodically while it runs. Run a MemStatsProfile session
+// alongside a MemProfile session, with the same ProfilePath, to
+// give heap profiles the absolute figures, such as HeapInuse, NumGC
+// and PauseTotalNs, that the sampled profile lacks.
+// It replaces any previously selected profiling mode.
+func MemStatsProfile(p *Profile) error { return p.setMode(MemStatsMode) }
+
+// MemStatsInterval requests that MemStatsProfile records the memory
+// statistics every d while the session runs, in addition to when it
+// stops.
+func MemStatsInterval(d time.Duration) Option {
+	return func(p *Profile) error {
+		if d <= 0 {
+			return fmt.Errorf("profile: memstats interval must be positive")
+		}
+		p.memStatsInterval = d
+		return nil
+	}
+}
+
+// memStatsRecord is the record written by MemStatsProfile.
+type memStatsRecord struct {
+	Time time.Time `json:"time"`
+	runtime.MemStats
+}
+
+func (prof *Profile) startMemStats() error {
+	w, fn, err := prof.create("memstats.jsonl")
+	if err != nil {
+		return fmt.Errorf("profile: could not create memstats file %q: %v", fn, err)
+	}
+
+	enc := json.NewEncoder(w)
+	var rec memStatsRecord
+	sample := func() error {
+		runtime.ReadMemStats(&rec.MemStats)
+		rec.Time = time.Now()
+		return enc.Encode(&rec)
+	}
+
+	quit := make(chan struct{})
+	done := make(chan error, 1)
+	go func() {
+		var tick <-chan time.Time
+		if prof.memStatsInterval > 0 {
+			t := time.NewTicker(prof.memStatsInterval)
+			defer t.Stop()
+			tick = t.C
+		}
+		for {
+			select {
+			case <-tick:
+				if err := sample(); err != nil {
+					done <- err
+					return
+				}
+			case <-quit:
+				done <- sample()
+				return
+			}
+		}
+	}()
+
+	prof.logAttrs("profile: memstats enabled", "path", fn)
+	prof.closer = func() error {
+		close(quit)
+		err := <-done
+		if cerr := w.Close(); err == nil {
+			err = cerr
+		}
+		prof.logAttrs("profile: memstats disabled", "path", fn)
+		return err
+	}
+	return nil
+}
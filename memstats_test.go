@@ -0,0 +1,36 @@
+package profile
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestMemStats(t *testing.T) {
+	var buf bytes.Buffer
+	p, err := StartErr(MemStatsProfile, MemStatsInterval(time.Millisecond), WriteTo(&buf), Quiet, NoShutdownHook)
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(10 * time.Millisecond)
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var recs []memStatsRecord
+	dec := json.NewDecoder(&buf)
+	for dec.More() {
+		var rec memStatsRecord
+		if err := dec.Decode(&rec); err != nil {
+			t.Fatal(err)
+		}
+		recs = append(recs, rec)
+	}
+	if len(recs) < 2 {
+		t.Fatalf("got %d records, want at least 2", len(recs))
+	}
+	if last := recs[len(recs)-1]; last.HeapInuse == 0 || last.Time.IsZero() {
+		t.Fatalf("record is missing fields: %+v", last)
+	}
+}
@@ -0,0 +1,58 @@
+package profile
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// MetricsHandler returns an http.Handler which serves metrics about
+// the program's profiling in the Prometheus text exposition format, so
+// that an alert can be raised if continuous profiling stops. Mount it
+// on its own path, or add its output to an existing /metrics endpoint
+// with WriteMetrics. The metrics are
+//
+//	profile_active                         number of running sessions
+//	profile_sessions_total                 sessions begun
+//	profile_bytes_written_total            size of the files written
+//	profile_snapshots_total                snapshots written
+//	profile_snapshot_duration_seconds      time taken to write snapshots, as a summary
+func MetricsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		WriteMetrics(w)
+	})
+}
+
+// WriteMetrics writes the metrics served by MetricsHandler to w.
+func WriteMetrics(w io.Writer) error {
+	snapshots := atomic.LoadInt64(&stats.snapshots)
+	snapshotTime := time.Duration(atomic.LoadInt64(&stats.snapshotNanos))
+	metrics := []struct {
+		name, typ, help string
+		value           interface{}
+	}{
+		{"profile_active", "gauge", "Number of running profiling sessions.", len(running())},
+		{"profile_sessions_total", "counter", "Number of profiling sessions begun.", atomic.LoadInt64(&stats.sessions)},
+		{"profile_bytes_written_total", "counter", "Size of the profiling files written, in bytes.", atomic.LoadInt64(&stats.bytesWritten)},
+		{"profile_snapshots_total", "counter", "Number of profile snapshots written.", snapshots},
+		{"profile_snapshot_duration_seconds", "summary", "Time taken to write profile snapshots.", nil},
+	}
+	for _, m := range metrics {
+		if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", m.name, m.help, m.name, m.typ); err != nil {
+			return err
+		}
+		var err error
+		if m.value != nil {
+			_, err = fmt.Fprintf(w, "%s %v\n", m.name, m.value)
+		} else {
+			_, err = fmt.Fprintf(w, "%s_sum %g\n%s_count %d\n", m.name, snapshotTime.Seconds(), m.name, snapshots)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,56 @@
+package profile
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestMetricsHandler(t *testing.T) {
+	metrics := func() map[string]float64 {
+		srv := httptest.NewServer(MetricsHandler())
+		defer srv.Close()
+		resp, err := srv.Client().Get(srv.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		m := make(map[string]float64)
+		for _, match := range regexp.MustCompile(`(?m)^(profile_\w+) (\S+)$`).FindAllStringSubmatch(string(body), -1) {
+			v, err := strconv.ParseFloat(match[2], 64)
+			if err != nil {
+				t.Fatalf("metric %s: %v", match[1], err)
+			}
+			m[match[1]] = v
+		}
+		return m
+	}
+
+	before := metrics()
+	p, err := StartErr(GoroutineProfile, Snapshot(time.Millisecond), ProfilePath(t.TempDir()), Quiet, NoShutdownHook)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for len(p.Files()) < 2 {
+		time.Sleep(time.Millisecond)
+	}
+	during := metrics()
+	p.Stop()
+	after := metrics()
+
+	if during["profile_active"] != before["profile_active"]+1 || after["profile_active"] != before["profile_active"] {
+		t.Errorf("got profile_active %v, %v and %v before, during and after the session", before["profile_active"], during["profile_active"], after["profile_active"])
+	}
+	for _, name := range []string{"profile_sessions_total", "profile_snapshots_total", "profile_snapshot_duration_seconds_count", "profile_bytes_written_total"} {
+		if after[name] <= before[name] {
+			t.Errorf("%s did not increase from %v", name, before[name])
+		}
+	}
+}
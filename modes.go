@@ -0,0 +1,126 @@
+package profile
+
+import "fmt"
+
+// The functions in this file select the kind of profiling performed
+// by a session together with the settings specific to that kind of
+// profiling. Unlike CPUProfile, MemProfileRate and friends, the mode
+// selected by one of these functions cannot be silently replaced by
+// a later option; combining two of them in one session is an error.
+// Run a session per mode to collect several kinds of profile at once.
+
+// selectMode selects mode for the session, preventing later options
+// from selecting a different mode.
+func (p *Profile) selectMode(mode Mode) error {
+	if err := p.setMode(mode); err != nil {
+		return err
+	}
+	p.scoped = true
+	return nil
+}
+
+// CPU enables cpu profiling.
+func CPU() Option {
+	return func(p *Profile) error { return p.selectMode(CPUMode) }
+}
+
+// Mem enables memory profiling of the given type, either "heap" or
+// "allocs", sampling on average one allocation per rate bytes. If
+// rate is zero DefaultMemProfileRate is used, and if typ is blank
+// the heap is profiled.
+func Mem(rate int, typ string) Option {
+	return func(p *Profile) error {
+		if rate < 0 {
+			return fmt.Errorf("profile: memory profile rate must not be negative")
+		}
+		if rate == 0 {
+			rate = DefaultMemProfileRate
+		}
+		switch typ {
+		case "":
+			typ = "heap"
+		case "heap", "allocs":
+		default:
+			return fmt.Errorf("profile: unknown memory profile type %q", typ)
+		}
+		if err := p.selectMode(MemMode); err != nil {
+			return err
+		}
+		p.memProfileRate = rate
+		p.memProfileType = typ
+		return nil
+	}
+}
+
+// Mutex enables mutex profiling, reporting on average 1/fraction
+// of mutex contention events. If fraction is zero every event is
+// reported. See runtime.SetMutexProfileFraction.
+func Mutex(fraction int) Option {
+	return func(p *Profile) error {
+		if fraction < 0 {
+			return fmt.Errorf("profile: mutex profile fraction must not be negative")
+		}
+		if err := p.selectMode(MutexMode); err != nil {
+			return err
+		}
+		p.mutexProfileFraction = fraction
+		return nil
+	}
+}
+
+// Block enables block profiling, sampling on average one blocking
+// event per rate nanoseconds spent blocked. If rate is zero every
+// event is sampled. See runtime.SetBlockProfileRate.
+func Block(rate int) Option {
+	return func(p *Profile) error {
+		if rate < 0 {
+			return fmt.Errorf("profile: block profile rate must not be negative")
+		}
+		if err := p.selectMode(BlockMode); err != nil {
+			return err
+		}
+		p.blockProfileRate = rate
+		return nil
+	}
+}
+
+// Trace enables execution tracing.
+func Trace() Option {
+	return func(p *Profile) error { return p.selectMode(TraceMode) }
+}
+
+// Goroutine enables goroutine profiling.
+func Goroutine() Option {
+	return func(p *Profile) error { return p.selectMode(GoroutineMode) }
+}
+
+// ThreadCreate enables thread creation profiling.
+func ThreadCreate() Option {
+	return func(p *Profile) error { return p.selectMode(ThreadCreateMode) }
+}
+
+// orOne returns n, or 1 if n is zero.
+func orOne(n int) int {
+	if n == 0 {
+		return 1
+	}
+	return n
+}
+
+// CustomProfile enables profiling of the named profile, which must
+// have been registered with pprof.NewProfile by the time the session
+// starts. The profile is written when the session stops. Sessions
+// writing different custom profiles, and sessions profiling any of
+// the built in modes, may run concurrently.
+func CustomProfile(name string) Option {
+	return func(p *Profile) error {
+		if name == "" {
+			return fmt.Errorf("profile: CustomProfile requires a profile name")
+		}
+		if err := p.selectMode(CustomMode); err != nil {
+			return err
+		}
+		p.customProfile = name
+		return nil
+	}
+}
@@ -0,0 +1,94 @@
+package profile
+
+import (
+	"fmt"
+	"runtime"
+	"time"
+)
+
+// runtimeMemProfileRate is the runtime's default memory profiling
+// rate, which applies even when no memory profile is being written.
+const runtimeMemProfileRate = 512 * 1024
+
+// Overhead is a rough estimate of the cost of a session, suitable for
+// documenting the price of enabling profiling in production. It is
+// reported by Result.
+type Overhead struct {
+	// CPUProfiling holds how long the cpu profiler was enabled,
+	// during which the process is interrupted 100 times a second
+	// by default, see CPUProfileRate.
+	CPUProfiling time.Duration
+
+	// ExtraMemSamples holds an estimate of the number of
+	// allocations sampled by the memory profiler beyond those the
+	// runtime samples at its default rate, each of which records
+	// a stack trace.
+	ExtraMemSamples int64
+
+	// TraceBytesPerSecond holds the rate at which execution trace
+	// data was written.
+	TraceBytesPerSecond float64
+}
+
+// String returns a one line description of o, omitting zero figures.
+func (o Overhead) String() string {
+	var s string
+	add := func(format string, args ...interface{}) {
+		if s != "" {
+			s += ", "
+		}
+		s += fmt.Sprintf(format, args...)
+	}
+	if o.CPUProfiling > 0 {
+		add("cpu profiler enabled for %v", o.CPUProfiling.Round(time.Millisecond))
+	}
+	if o.ExtraMemSamples > 0 {
+		add("%d extra allocations sampled", o.ExtraMemSamples)
+	}
+	if o.TraceBytesPerSecond > 0 {
+		add("%.0f trace bytes/sec", o.TraceBytesPerSecond)
+	}
+	if s == "" {
+		return "negligible"
+	}
+	return s
+}
+
+// startOverhead records the state needed to estimate the session's
+// overhead when it stops.
+func (prof *Profile) startOverhead() {
+	if prof.mode == MemMode {
+		var ms runtime.MemStats
+		runtime.ReadMemStats(&ms)
+		prof.startAlloc, prof.startMallocs = ms.TotalAlloc, ms.Mallocs
+	}
+}
+
+// overhead estimates the cost of the session, which ran for d.
+func (prof *Profile) overhead(d time.Duration) Overhead {
+	var o Overhead
+	switch prof.mode {
+	case CPUMode:
+		o.CPUProfiling = d
+	case MemMode:
+		rate := prof.memProfileRate
+		if rate <= 0 || rate >= runtimeMemProfileRate {
+			break
+		}
+		var ms runtime.MemStats
+		runtime.ReadMemStats(&ms)
+		allocated := int64(ms.TotalAlloc - prof.startAlloc)
+		samples := allocated / int64(rate)
+		if mallocs := int64(ms.Mallocs - prof.startMallocs); samples > mallocs {
+			samples = mallocs // at most every allocation is sampled
+		}
+		if extra := samples - allocated/runtimeMemProfileRate; extra > 0 {
+			o.ExtraMemSamples = extra
+		}
+	case TraceMode:
+		if d > 0 {
+			o.TraceBytesPerSecond = float64(prof.bytesWritten()) / d.Seconds()
+		}
+	}
+	return o
+}
@@ -0,0 +1,47 @@
+package profile
+
+import (
+	"testing"
+	"time"
+)
+
+var sink []byte
+
+func TestOverhead(t *testing.T) {
+	p, err := StartErr(MemProfileRate(1), ProfilePath(t.TempDir()), Quiet, NoShutdownHook)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 1000; i++ {
+		sink = make([]byte, 64)
+	}
+	p.Stop()
+	if o := p.Result().Overhead; o.ExtraMemSamples < 1000 || o.CPUProfiling != 0 {
+		t.Errorf("got overhead %+v, want at least 1000 extra samples", o)
+	}
+
+	p, err = StartErr(TraceProfile, ProfilePath(t.TempDir()), Quiet, NoShutdownHook)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Stop()
+	if o := p.Result().Overhead; o.TraceBytesPerSecond <= 0 {
+		t.Errorf("got overhead %+v, want trace bytes/sec", o)
+	}
+}
+
+func TestOverheadString(t *testing.T) {
+	tests := []struct {
+		o    Overhead
+		want string
+	}{
+		{Overhead{}, "negligible"},
+		{Overhead{CPUProfiling: 1500 * time.Millisecond}, "cpu profiler enabled for 1.5s"},
+		{Overhead{ExtraMemSamples: 7, TraceBytesPerSecond: 2048.4}, "7 extra allocations sampled, 2048 trace bytes/sec"},
+	}
+	for _, tt := range tests {
+		if got := tt.o.String(); got != tt.want {
+			t.Errorf("%+v: got %q, want %q", tt.o, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package profile
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime/pprof"
+)
+
+// Recover flushes profiling data when the calling goroutine panics.
+// It must be deferred directly, typically at the top of main and of
+// any long lived goroutine:
+//
+//	prof := profile.Start(profile.CPUProfile)
+//	defer prof.Stop()
+//	go func() {
+//		defer prof.Recover()
+//		// ...
+//	}()
+//
+// If the goroutine is panicking, Recover writes the stack of every
+// goroutine to goroutine-panic.txt in the session's directory,
+// stops all running sessions so their profiles are written, and
+// then resumes panicking with the original value. If the goroutine
+// is not panicking Recover does nothing.
+func (p *Profile) Recover() {
+	r := recover()
+	if r == nil {
+		return
+	}
+	if !p.disabled && p.dir != "" {
+		p.writePanicDump()
+	}
+	StopActive()
+	panic(r)
+}
+
+// CatchPanic flushes the data of every running session when the
+// calling goroutine panics. It must be deferred directly, typically in
+// main after the sessions have been started, so that it runs before
+// they are stopped:
+//
+//	defer profile.Start(profile.CPUProfile).Stop()
+//	defer profile.CatchPanic()
+//
+// If the goroutine is panicking, CatchPanic writes the stack of every
+// goroutine to goroutine-panic.txt in the directory of each running
+// session, or to standard error if no session writes to a directory,
+// stops all running sessions so their profiles are written, and then
+// resumes panicking with the original value. Unlike Recover it does
+// not require access to a session. If the goroutine is not panicking
+// CatchPanic does nothing.
+func CatchPanic() {
+	r := recover()
+	if r == nil {
+		return
+	}
+	dirs := make(map[string]bool)
+	for _, p := range running() {
+		if p.dir != "" && !dirs[p.dir] {
+			dirs[p.dir] = true
+			p.writePanicDump()
+		}
+	}
+	if len(dirs) == 0 {
+		fmt.Fprintf(os.Stderr, "profile: panic: %v\n", r)
+		pprof.Lookup("goroutine").WriteTo(os.Stderr, 2)
+	}
+	StopActive()
+	panic(r)
+}
+
+// writePanicDump writes the goroutine dump for Recover.
+func (p *Profile) writePanicDump() {
+	fn := filepath.Join(p.dir, p.outputName("goroutine-panic.txt"))
+	f, err := p.createFile(fn)
+	if err != nil {
+		p.logAttrs(fmt.Sprintf("profile: could not create goroutine dump %q", fn), "error", err)
+		return
+	}
+	err = pprof.Lookup("goroutine").WriteTo(f, 2)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		p.logAttrs(fmt.Sprintf("profile: could not write goroutine dump %q", fn), "error", err)
+		return
+	}
+	p.addFile(fn)
+	p.logAttrs("profile: panic, goroutine dump written", "path", fn)
+}
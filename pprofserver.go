@@ -0,0 +1,170 @@
+package profile
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"html"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"runtime"
+	"runtime/pprof"
+	"runtime/trace"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// pprofPrefix is the path under which PprofHandler serves profiles.
+const pprofPrefix = "/debug/pprof/"
+
+// PprofHandler returns an http.Handler serving the endpoints of
+// net/http/pprof under /debug/pprof/, so that profiles may be pulled
+// on demand, for example with go tool pprof, alongside those written
+// by sessions. Unlike importing net/http/pprof, it does not register
+// anything on http.DefaultServeMux. The endpoints are
+//
+//	/debug/pprof/                     an index of the profiles
+//	/debug/pprof/<name>?debug=0&gc=0  the named pprof.Lookup profile
+//	/debug/pprof/profile?seconds=30   a cpu profile
+//	/debug/pprof/trace?seconds=1      an execution trace
+//	/debug/pprof/cmdline              the program's command line
+//	/debug/pprof/symbol               the names of program counters
+//
+// A cpu profile or trace cannot be pulled while a session, or another
+// request, is collecting one.
+func PprofHandler() http.Handler {
+	return http.HandlerFunc(servePprof)
+}
+
+func servePprof(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasPrefix(r.URL.Path, pprofPrefix) {
+		http.NotFound(w, r)
+		return
+	}
+	switch name := strings.TrimPrefix(r.URL.Path, pprofPrefix); name {
+	case "":
+		pprofIndex(w)
+	case "profile":
+		pprofCollect(w, r, 30*time.Second, pprof.StartCPUProfile, pprof.StopCPUProfile)
+	case "trace":
+		pprofCollect(w, r, time.Second, trace.Start, trace.Stop)
+	case "cmdline":
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		fmt.Fprint(w, strings.Join(os.Args, "\x00"))
+	case "symbol":
+		pprofSymbol(w, r)
+	default:
+		if name == "heap" && r.FormValue("gc") != "" {
+			runtime.GC()
+		}
+		serveLookup(w, r, name)
+	}
+}
+
+// pprofIndex writes a page linking to each profile.
+func pprofIndex(w http.ResponseWriter) {
+	var b bytes.Buffer
+	b.WriteString("<html>\n<head><title>/debug/pprof/</title></head>\n<body>\n<table>\n")
+	for _, p := range pprof.Profiles() {
+		name := html.EscapeString(p.Name())
+		fmt.Fprintf(&b, "<tr><td align=right>%d</td><td><a href=\"%s?debug=1\">%s</a></td></tr>\n", p.Count(), name, name)
+	}
+	b.WriteString("</table>\n<p><a href=\"profile\">cpu profile</a>, <a href=\"trace?seconds=1\">trace</a>, <a href=\"goroutine?debug=2\">full goroutine stack dump</a></p>\n</body>\n</html>\n")
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(b.Bytes())
+}
+
+// pprofCollect collects a profile, started by start and stopped by
+// stop, for the number of seconds given by the request, or d, writing
+// it to w.
+func pprofCollect(w http.ResponseWriter, r *http.Request, d time.Duration, start func(io.Writer) error, stop func()) {
+	if s := r.FormValue("seconds"); s != "" {
+		seconds, err := strconv.ParseFloat(s, 64)
+		if err != nil || seconds <= 0 {
+			http.Error(w, fmt.Sprintf("profile: invalid seconds %q", s), http.StatusBadRequest)
+			return
+		}
+		d = time.Duration(seconds * float64(time.Second))
+	}
+	var b bytes.Buffer
+	if err := start(&b); err != nil {
+		http.Error(w, fmt.Sprintf("profile: could not start profiling: %v", err), http.StatusConflict)
+		return
+	}
+	t := time.NewTimer(d)
+	select {
+	case <-t.C:
+	case <-r.Context().Done():
+		t.Stop()
+	}
+	stop()
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Write(b.Bytes())
+}
+
+// pprofSymbol writes the names of the functions containing the
+// program counters, separated by +, in the body of a POST request or
+// the query of a GET request, as net/http/pprof does.
+func pprofSymbol(w http.ResponseWriter, r *http.Request) {
+	var in *bufio.Reader
+	if r.Method == "POST" {
+		in = bufio.NewReader(r.Body)
+	} else {
+		in = bufio.NewReader(strings.NewReader(r.URL.RawQuery))
+	}
+	var b bytes.Buffer
+	// pprof only checks that the count is positive.
+	b.WriteString("num_symbols: 1\n")
+	for {
+		word, err := in.ReadSlice('+')
+		if err == nil {
+			word = word[:len(word)-1]
+		}
+		pc, _ := strconv.ParseUint(string(word), 0, 64)
+		if pc != 0 {
+			if fn := runtime.FuncForPC(uintptr(pc)); fn != nil {
+				fmt.Fprintf(&b, "%#x %s\n", pc, fn.Name())
+			}
+		}
+		if err != nil {
+			break
+		}
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write(b.Bytes())
+}
+
+// PprofServer serves the endpoints of PprofHandler on a dedicated
+// listener. See ServePprof.
+type PprofServer struct {
+	l   net.Listener
+	srv *http.Server
+}
+
+// ServePprof listens on the TCP address addr, for example
+// localhost:6060, and serves PprofHandler there until its Close
+// method is called. The endpoints are unauthenticated, so addr should
+// not be reachable from untrusted networks.
+func ServePprof(addr string) (*PprofServer, error) {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("profile: could not listen for pprof requests: %v", err)
+	}
+	mux := http.NewServeMux()
+	mux.Handle(pprofPrefix, PprofHandler())
+	s := &PprofServer{l: l, srv: &http.Server{Handler: mux}}
+	go s.srv.Serve(l)
+	return s, nil
+}
+
+// Addr returns the address the server is listening on, which is
+// useful if the port given to ServePprof was zero.
+func (s *PprofServer) Addr() string { return s.l.Addr().String() }
+
+// Close stops the server, closing its listener and any connections.
+func (s *PprofServer) Close() error {
+	return s.srv.Close()
+}
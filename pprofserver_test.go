@@ -0,0 +1,54 @@
+package profile
+
+import (
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestServePprof(t *testing.T) {
+	s, err := ServePprof("localhost:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	get := func(path string, want int) []byte {
+		t.Helper()
+		resp, err := http.Get("http://" + s.Addr() + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, _ := ioutil.ReadAll(resp.Body)
+		if resp.StatusCode != want {
+			t.Fatalf("%s: got status %d, want %d: %s", path, resp.StatusCode, want, body)
+		}
+		return body
+	}
+
+	if body := get("/debug/pprof/", http.StatusOK); !strings.Contains(string(body), "goroutine?debug=1") {
+		t.Errorf("index does not link to the goroutine profile: %s", body)
+	}
+	if _, err := parseProto(get("/debug/pprof/heap?gc=1", http.StatusOK)); err != nil {
+		t.Errorf("heap: %v", err)
+	}
+	if _, err := parseProto(get("/debug/pprof/profile?seconds=0.01", http.StatusOK)); err != nil {
+		t.Errorf("profile: %v", err)
+	}
+	if body := get("/debug/pprof/cmdline", http.StatusOK); len(body) == 0 {
+		t.Errorf("got empty command line")
+	}
+	get("/debug/pprof/nosuchprofile", http.StatusNotFound)
+	get("/debug/pprof/profile?seconds=-1", http.StatusBadRequest)
+	get("/other", http.StatusNotFound)
+
+	// a cpu profile cannot be pulled while a session is collecting one.
+	p, err := StartErr(CPUProfile, ProfilePath(t.TempDir()), Quiet, NoShutdownHook)
+	if err != nil {
+		t.Fatal(err)
+	}
+	get("/debug/pprof/profile?seconds=0.01", http.StatusConflict)
+	p.Stop()
+}
@@ -3,45 +3,217 @@
 package profile
 
 import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
 	"os"
-	"os/signal"
 	"path/filepath"
 	"runtime"
 	"runtime/pprof"
 	"runtime/trace"
+	"strconv"
+	"strings"
+	"sync"
 	"sync/atomic"
+	"time"
 )
 
+// Mode identifies the kind of profiling performed by a session.
+type Mode int
+
+// Profiling modes supported by this package.
 const (
-	cpuMode = iota
-	memMode
-	mutexMode
-	blockMode
-	traceMode
-	threadCreateMode
-	goroutineMode
+	CPUMode Mode = iota
+	MemMode
+	MutexMode
+	BlockMode
+	TraceMode
+	ThreadCreateMode
+	GoroutineMode
+	HeapDumpMode
+	GCTraceMode
+	CustomMode
+	FlightRecorderMode
+	AllMode
+	DiagnosticMode
+	MemStatsMode
+
+	numModes // must be last
 )
 
+// valid reports whether m is a known profiling mode.
+func (m Mode) valid() bool { return m >= CPUMode && m < numModes }
+
+func (m Mode) String() string {
+	switch m {
+	case CPUMode:
+		return "cpu"
+	case MemMode:
+		return "mem"
+	case MutexMode:
+		return "mutex"
+	case BlockMode:
+		return "block"
+	case TraceMode:
+		return "trace"
+	case ThreadCreateMode:
+		return "threadcreate"
+	case GoroutineMode:
+		return "goroutine"
+	case HeapDumpMode:
+		return "heapdump"
+	case GCTraceMode:
+		return "gctrace"
+	case CustomMode:
+		return "custom"
+	case FlightRecorderMode:
+		return "flightrecorder"
+	case AllMode:
+		return "all"
+	case DiagnosticMode:
+		return "diagnostic"
+	case MemStatsMode:
+		return "memstats"
+	default:
+		return fmt.Sprintf("Mode(%d)", int(m))
+	}
+}
+
 // Profile represents an active profiling session.
 type Profile struct {
 	// quiet suppresses informational messages during profiling.
 	quiet bool
 
+	// verbosity selects which messages are logged; it is LogSilent
+	// if quiet is set.
+	verbosity LogLevel
+
+	// logger, if not nil, receives the session's messages in place
+	// of the standard logger, see logAttrs.
+	logger func(msg string, attrs ...interface{})
+
+	// disabled indicates the session should not perform any profiling.
+	disabled bool
+
 	// noShutdownHook controls whether the profiling package should
-	// hook SIGINT to write profiles cleanly.
+	// hook SIGINT and SIGTERM to write profiles cleanly.
 	noShutdownHook bool
 
+	// shutdownSigs hold the signals caught by the shutdown hook,
+	// if not the default.
+	shutdownSigs []os.Signal
+
+	// shutdownOnQuit adds SIGQUIT to the signals caught by the
+	// shutdown hook.
+	shutdownOnQuit bool
+
+	// shutdownExitCode, if not nil, holds the status with which the
+	// shutdown hook exits, in place of terminating the program with
+	// the signal it caught.
+	shutdownExitCode *int
+
+	// shutdownNoExit stops the shutdown hook exiting the program.
+	shutdownNoExit bool
+
+	// shutdownNotify, if not nil, receives the signals caught by the
+	// shutdown hook once it has stopped profiling.
+	shutdownNotify chan<- os.Signal
+
+	// shutdownTimeout, if not zero, limits how long the shutdown hook
+	// waits for the session to stop.
+	shutdownTimeout time.Duration
+
 	// mode holds the type of profiling that will be made
-	mode int
+	mode Mode
+
+	// scoped records that mode was selected by a scoped
+	// constructor, such as CPU or Mem, and may not be replaced.
+	scoped bool
 
 	// path holds the base path where various profiling files are written.
 	// If blank, the base path will be generated by ioutil.TempDir.
 	path string
 
-	// fname holds the filename of the profile file.
-	fname string
+	// fname holds the filename of the profile file. If
+	// fnameTemplate is set, it holds a template expanded by
+	// expandTemplate, with tag holding the value of {tag}.
+	fname         string
+	fnameTemplate bool
+	tag           string
+
+	// w holds the writer the profile is written to instead of a file.
+	w io.Writer
+
+	// capture indicates profiles are written to the buffers in
+	// captured, by mode, instead of to files.
+	capture  bool
+	captured map[Mode]*bytes.Buffer
+
+	// traceSummary indicates a summary of scheduler latency is
+	// written when a trace session stops.
+	traceSummary bool
+
+	// uploaders hold the destinations the session's files are
+	// copied to when it stops, within uploadTimeout.
+	uploaders     []Uploader
+	uploadTimeout time.Duration
+
+	// uploadAsWritten indicates files are uploaded as soon as they
+	// are written, rather than when the session stops. uploaded
+	// holds the files already uploaded, and uploadErr the first
+	// error encountered uploading them.
+	uploadAsWritten bool
+	uploadMu        sync.Mutex
+	uploaded        map[string]bool
+	uploadErr       error
+
+	// latestSymlink indicates links to the session's files are
+	// maintained when it stops.
+	latestSymlink bool
+
+	// dualFormat indicates profiles obtained from runtime/pprof
+	// are written in both pprof and text formats.
+	dualFormat bool
+
+	// buildInfo indicates build information is added to the
+	// comments of pprof profiles.
+	buildInfo bool
+
+	// manifest indicates a description of the session's files
+	// is written when it stops.
+	manifest bool
+
+	// logSummary indicates the session's Summary is logged when it
+	// stops.
+	logSummary bool
+
+	// archive indicates the session's files are packaged into
+	// a single archive when it stops.
+	archive bool
+
+	// expvar indicates the expvar variables are written to the
+	// profile directory when the session stops.
+	expvar bool
+
+	// labels holds the pprof labels, as key value pairs, applied
+	// to the goroutine which starts the session.
+	labels []string
+
+	// snapshotInterval holds how often a snapshot of a profile
+	// obtained from pprof.Lookup is written. If zero, the profile
+	// is only written when the session stops.
+	snapshotInterval time.Duration
+
+	// cpuChunkInterval holds how often the cpu profile is
+	// restarted in a new file. If zero, it is written once.
+	cpuChunkInterval time.Duration
+
+	// cpuProfileRate holds the sampling rate of the cpu profile
+	// in hertz. If zero the runtime default is used.
+	cpuProfileRate int
 
 	// memProfileRate holds the rate for the memory profile.
 	memProfileRate int
@@ -50,278 +222,1538 @@ type Profile struct {
 	// profiles. Allowed values are `heap` and `allocs`.
 	memProfileType string
 
+	// heapDumpSignals holds the signals which trigger additional
+	// heap dumps.
+	heapDumpSignals []os.Signal
+
+	// customProfile holds the name of the profile written in
+	// CustomMode.
+	customProfile string
+
+	// flightRecorderWindow and flightRecorderSignals hold the
+	// settings for FlightRecorderMode.
+	flightRecorderWindow  time.Duration
+	flightRecorderSignals []os.Signal
+
+	// gcTraceInterval holds how often GC activity is sampled.
+	gcTraceInterval time.Duration
+
+	// memStatsInterval holds how often memory statistics are
+	// recorded. If zero they are only recorded at Stop.
+	memStatsInterval time.Duration
+
+	// memProfileBoth indicates both heap and allocs profiles
+	// should be written.
+	memProfileBoth bool
+
+	// debug holds the debug level passed to pprof.Profile.WriteTo
+	// when writing profiles obtained from pprof.Lookup.
+	debug int
+
+	// mutexProfileFraction and blockProfileRate hold the rates
+	// for mutex and block profiles. If zero, every event is
+	// recorded.
+	mutexProfileFraction int
+	blockProfileRate     int
+
+	// timestamp indicates the time the session began is added to
+	// the default names of the files it writes.
+	timestamp bool
+
+	// budgetActive and budgetCaptures hold the limits of the
+	// profiling performed by a Watcher.
+	budgetActive   float64
+	budgetCaptures int
+
+	// trigger holds the name of the trigger which started the
+	// session, which is added to the names of its files.
+	trigger string
+
+	// started holds the time the session began.
+	started time.Time
+
+	// peaks tracks the heap size and number of goroutines while
+	// the session runs.
+	peaks peaks
+
+	// startAlloc and startMallocs hold the runtime's allocation
+	// counters when the session began, see overhead.
+	startAlloc, startMallocs uint64
+
+	// rotated holds the time the session's profile was last
+	// rotated, if it has been.
+	rotated time.Time
+
+	// retention holds the number of timestamped files of each
+	// kind kept in the profile directory. If zero, all are kept.
+	retention int
+
+	// dirPerm and fileMode hold the permissions of directories
+	// and files created by the session. If zero, the defaults
+	// are used.
+	dirPerm  os.FileMode
+	fileMode os.FileMode
+
+	// tempParent and tempPattern control the directory created
+	// for the session if path is blank.
+	tempParent  string
+	tempPattern string
+
+	// pruneAge and pruneRuns control the removal of directories
+	// created by earlier sessions.
+	pruneAge  time.Duration
+	pruneRuns int
+
+	// runDir indicates files are written to a directory of their
+	// own, named runDirID or a generated run id.
+	runDir   bool
+	runDirID string
+
+	// noAtomicWrites indicates files are written in place rather
+	// than renamed into place when complete.
+	noAtomicWrites bool
+
+	// dir holds the directory profiling files are written to
+	// once the session has started.
+	dir string
+
+	// cpu holds the running cpu profile, if any.
+	cpu *cpuProfile
+
+	// mu protects files.
+	mu sync.Mutex
+
+	// files holds the paths of the profiling files written by the session.
+	files []string
+
+	// runMu serialises changes to the profile being collected.
+	runMu sync.Mutex
+
 	// closer holds a cleanup function that run after each profile
-	closer func()
+	closer func() error
+
+	// err holds the first error encountered writing a profile
+	// before the session was stopped.
+	err error
+
+	// snapshotSignal holds the signal which causes snapshots of
+	// the profiles named by snapshotProfiles to be written.
+	snapshotSignal   os.Signal
+	snapshotProfiles []string
+
+	// heartbeat holds the function called by Watchdog, which must
+	// return within heartbeatTimeout.
+	heartbeat        func()
+	heartbeatTimeout time.Duration
+
+	// progressInterval holds how often ReportProgress reports the
+	// session's progress, to onProgress if not nil.
+	progressInterval time.Duration
+	onProgress       func(ProgressReport)
+
+	// toggleSignals hold the signals which begin and stop the
+	// session when it is started.
+	toggleSignals []os.Signal
+
+	// rotateSignals hold the signals which rotate the session's
+	// profile.
+	rotateSignals []os.Signal
+
+	// duration holds how long the session runs before it is
+	// stopped automatically. If zero, it runs until stopped.
+	duration time.Duration
+
+	// onStart and onStop hold functions called when the session
+	// starts and once it has stopped.
+	onStart []func(*Profile)
+	onStop  []func(Result)
+
+	// onWritten holds the functions called as each file is written.
+	onWritten []func(path, mode string, size int64)
+
+	// onError holds the functions called with each failure.
+	onError []func(error)
+
+	// events holds the channel returned by Events, which is closed,
+	// and eventsClosed set, once the session has stopped. eventsMu
+	// protects both.
+	eventsMu     sync.Mutex
+	events       chan Event
+	eventsClosed bool
+
+	// result holds the outcome of the session once it has been stopped.
+	result Result
+
+	// begun records if a call to Begin has been made
+	begun uint32
 
 	// stopped records if a call to profile.Stop has been made
 	stopped uint32
+
+	// done is closed once the session has been stopped and
+	// its data flushed.
+	done chan struct{}
 }
 
+// An Option configures a profiling session. Options are applied in
+// order by Start before any files are created or runtime settings
+// are changed; if an Option returns an error the session is not
+// started.
+type Option func(*Profile) error
+
 // NoShutdownHook controls whether the profiling package should
-// hook SIGINT to write profiles cleanly.
+// hook SIGINT and SIGTERM to write profiles cleanly.
 // Programs with more sophisticated signal handling should set
 // this to true and ensure the Stop() function returned from Start()
 // is called during shutdown.
-func NoShutdownHook(p *Profile) { p.noShutdownHook = true }
+func NoShutdownHook(p *Profile) error {
+	p.noShutdownHook = true
+	return nil
+}
 
-// Quiet suppresses informational messages during profiling.
-func Quiet(p *Profile) { p.quiet = true }
+// Quiet suppresses all of the session's messages during profiling,
+// including failures to write profiles; see Verbosity to log only
+// failures. Quiet replaces an earlier Verbosity.
+func Quiet(p *Profile) error {
+	p.quiet, p.verbosity = true, LogSilent
+	return nil
+}
 
 // CPUProfile enables cpu profiling.
-// It disables any previous profiling settings.
-func CPUProfile(p *Profile) { p.mode = cpuMode }
+// It replaces any previously selected profiling mode.
+func CPUProfile(p *Profile) error { return p.setMode(CPUMode) }
+
+// CPUProfileRate enables cpu profiling at the preferred rate, in
+// samples per second. If hz is zero the runtime's default of 100Hz
+// is used. See runtime.SetCPUProfileRate.
+// The runtime prints a warning to stderr when the profile starts
+// with a rate other than the default; it may be ignored.
+// It replaces any previously selected profiling mode.
+func CPUProfileRate(hz int) Option {
+	return func(p *Profile) error {
+		if hz < 0 {
+			return fmt.Errorf("profile: cpu profile rate must not be negative")
+		}
+		p.cpuProfileRate = hz
+		return p.setMode(CPUMode)
+	}
+}
 
 // DefaultMemProfileRate is the default memory profiling rate.
 // See also http://golang.org/pkg/runtime/#pkg-variables
 const DefaultMemProfileRate = 4096
 
 // MemProfile enables memory profiling.
-// It disables any previous profiling settings.
-func MemProfile(p *Profile) {
+// It replaces any previously selected profiling mode.
+func MemProfile(p *Profile) error {
 	p.memProfileRate = DefaultMemProfileRate
-	p.mode = memMode
+	return p.setMode(MemMode)
 }
 
 // MemProfileRate enables memory profiling at the preferred rate.
-// It disables any previous profiling settings.
-func MemProfileRate(rate int) func(*Profile) {
-	return func(p *Profile) {
+// It replaces any previously selected profiling mode.
+func MemProfileRate(rate int) Option {
+	return func(p *Profile) error {
+		if rate < 0 {
+			return fmt.Errorf("profile: memory profile rate must not be negative")
+		}
 		p.memProfileRate = rate
-		p.mode = memMode
+		return p.setMode(MemMode)
 	}
 }
 
 // MemProfileHeap changes which type of memory profiling to profile
 // the heap.
-func MemProfileHeap(p *Profile) {
+func MemProfileHeap(p *Profile) error {
 	p.memProfileType = "heap"
-	p.mode = memMode
+	return p.setMode(MemMode)
 }
 
 // MemProfileAllocs changes which type of memory to profile
 // allocations.
-func MemProfileAllocs(p *Profile) {
+func MemProfileAllocs(p *Profile) error {
 	p.memProfileType = "allocs"
-	p.mode = memMode
+	return p.setMode(MemMode)
+}
+
+// MemProfileHeapAndAllocs enables memory profiling, writing both a
+// heap profile, heap.pprof, and an allocs profile, allocs.pprof, when
+// the session stops. It cannot be combined with ProfileFilename or
+// WriteTo.
+func MemProfileHeapAndAllocs(p *Profile) error {
+	if p.memProfileRate == 0 {
+		p.memProfileRate = DefaultMemProfileRate
+	}
+	p.memProfileBoth = true
+	return p.setMode(MemMode)
 }
 
 // MutexProfile enables mutex profiling.
-// It disables any previous profiling settings.
-func MutexProfile(p *Profile) { p.mode = mutexMode }
+// It replaces any previously selected profiling mode.
+func MutexProfile(p *Profile) error { return p.setMode(MutexMode) }
 
 // BlockProfile enables block (contention) profiling.
-// It disables any previous profiling settings.
-func BlockProfile(p *Profile) { p.mode = blockMode }
+// It replaces any previously selected profiling mode.
+func BlockProfile(p *Profile) error { return p.setMode(BlockMode) }
 
 // Trace profile enables execution tracing.
-// It disables any previous profiling settings.
-func TraceProfile(p *Profile) { p.mode = traceMode }
+// It replaces any previously selected profiling mode.
+func TraceProfile(p *Profile) error { return p.setMode(TraceMode) }
 
 // ThreadcreationProfile enables thread creation profiling..
-// It disables any previous profiling settings.
-func ThreadcreationProfile(p *Profile) { p.mode = threadCreateMode }
+// It replaces any previously selected profiling mode.
+func ThreadcreationProfile(p *Profile) error { return p.setMode(ThreadCreateMode) }
 
 // GoroutineProfile enables goroutine profiling.
-// It disables any previous profiling settings.
-func GoroutineProfile(p *Profile) { p.mode = goroutineMode }
+// It replaces any previously selected profiling mode.
+func GoroutineProfile(p *Profile) error { return p.setMode(GoroutineMode) }
+
+// GoroutineProfileFullStacks enables goroutine profiling, writing the
+// stack of every goroutine in the same text format used by the Go
+// runtime when a program panics, rather than a pprof profile. This is
+// the format most useful when diagnosing deadlocks. The profile is
+// written to goroutine.txt.
+// It replaces any previously selected profiling mode.
+func GoroutineProfileFullStacks(p *Profile) error {
+	p.debug = 2
+	return p.setMode(GoroutineMode)
+}
+
+// DualFormat writes profiles obtained from runtime/pprof in both the
+// pprof protocol buffer format and the text format of TextFormat, for
+// example to goroutine.pprof and goroutine.txt, giving a profile for
+// analysis and another for a quick look from a single session.
+func DualFormat(p *Profile) error {
+	p.dualFormat = true
+	return nil
+}
+
+// TextFormat writes profiles obtained from runtime/pprof, such as
+// memory, mutex, block, thread creation and goroutine profiles, in
+// a human readable text format rather than as pprof protocol buffers,
+// so they can be inspected without go tool pprof. The profiles are
+// written to files with a .txt extension, for example mem.txt.
+func TextFormat(p *Profile) error {
+	if p.debug == 0 {
+		p.debug = 1
+	}
+	return nil
+}
 
 // ProfilePath controls the base path where various profiling
 // files are written. If blank, the base path will be generated
 // by ioutil.TempDir.
-func ProfilePath(path string) func(*Profile) {
-	return func(p *Profile) {
+func ProfilePath(path string) Option {
+	return func(p *Profile) error {
 		p.path = path
+		return nil
 	}
 }
 
 // ProfileFilename controls the the filename of the profile file
 // to be written. It must not contain any path elements.
-func ProfileFilename(fname string) func(*Profile) {
-	return func(p *Profile) {
-		p.fname = fname
+func ProfileFilename(fname string) Option {
+	return func(p *Profile) error {
+		if fname != "" && filepath.Base(fname) != fname {
+			return fmt.Errorf("profile: filename must not contain path elements")
+		}
+		p.fname, p.fnameTemplate = fname, false
+		return nil
+	}
+}
+
+// Timestamp adds the time the session began to the names of the
+// files it writes, for example cpu-20060102T150405Z.pprof, so that
+// successive runs writing to the same ProfilePath do not overwrite
+// each other's profiles. Times are in UTC. Timestamp cannot be
+// combined with ProfileFilename.
+func Timestamp(p *Profile) error {
+	p.timestamp = true
+	return nil
+}
+
+// ProfileTempDir controls where the unique directory created for a
+// session not given a ProfilePath is placed. The directory is created
+// within parent, which is created if necessary, with a name made by
+// adding a random string to pattern, see ioutil.TempDir. If parent is
+// blank the default directory for temporary files is used, and if
+// pattern is blank "profile" is used.
+func ProfileTempDir(parent, pattern string) Option {
+	return func(p *Profile) error {
+		if strings.ContainsRune(pattern, filepath.Separator) {
+			return fmt.Errorf("profile: temporary directory pattern must not contain path separators")
+		}
+		p.tempParent, p.tempPattern = parent, pattern
+		return nil
+	}
+}
+
+// RunDir writes the session's files to a directory of their own,
+// named id, within the profile directory, so that the output of
+// repeated sessions is kept apart. If id is blank, a run id made of
+// the time the session was created and the process id is used, for
+// example 20060102T150405Z-1234. The id must not contain any path
+// elements.
+func RunDir(id string) Option {
+	return func(p *Profile) error {
+		if id != "" && filepath.Base(id) != id {
+			return fmt.Errorf("profile: run id must not contain path elements")
+		}
+		p.runDir, p.runDirID = true, id
+		return nil
+	}
+}
+
+// runID returns the name of the directory created by RunDir.
+func (p *Profile) runID() string {
+	if p.runDirID != "" {
+		return p.runDirID
+	}
+	return time.Now().UTC().Format(timestampLayout) + "-" + strconv.Itoa(os.Getpid())
+}
+
+// NoAtomicWrites writes profiles directly to their files, rather
+// than to a temporary file which is renamed into place when the
+// profile is complete. By default programs watching the profile
+// directory never observe a partially written profile, but a
+// temporary file, ending in .tmp, may be left behind if the program
+// exits without stopping the session.
+func NoAtomicWrites(p *Profile) error {
+	p.noAtomicWrites = true
+	return nil
+}
+
+// ProfileDirMode sets the permissions of the profile directory if it
+// is created by the session. By default the directory is created
+// with mode 0777, before the umask is applied, or 0700 if ProfilePath
+// is not given. Existing directories are left unchanged. As profiles
+// reveal the internals of the program, security conscious deployments
+// may prefer 0700.
+func ProfileDirMode(mode os.FileMode) Option {
+	return func(p *Profile) error {
+		if mode&^os.ModePerm != 0 || mode == 0 {
+			return fmt.Errorf("profile: invalid directory mode %v", mode)
+		}
+		p.dirPerm = mode
+		return nil
+	}
+}
+
+// ProfileFileMode sets the permissions of the files written by the
+// session. By default files are created with mode 0666, before the
+// umask is applied. Security conscious deployments may prefer 0600.
+func ProfileFileMode(mode os.FileMode) Option {
+	return func(p *Profile) error {
+		if mode&^os.ModePerm != 0 || mode == 0 {
+			return fmt.Errorf("profile: invalid file mode %v", mode)
+		}
+		p.fileMode = mode
+		return nil
+	}
+}
+
+// WriteTo writes the profile to w rather than to a file. No files or
+// directories are created by a session configured with WriteTo, and
+// w is not closed when the session stops. WriteTo cannot be combined
+// with ProfilePath or ProfileFilename.
+//
+// Most profiles are written to w when the session stops. Execution
+// traces are streamed to w while the session runs.
+func WriteTo(w io.Writer) Option {
+	return func(p *Profile) error {
+		if w == nil {
+			return fmt.Errorf("profile: WriteTo requires a non nil writer")
+		}
+		p.w = w
+		return nil
+	}
+}
+
+// Enabled controls whether the session performs any profiling. If
+// enabled is false, Start returns a session which creates no files,
+// changes no runtime settings and does nothing when stopped. This
+// allows profiling to be enabled conditionally without branching:
+//
+//	defer profile.Start(profile.Enabled(*profiling)).Stop()
+func Enabled(enabled bool) Option {
+	return func(p *Profile) error {
+		p.disabled = !enabled
+		return nil
+	}
+}
+
+// OnError registers fn to be called with each failure encountered by
+// the session, for example a snapshot, rotation or upload which fails,
+// as well as a failure to write its profile when it stops, so that the
+// application can act on it rather than the failure only being
+// logged. fn may be called concurrently. If OnError is given to Start,
+// a session which cannot be started is reported to fn, rather than
+// exiting the program, and Start returns a session which does nothing.
+func OnError(fn func(error)) Option {
+	return func(p *Profile) error {
+		p.onError = append(p.onError, fn)
+		return nil
+	}
+}
+
+// OnStart registers fn to be called once profiling has started.
+func OnStart(fn func(*Profile)) Option {
+	return func(p *Profile) error {
+		p.onStart = append(p.onStart, fn)
+		return nil
+	}
+}
+
+// Duration stops the session automatically once it has run for d,
+// flushing its data as if Stop had been called. Use OnStop or the
+// session's Done method to learn when the data has been written.
+// The session may still be stopped earlier by calling Stop.
+func Duration(d time.Duration) Option {
+	return func(p *Profile) error {
+		if d <= 0 {
+			return fmt.Errorf("profile: duration must be positive")
+		}
+		p.duration = d
+		return nil
+	}
+}
+
+// OnStop registers fn to be called with the result of the session
+// once it has been stopped and its data flushed.
+func OnStop(fn func(Result)) Option {
+	return func(p *Profile) error {
+		p.onStop = append(p.onStop, fn)
+		return nil
+	}
+}
+
+// OnProfileWritten registers fn to be called with the path, mode and
+// size of each file written by the session, such as a profile or a
+// snapshot, as soon as it is complete, so that it can be uploaded or
+// registered without waiting for the session to stop. fn may be
+// called concurrently, and must not stop the session.
+func OnProfileWritten(fn func(path, mode string, size int64)) Option {
+	return func(p *Profile) error {
+		p.onWritten = append(p.onWritten, fn)
+		return nil
+	}
+}
+
+// setMode selects the kind of profiling performed by the session.
+func (p *Profile) setMode(mode Mode) error {
+	if p.scoped && p.mode != mode {
+		return fmt.Errorf("profile: %v profiling cannot be combined with %v profiling in one session", mode, p.mode)
+	}
+	p.mode = mode
+	return nil
+}
+
+// useMode selects a mode chosen while the program runs, rather than by
+// an option, using the default memory profile rate for memory
+// profiling unless another rate was given, as SwitchMode does.
+func (p *Profile) useMode(mode Mode) error {
+	if mode == MemMode && p.memProfileRate == 0 {
+		p.memProfileRate = DefaultMemProfileRate
+	}
+	return p.setMode(mode)
+}
+
+// validate reports invalid combinations of options.
+func (p *Profile) validate() error {
+	if p.mode != HeapDumpMode && len(p.heapDumpSignals) > 0 {
+		return fmt.Errorf("profile: HeapDumpSignal is not valid with %v profiling", p.mode)
+	}
+	if p.mode == CustomMode && p.customProfile == "" {
+		return fmt.Errorf("profile: custom profiling requires a profile name, see CustomProfile")
+	}
+	if p.mode != GCTraceMode && p.gcTraceInterval != 0 {
+		return fmt.Errorf("profile: GCTraceInterval is not valid with %v profiling", p.mode)
+	}
+	if p.mode != FlightRecorderMode && (p.flightRecorderWindow != 0 || len(p.flightRecorderSignals) > 0) {
+		return fmt.Errorf("profile: TraceFlightRecorder settings are not valid with %v profiling", p.mode)
+	}
+	if p.mode != MemStatsMode && p.memStatsInterval != 0 {
+		return fmt.Errorf("profile: MemStatsInterval is not valid with %v profiling", p.mode)
 	}
+	if p.dualFormat && (!p.mode.lookup() || p.fname != "" || p.inMemory()) {
+		return fmt.Errorf("profile: DualFormat is not valid with %v profiling, ProfileFilename, WriteTo or CaptureInMemory", p.mode)
+	}
+	if p.debug == 1 && !p.mode.lookup() {
+		return fmt.Errorf("profile: TextFormat is not valid with %v profiling", p.mode)
+	}
+	if p.mode != GoroutineMode && p.debug == 2 {
+		return fmt.Errorf("profile: GoroutineProfileFullStacks is not valid with %v profiling", p.mode)
+	}
+	if p.cpuChunkInterval != 0 && (p.mode != CPUMode || p.fname != "" || p.inMemory()) {
+		return fmt.Errorf("profile: CPUProfileChunks cannot be combined with %v profiling, ProfileFilename, WriteTo or CaptureInMemory", p.mode)
+	}
+	if p.snapshotInterval != 0 && (!p.mode.lookup() || p.mode == AllMode || p.memProfileBoth || p.fname != "" || p.inMemory()) {
+		return fmt.Errorf("profile: Snapshot cannot be combined with %v profiling, MemProfileHeapAndAllocs, ProfileFilename, WriteTo or CaptureInMemory", p.mode)
+	}
+	if p.mode != CPUMode && p.cpuProfileRate != 0 {
+		return fmt.Errorf("profile: cpu profile rate is not valid with %v profiling", p.mode)
+	}
+	if p.mode != MutexMode && p.mutexProfileFraction != 0 {
+		return fmt.Errorf("profile: mutex profile fraction is not valid with %v profiling", p.mode)
+	}
+	if p.mode != BlockMode && p.blockProfileRate != 0 {
+		return fmt.Errorf("profile: block profile rate is not valid with %v profiling", p.mode)
+	}
+	if p.retention > 0 && !p.timestamp && !p.archive && !(p.fnameTemplate && strings.Contains(p.fname, "{ts}")) {
+		return fmt.Errorf("profile: Retention requires Timestamp, ArchiveOutput or a filename template containing {ts}")
+	}
+	if p.timestamp && p.fname != "" {
+		return fmt.Errorf("profile: Timestamp cannot be combined with ProfileFilename")
+	}
+	if p.w != nil && (p.path != "" || p.fname != "") {
+		return fmt.Errorf("profile: WriteTo cannot be combined with ProfilePath or ProfileFilename")
+	}
+	if (p.tempParent != "" || p.tempPattern != "") && (p.path != "" || p.inMemory()) {
+		return fmt.Errorf("profile: ProfileTempDir cannot be combined with ProfilePath, WriteTo or CaptureInMemory")
+	}
+	if (p.pruneAge > 0 || p.pruneRuns > 0) && (p.inMemory() || p.path != "" && !(p.runDir && p.runDirID == "")) {
+		return fmt.Errorf("profile: MaxAge and MaxRuns require a temporary directory or RunDir with a generated run id")
+	}
+	if p.runDir && p.inMemory() {
+		return fmt.Errorf("profile: RunDir cannot be combined with WriteTo or CaptureInMemory")
+	}
+	if p.capture && (p.w != nil || p.path != "" || p.fname != "") {
+		return fmt.Errorf("profile: CaptureInMemory cannot be combined with WriteTo, ProfilePath or ProfileFilename")
+	}
+	if (p.mode == AllMode || p.mode == DiagnosticMode) && (p.fname != "" || p.inMemory()) {
+		return fmt.Errorf("profile: %v profiling cannot be combined with ProfileFilename, WriteTo or CaptureInMemory", p.mode)
+	}
+	if p.traceSummary && (p.mode != TraceMode || p.inMemory()) {
+		return fmt.Errorf("profile: TraceSummary is only valid with TraceProfile written to a file")
+	}
+	if len(p.uploaders) == 0 && (p.uploadTimeout != 0 || p.uploadAsWritten) {
+		return fmt.Errorf("profile: UploadTimeout and UploadAsWritten require Upload")
+	}
+	if len(p.uploaders) > 0 && p.inMemory() {
+		return fmt.Errorf("profile: Upload cannot be combined with WriteTo or CaptureInMemory")
+	}
+	if p.archive && p.inMemory() {
+		return fmt.Errorf("profile: ArchiveOutput cannot be combined with WriteTo or CaptureInMemory")
+	}
+	if p.latestSymlink && p.inMemory() {
+		return fmt.Errorf("profile: LatestSymlink cannot be combined with WriteTo or CaptureInMemory")
+	}
+	if p.snapshotSignal != nil && p.inMemory() {
+		return fmt.Errorf("profile: SnapshotSignal cannot be combined with WriteTo or CaptureInMemory")
+	}
+	if p.heartbeat != nil && p.inMemory() {
+		return fmt.Errorf("profile: Watchdog cannot be combined with WriteTo or CaptureInMemory")
+	}
+	if p.progressInterval > 0 && p.inMemory() {
+		return fmt.Errorf("profile: ReportProgress cannot be combined with WriteTo or CaptureInMemory")
+	}
+	if len(p.rotateSignals) > 0 && p.inMemory() {
+		return fmt.Errorf("profile: RotateSignal cannot be combined with WriteTo or CaptureInMemory")
+	}
+	if p.manifest && p.inMemory() {
+		return fmt.Errorf("profile: Manifest cannot be combined with WriteTo or CaptureInMemory")
+	}
+	if p.expvar && p.inMemory() {
+		return fmt.Errorf("profile: ExpvarSnapshot cannot be combined with WriteTo or CaptureInMemory")
+	}
+	if p.memProfileBoth && (p.fname != "" || p.inMemory()) {
+		return fmt.Errorf("profile: MemProfileHeapAndAllocs cannot be combined with ProfileFilename, WriteTo or CaptureInMemory")
+	}
+	if p.mode != MemMode && (p.memProfileRate != 0 || p.memProfileType != "" || p.memProfileBoth) {
+		return fmt.Errorf("profile: memory profiling options are not valid with %v profiling", p.mode)
+	}
+	return nil
 }
 
+// Mode returns the kind of profiling performed by the session.
+func (p *Profile) Mode() Mode { return p.mode }
+
+// Enabled reports whether the session performs any profiling.
+func (p *Profile) Enabled() bool { return !p.disabled }
+
+// Dir returns the directory the session writes profiling files to.
+// It is empty if the session was configured with WriteTo.
+func (p *Profile) Dir() string { return p.dir }
+
+// Files returns the paths of the profiling files the session is
+// writing, or has written. Files are listed as soon as they are
+// created, although they are written to a temporary file, and so
+// may not exist, until complete unless NoAtomicWrites was given.
+func (p *Profile) Files() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]string(nil), p.files...)
+}
+
+// addFile records fn as a file written by the session.
+func (p *Profile) addFile(fn string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.files = append(p.files, fn)
+}
+
+// Done returns a channel that is closed once the session has been
+// stopped and its data flushed.
+func (p *Profile) Done() <-chan struct{} { return p.done }
+
+// Result describes the output of a stopped profiling session.
+type Result struct {
+	// Mode holds the kind of profiling performed by the session.
+	Mode Mode
+
+	// Files holds the paths of the profiling files written
+	// by the session.
+	Files []string
+
+	// Err holds the error, if any, encountered while writing
+	// or closing the profiling files.
+	Err error
+
+	// Overhead holds a rough estimate of the cost of the session.
+	Overhead Overhead
+
+	// Summary describes the session.
+	Summary Summary
+}
+
+// Result returns the outcome of the session. It is only
+// meaningful once Stop has returned.
+func (p *Profile) Result() Result { return p.result }
+
 // Stop stops the profile and flushes any unwritten data.
+// If Stop has already been called, it waits for the data
+// to be flushed. Any error encountered while writing the
+// profile is reported by Result.
 func (p *Profile) Stop() {
 	if !atomic.CompareAndSwapUint32(&p.stopped, 0, 1) {
 		// someone has already called close
+		<-p.done
 		return
 	}
-	p.closer()
-	atomic.StoreUint32(&started, 0)
+	if p.disabled || atomic.LoadUint32(&p.begun) == 0 || p.closer == nil {
+		// the session never collected a profile
+		p.result = Result{Mode: p.mode}
+		p.closeEvents()
+		close(p.done)
+		return
+	}
+	p.runMu.Lock()
+	p.stopPeaks()
+	err := p.flush()
+	elapsed := time.Since(p.started)
+	overhead := p.overhead(elapsed)
+	if p.err != nil {
+		err = p.err
+	}
+	if p.expvar {
+		if xerr := p.writeExpvar(); err == nil {
+			err = xerr
+		}
+	}
+	if p.manifest {
+		if merr := p.writeManifest(); err == nil {
+			err = merr
+		}
+	}
+	if p.archive {
+		if aerr := p.writeArchive(); err == nil {
+			err = aerr
+		}
+	}
+	if p.retention > 0 {
+		if rerr := p.retain(); err == nil {
+			err = rerr
+		}
+	}
+	if p.latestSymlink {
+		if lerr := p.updateSymlinks(); err == nil {
+			err = lerr
+		}
+	}
+	if len(p.uploaders) > 0 {
+		if uerr := p.upload(); err == nil {
+			err = uerr
+		}
+	}
+	files := p.Files()
+	p.result = Result{Mode: p.mode, Files: files, Err: err, Overhead: overhead, Summary: p.summary(files, elapsed)}
+	p.debugf("profile: %v session stopped after %v, %d files written", p.mode, time.Since(p.started).Round(time.Millisecond), len(p.result.Files))
+	p.debugf("profile: %v profiling overhead: %v", p.mode, overhead)
+	if p.logSummary {
+		p.logf("profile: %v session summary: %v", p.mode, p.result.Summary)
+	}
+	release(p.mode, p)
+	p.runMu.Unlock()
+	for _, fn := range p.onStop {
+		fn(p.result)
+	}
+	p.sendEvent(EventStopped, "", p.result.Err)
+	p.closeEvents()
+	close(p.done)
+}
+
+// Close stops the profile, like Stop, and returns any error
+// encountered writing it. Close allows a session to be used
+// wherever an io.Closer is expected.
+func (p *Profile) Close() error {
+	p.Stop()
+	return p.result.Err
+}
+
+// flush stops collecting the session's current profile and
+// writes it out.
+func (p *Profile) flush() error {
+	err := p.closer()
+	p.closer = func() error { return nil }
+	if err != nil {
+		p.logAttrs(fmt.Sprintf("profile: could not write %v profile", p.mode), "error", err)
+		err = fmt.Errorf("profile: could not write %v profile: %v", p.mode, err)
+	}
+	return err
+}
+
+// SwitchMode stops collecting the session's current profile, writing
+// it out as if the session had been stopped, and starts collecting a
+// profile of the given mode in its own file. This allows a long
+// running program to change what it is profiling without restarting.
+// If the session was configured with ProfileFilename, the new profile
+// is written to the default filename for its mode. SwitchMode cannot
+// be used with sessions configured with WriteTo.
+func (p *Profile) SwitchMode(mode Mode) error {
+	p.runMu.Lock()
+	defer p.runMu.Unlock()
+	if atomic.LoadUint32(&p.stopped) != 0 {
+		return errStopped
+	}
+	if atomic.LoadUint32(&p.begun) == 0 {
+		return fmt.Errorf("profile: SwitchMode() called before Begin()")
+	}
+	if p.w != nil {
+		return fmt.Errorf("profile: cannot switch mode of a session configured with WriteTo")
+	}
+	if !mode.valid() {
+		return fmt.Errorf("profile: unknown mode %v", mode)
+	}
+	if mode == p.mode || p.disabled {
+		p.mode = mode
+		return nil
+	}
+
+	if err := acquire(mode, p); err != nil {
+		return err
+	}
+	if err := p.flush(); err != nil && p.err == nil {
+		p.err = err
+	}
+	release(p.mode, p)
+
+	p.mode, p.fname, p.fnameTemplate, p.cpu = mode, "", false, nil
+	if mode == MemMode && p.memProfileRate == 0 {
+		p.memProfileRate = DefaultMemProfileRate
+	}
+	if err := p.start(); err != nil {
+		release(mode, p)
+		return err
+	}
+	p.startBackground()
+	return nil
+}
+
+// blockProfileRate records the last rate passed to setBlockProfileRate.
+// The runtime does not report the current block profile rate, so
+// sessions assume it was disabled before the package changed it.
+var blockProfileRate int32
+
+// setBlockProfileRate sets the block profile rate, returning the
+// previous rate set by this package.
+func setBlockProfileRate(rate int) int {
+	runtime.SetBlockProfileRate(rate)
+	return int(atomic.SwapInt32(&blockProfileRate, int32(rate)))
+}
+
+// writeLookup writes the named runtime profile to w, in the format
+// selected for the session, and closes it.
+func (p *Profile) writeLookup(w io.WriteCloser, name string) error {
+	var err error
+	if lp := pprof.Lookup(name); lp != nil {
+		if d, ok := w.(*dualOutput); ok {
+			err = d.write(lp, p.debug)
+		} else {
+			err = lp.WriteTo(w, p.debug)
+		}
+	}
+	if cerr := w.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+var (
+	// mu protects active.
+	mu sync.Mutex
+
+	// active holds the running profiling session for each mode,
+	// keyed by Profile.key.
+	active = make(map[string]*Profile)
+)
+
+// acquire records p as the running session for mode. Sessions
+// using different modes may run concurrently, but only one session
+// per mode may be active at a time.
+func acquire(mode Mode, p *Profile) error {
+	mu.Lock()
+	defer mu.Unlock()
+	key := p.key(mode)
+	if _, ok := active[key]; ok {
+		return fmt.Errorf("profile: Start() already called")
+	}
+	active[key] = p
+	return nil
+}
+
+// key identifies the resource used by p when profiling mode.
+// Custom profiles are identified by name, so sessions writing
+// different custom profiles may run concurrently.
+func (p *Profile) key(mode Mode) string {
+	if mode == CustomMode {
+		return "custom:" + p.customProfile
+	}
+	return mode.String()
+}
+
+// release removes p as the running session for mode.
+func release(mode Mode, p *Profile) {
+	mu.Lock()
+	defer mu.Unlock()
+	key := p.key(mode)
+	if active[key] == p {
+		delete(active, key)
+	}
 }
 
-// started is non zero if a profile is running.
-var started uint32
+// running returns the sessions that are currently running.
+func running() []*Profile {
+	mu.Lock()
+	defer mu.Unlock()
+	var sessions []*Profile
+	for _, p := range active {
+		sessions = append(sessions, p)
+	}
+	return sessions
+}
+
+// StopActive stops all running profiling sessions and flushes their
+// data. It allows profiling started in one part of a program to be
+// stopped in another without passing the session around. StopActive
+// does nothing if no sessions are running.
+func StopActive() {
+	for _, p := range running() {
+		p.Stop()
+	}
+}
 
 // Start starts a new profiling session.
 // The caller should call the Stop method on the value returned
 // to cleanly stop profiling.
-func Start(options ...func(*Profile)) interface {
-	Stop()
-} {
-	if !atomic.CompareAndSwapUint32(&started, 0, 1) {
-		log.Fatal("profile: Start() already called")
+// Start calls log.Fatal if the session cannot be started, unless
+// OnError is given, use StartErr to handle the error instead, or
+// MustStart to panic.
+func Start(options ...Option) *Profile {
+	prof, err := StartErr(options...)
+	if err != nil {
+		if onError := errorHandlers(options); len(onError) > 0 {
+			for _, fn := range onError {
+				fn(err)
+			}
+			prof, _ = configure(Enabled(false))
+			return prof
+		}
+		log.Fatal(err)
 	}
+	return prof
+}
 
-	var prof Profile
+// errorHandlers returns the functions registered by OnError among
+// options, even if the options are invalid.
+func errorHandlers(options []Option) []func(error) {
+	var p Profile
 	for _, option := range options {
-		option(&prof)
+		option(&p)
 	}
+	return p.onError
+}
 
-	if prof.fname != "" && filepath.Base(prof.fname) != prof.fname {
-		log.Fatalf("profile: filename must not contain path elements")
+// MustStart is like StartErr but panics if the session cannot be
+// started. Unlike Start, which exits the program, the panic may be
+// recovered by the caller.
+func MustStart(options ...Option) *Profile {
+	prof, err := StartErr(options...)
+	if err != nil {
+		panic(err)
 	}
+	return prof
+}
 
-	fname := func(defaultName string) string {
-		if prof.fname != "" {
-			return prof.fname
-		}
-		return defaultName
+// StartErr starts a new profiling session, returning an error if
+// the output directory or profile file could not be created.
+// The caller should call the Stop method on the value returned
+// to cleanly stop profiling.
+//
+// Sessions profiling different modes, for example a goroutine
+// profile and a cpu profile, may run concurrently. Starting a
+// second session for a mode that is already being profiled
+// returns an error. Once a session has been stopped another may
+// be started for the same mode; any runtime profiling rates
+// changed by a session are restored when it stops.
+func StartErr(options ...Option) (*Profile, error) {
+	prof, err := New(options...)
+	if err != nil {
+		return nil, err
+	}
+	if len(prof.toggleSignals) > 0 && !prof.disabled {
+		prof.beginOnSignal()
+		return prof, nil
+	}
+	if err := prof.Begin(); err != nil {
+		return nil, err
+	}
+	return prof, nil
+}
+
+// New prepares a profiling session without starting it. The options
+// are validated and the output directory is created, but no profile
+// is collected until Begin is called. This allows a program to
+// configure profiling during initialisation and begin collection
+// once it has reached a steady state.
+func New(options ...Option) (*Profile, error) {
+	prof, err := configure(options...)
+	if err != nil {
+		return nil, err
 	}
+	if prof.disabled {
+		return prof, nil
+	}
+	if err := prof.prepare(); err != nil {
+		return nil, err
+	}
+	return prof, nil
+}
 
-	path, err := func() (string, error) {
-		if p := prof.path; p != "" {
-			return p, os.MkdirAll(p, 0777)
+// configure returns a session with the given options applied, or
+// an error if they are not valid.
+func configure(options ...Option) (*Profile, error) {
+	prof := &Profile{done: make(chan struct{}), events: make(chan Event, eventBuffer+1)}
+	for _, option := range options {
+		if err := option(prof); err != nil {
+			return nil, err
 		}
-		return ioutil.TempDir("", "profile")
-	}()
+	}
+	if err := prof.validate(); err != nil {
+		return nil, err
+	}
+	return prof, nil
+}
+
+// Begin starts collecting the profile for a session returned by New.
+// Begin may only be called once per session, and must not be
+// called concurrently with Stop.
+func (p *Profile) Begin() error {
+	if !atomic.CompareAndSwapUint32(&p.begun, 0, 1) {
+		return fmt.Errorf("profile: Begin() already called")
+	}
+	if atomic.LoadUint32(&p.stopped) != 0 {
+		return errStopped
+	}
+	if p.disabled {
+		return nil
+	}
+
+	if err := acquire(p.mode, p); err != nil {
+		return err
+	}
+	p.started = time.Now()
+	p.startOverhead()
+	if err := p.start(); err != nil {
+		release(p.mode, p)
+		return err
+	}
+	p.startBackground()
+	p.startPeaks()
+	atomic.AddInt64(&stats.sessions, 1)
+	var first string
+	if files := p.Files(); len(files) > 0 {
+		first = files[0]
+	}
+	p.sendEvent(EventStarted, first, nil)
+	publishOnce.Do(publishExpvar)
+	if len(p.rotateSignals) > 0 {
+		p.rotateOnSignal()
+	}
+	p.setLabels()
+
+	if !p.noShutdownHook {
+		installShutdownHook(p.shutdownSignals(), p.shutdownNotify)
+	}
+	for _, fn := range p.onStart {
+		fn(p)
+	}
+	if p.duration > 0 {
+		go p.stopAfter(p.duration)
+	}
+	return nil
+}
+
+// stopAfter stops the session once d has elapsed, unless it has
+// already been stopped.
+func (p *Profile) stopAfter(d time.Duration) {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		p.logf("profile: session duration of %v elapsed", d)
+		p.Stop()
+	case <-p.done:
+	}
+}
+
+// startBackground starts the work performed alongside collecting the
+// session's profile, which is stopped by p.closer.
+func (p *Profile) startBackground() {
+	if p.snapshotSignal != nil {
+		p.startSignalSnapshots()
+	}
+	if p.heartbeat != nil {
+		p.startWatchdog()
+	}
+	if p.progressInterval > 0 {
+		p.startProgress()
+	}
+}
+
+// StartWithContext starts a new profiling session which is stopped
+// automatically when ctx is done. The session may also be stopped
+// explicitly by calling its Stop method. Callers that need to wait
+// for the profile to be flushed after ctx is cancelled should
+// receive from the channel returned by the session's Done method.
+func StartWithContext(ctx context.Context, options ...Option) (*Profile, error) {
+	prof, err := StartErr(options...)
 	if err != nil {
-		log.Fatalf("profile: could not create initial output directory: %v", err)
+		return nil, err
 	}
+	go func() {
+		select {
+		case <-ctx.Done():
+			prof.Stop()
+		case <-prof.done:
+		}
+	}()
+	return prof, nil
+}
 
-	logf := func(format string, args ...interface{}) {
-		if !prof.quiet {
-			log.Printf(format, args...)
+// prepare creates the output directory for the session.
+func (prof *Profile) prepare() error {
+	if !prof.inMemory() {
+		path, err := func() (string, error) {
+			if p := prof.path; p != "" {
+				return p, os.MkdirAll(p, prof.dirMode())
+			}
+			pattern := prof.tempPattern
+			if pattern == "" {
+				pattern = "profile"
+			}
+			if prof.tempParent != "" {
+				if err := os.MkdirAll(prof.tempParent, prof.dirMode()); err != nil {
+					return "", err
+				}
+			}
+			dir, err := ioutil.TempDir(prof.tempParent, pattern)
+			if err == nil && prof.dirPerm != 0 {
+				err = os.Chmod(dir, prof.dirPerm)
+			}
+			return dir, err
+		}()
+		if err == nil && prof.runDir {
+			path = filepath.Join(path, prof.runID())
+			err = os.MkdirAll(path, prof.dirMode())
+		}
+		if err != nil {
+			return fmt.Errorf("profile: could not create initial output directory: %v", err)
+		}
+		prof.dir = path
+		prof.debugf("profile: writing profiles to %s", prof.dir)
+		if prof.pruneAge > 0 || prof.pruneRuns > 0 {
+			if err := prof.pruneDirs(); err != nil {
+				prof.logAttrs("profile: could not remove old profile directories", "error", err)
+			}
 		}
 	}
 
 	if prof.memProfileType == "" {
 		prof.memProfileType = "heap"
 	}
+	return nil
+}
 
+// start creates the output file for the session and enables profiling.
+func (prof *Profile) start() error {
 	switch prof.mode {
-	case cpuMode:
-		fn := filepath.Join(path, fname("cpu.pprof"))
-		f, err := os.Create(fn)
+	case CPUMode:
+		if prof.cpuChunkInterval > 0 {
+			return prof.startCPUChunks()
+		}
+		w, fn, err := prof.create("cpu.pprof")
 		if err != nil {
-			log.Fatalf("profile: could not create cpu profile %q: %v", fn, err)
+			return fmt.Errorf("profile: could not create cpu profile %q: %v", fn, err)
 		}
-		logf("profile: cpu profiling enabled, %s", fn)
-		pprof.StartCPUProfile(f)
-		prof.closer = func() {
-			pprof.StopCPUProfile()
-			f.Close()
-			logf("profile: cpu profiling disabled, %s", fn)
+		cpu := newCPUProfile(w, prof.cpuProfileRate)
+		if err := cpu.start(); err != nil {
+			w.Close()
+			return fmt.Errorf("profile: could not start cpu profile: %v", err)
+		}
+		prof.cpu = cpu
+		prof.logAttrs("profile: cpu profiling enabled", "path", fn)
+		prof.closer = func() error {
+			err := cpu.stop()
+			if cerr := w.Close(); err == nil {
+				err = cerr
+			}
+			prof.logAttrs("profile: cpu profiling disabled", "path", fn)
+			return err
 		}
 
-	case memMode:
-		fn := filepath.Join(path, fname("mem.pprof"))
-		f, err := os.Create(fn)
+	case MemMode:
+		if prof.memProfileBoth {
+			return prof.startMemBoth()
+		}
+		w, fn, err := prof.createLookup("mem")
 		if err != nil {
-			log.Fatalf("profile: could not create memory profile %q: %v", fn, err)
+			return fmt.Errorf("profile: could not create memory profile %q: %v", fn, err)
 		}
 		old := runtime.MemProfileRate
 		runtime.MemProfileRate = prof.memProfileRate
-		logf("profile: memory profiling enabled (rate %d), %s", runtime.MemProfileRate, fn)
-		prof.closer = func() {
-			pprof.Lookup(prof.memProfileType).WriteTo(f, 0)
-			f.Close()
+		prof.logAttrs("profile: memory profiling enabled", "rate", runtime.MemProfileRate, "path", fn)
+		prof.closer = func() error {
+			err := prof.writeLookup(w, prof.memProfileType)
 			runtime.MemProfileRate = old
-			logf("profile: memory profiling disabled, %s", fn)
+			prof.logAttrs("profile: memory profiling disabled", "path", fn)
+			return err
 		}
 
-	case mutexMode:
-		fn := filepath.Join(path, fname("mutex.pprof"))
-		f, err := os.Create(fn)
+	case MutexMode:
+		w, fn, err := prof.createLookup("mutex")
 		if err != nil {
-			log.Fatalf("profile: could not create mutex profile %q: %v", fn, err)
+			return fmt.Errorf("profile: could not create mutex profile %q: %v", fn, err)
 		}
-		runtime.SetMutexProfileFraction(1)
-		logf("profile: mutex profiling enabled, %s", fn)
-		prof.closer = func() {
-			if mp := pprof.Lookup("mutex"); mp != nil {
-				mp.WriteTo(f, 0)
-			}
-			f.Close()
-			runtime.SetMutexProfileFraction(0)
-			logf("profile: mutex profiling disabled, %s", fn)
+		old := runtime.SetMutexProfileFraction(orOne(prof.mutexProfileFraction))
+		prof.logAttrs("profile: mutex profiling enabled", "path", fn)
+		prof.closer = func() error {
+			err := prof.writeLookup(w, "mutex")
+			runtime.SetMutexProfileFraction(old)
+			prof.logAttrs("profile: mutex profiling disabled", "path", fn)
+			return err
 		}
 
-	case blockMode:
-		fn := filepath.Join(path, fname("block.pprof"))
-		f, err := os.Create(fn)
+	case BlockMode:
+		w, fn, err := prof.createLookup("block")
 		if err != nil {
-			log.Fatalf("profile: could not create block profile %q: %v", fn, err)
+			return fmt.Errorf("profile: could not create block profile %q: %v", fn, err)
 		}
-		runtime.SetBlockProfileRate(1)
-		logf("profile: block profiling enabled, %s", fn)
-		prof.closer = func() {
-			pprof.Lookup("block").WriteTo(f, 0)
-			f.Close()
-			runtime.SetBlockProfileRate(0)
-			logf("profile: block profiling disabled, %s", fn)
+		old := setBlockProfileRate(orOne(prof.blockProfileRate))
+		prof.logAttrs("profile: block profiling enabled", "path", fn)
+		prof.closer = func() error {
+			err := prof.writeLookup(w, "block")
+			setBlockProfileRate(old)
+			prof.logAttrs("profile: block profiling disabled", "path", fn)
+			return err
 		}
 
-	case threadCreateMode:
-		fn := filepath.Join(path, fname("threadcreation.pprof"))
-		f, err := os.Create(fn)
+	case ThreadCreateMode:
+		w, fn, err := prof.createLookup("threadcreation")
 		if err != nil {
-			log.Fatalf("profile: could not create thread creation profile %q: %v", fn, err)
+			return fmt.Errorf("profile: could not create thread creation profile %q: %v", fn, err)
 		}
-		logf("profile: thread creation profiling enabled, %s", fn)
-		prof.closer = func() {
-			if mp := pprof.Lookup("threadcreate"); mp != nil {
-				mp.WriteTo(f, 0)
-			}
-			f.Close()
-			logf("profile: thread creation profiling disabled, %s", fn)
+		prof.logAttrs("profile: thread creation profiling enabled", "path", fn)
+		prof.closer = func() error {
+			err := prof.writeLookup(w, "threadcreate")
+			prof.logAttrs("profile: thread creation profiling disabled", "path", fn)
+			return err
 		}
 
-	case traceMode:
-		fn := filepath.Join(path, fname("trace.out"))
-		f, err := os.Create(fn)
+	case TraceMode:
+		w, fn, err := prof.create("trace.out")
 		if err != nil {
-			log.Fatalf("profile: could not create trace output file %q: %v", fn, err)
+			return fmt.Errorf("profile: could not create trace output file %q: %v", fn, err)
 		}
-		if err := trace.Start(f); err != nil {
-			log.Fatalf("profile: could not start trace: %v", err)
+		if err := trace.Start(w); err != nil {
+			w.Close()
+			return fmt.Errorf("profile: could not start trace: %v", err)
 		}
-		logf("profile: trace enabled, %s", fn)
-		prof.closer = func() {
+		prof.logAttrs("profile: trace enabled", "path", fn)
+		prof.closer = func() error {
 			trace.Stop()
-			logf("profile: trace disabled, %s", fn)
+			err := w.Close()
+			prof.logAttrs("profile: trace disabled", "path", fn)
+			return err
+		}
+		if prof.traceSummary {
+			if err := prof.startTraceSummary(); err != nil {
+				prof.flush()
+				return err
+			}
 		}
 
-	case goroutineMode:
-		fn := filepath.Join(path, fname("goroutine.pprof"))
-		f, err := os.Create(fn)
+	case GoroutineMode:
+		w, fn, err := prof.createLookup("goroutine")
 		if err != nil {
-			log.Fatalf("profile: could not create goroutine profile %q: %v", fn, err)
+			return fmt.Errorf("profile: could not create goroutine profile %q: %v", fn, err)
+		}
+		prof.logAttrs("profile: goroutine profiling enabled", "path", fn)
+		prof.closer = func() error {
+			err := prof.writeLookup(w, "goroutine")
+			prof.logAttrs("profile: goroutine profiling disabled", "path", fn)
+			return err
 		}
-		logf("profile: goroutine profiling enabled, %s", fn)
-		prof.closer = func() {
-			if mp := pprof.Lookup("goroutine"); mp != nil {
-				mp.WriteTo(f, 0)
+
+	case HeapDumpMode:
+		return prof.startHeapDump()
+
+	case GCTraceMode:
+		return prof.startGCTrace()
+
+	case FlightRecorderMode:
+		return prof.startFlightRecorder()
+
+	case AllMode:
+		return prof.startAll()
+
+	case DiagnosticMode:
+		return prof.startDiagnostic()
+
+	case MemStatsMode:
+		return prof.startMemStats()
+
+	case CustomMode:
+		p := pprof.Lookup(prof.customProfile)
+		if p == nil {
+			return fmt.Errorf("profile: unknown profile %q", prof.customProfile)
+		}
+		name := strings.Replace(prof.customProfile, string(filepath.Separator), "_", -1)
+		w, fn, err := prof.createLookup(name)
+		if err != nil {
+			return fmt.Errorf("profile: could not create %s profile %q: %v", prof.customProfile, fn, err)
+		}
+		prof.logAttrs("profile: "+prof.customProfile+" profiling enabled", "name", prof.customProfile, "path", fn)
+		prof.closer = func() error {
+			err := prof.writeLookup(w, prof.customProfile)
+			prof.logAttrs("profile: "+prof.customProfile+" profiling disabled", "name", prof.customProfile, "path", fn)
+			return err
+		}
+	}
+
+	if prof.snapshotInterval > 0 {
+		prof.startSnapshots()
+	}
+	return nil
+}
+
+// startMemBoth starts a memory profile which writes both heap
+// and allocs profiles.
+func (prof *Profile) startMemBoth() error {
+	var ws []io.WriteCloser
+	var fns []string
+	for _, name := range []string{"heap", "allocs"} {
+		w, fn, err := prof.createLookup(name)
+		if err != nil {
+			for _, w := range ws {
+				w.Close()
 			}
+			return fmt.Errorf("profile: could not create memory profile %q: %v", fn, err)
+		}
+		ws, fns = append(ws, w), append(fns, fn)
+	}
+	old := runtime.MemProfileRate
+	runtime.MemProfileRate = prof.memProfileRate
+	prof.logAttrs("profile: memory profiling enabled", "rate", runtime.MemProfileRate, "path", fns)
+	prof.closer = func() error {
+		err := prof.writeLookup(ws[0], "heap")
+		if aerr := prof.writeLookup(ws[1], "allocs"); err == nil {
+			err = aerr
+		}
+		runtime.MemProfileRate = old
+		prof.logAttrs("profile: memory profiling disabled", "path", fns)
+		return err
+	}
+	return nil
+}
+
+// lookup reports whether profiles of mode m are obtained with
+// pprof.Lookup, and so can be written in text format.
+func (m Mode) lookup() bool {
+	switch m {
+	case MemMode, MutexMode, BlockMode, ThreadCreateMode, GoroutineMode, CustomMode, AllMode:
+		return true
+	}
+	return false
+}
+
+// lookupFilename returns the default filename for the named profile
+// obtained from pprof.Lookup. Profiles written in a text format, with
+// a non zero debug level, use the .txt extension.
+func (p *Profile) lookupFilename(name string) string {
+	if p.debug > 0 {
+		return name + ".txt"
+	}
+	return name + ".pprof"
+}
+
+// timestampLayout is the layout of the times added to filenames.
+const timestampLayout = "20060102T150405Z"
+
+// outputName returns the name of the file called name written by
+// the session, adding the time the session began, or its profile was
+// last rotated, if Timestamp was given, for example cpu.pprof becomes
+// cpu-20060102T150405Z.pprof.
+// Sessions started by a Trigger also have the trigger's name added,
+// for example cpu-cpuabove-20060102T150405Z.pprof.
+func (p *Profile) outputName(name string) string {
+	if !p.timestamp {
+		return name
+	}
+	ext := filepath.Ext(name)
+	name = strings.TrimSuffix(name, ext)
+	if p.trigger != "" {
+		name += "-" + p.trigger
+	}
+	return name + "-" + p.fileTime().UTC().Format(timestampLayout) + ext
+}
+
+// fileTime returns the time added to the names of the session's
+// files by Timestamp.
+func (p *Profile) fileTime() time.Time {
+	if !p.rotated.IsZero() {
+		return p.rotated
+	}
+	return p.started
+}
+
+// create opens the destination of the session's profile, returning
+// it along with a description of the destination for log messages.
+// If the session was configured with WriteTo, the profile is written
+// to the caller's writer, which is not closed when the session stops,
+// and if configured with CaptureInMemory, to a buffer.
+func (prof *Profile) create(defaultName string) (io.WriteCloser, string, error) {
+	if prof.w != nil {
+		return prof.withBuildInfo(nopCloser{prof.w}, defaultName), "io.Writer", nil
+	}
+	if prof.capture {
+		return prof.withBuildInfo(nopCloser{prof.captureBuffer()}, defaultName), "memory", nil
+	}
+	name := prof.outputName(defaultName)
+	if prof.fnameTemplate {
+		name = prof.expandTemplate(prof.fname)
+	} else if prof.fname != "" {
+		name = prof.fname
+	}
+	fn := filepath.Join(prof.dir, name)
+	f, err := prof.createFile(fn)
+	if err != nil {
+		return nil, fn, err
+	}
+	prof.addFile(fn)
+	return prof.withBuildInfo(f, defaultName), fn, nil
+}
+
+// createFile creates or truncates the named file, with the mode
+// given by ProfileFileMode. Unless NoAtomicWrites was given, the data
+// is written to a temporary file which is renamed to fn when closed,
+// so that fn never holds a partially written profile.
+func (p *Profile) createFile(fn string) (*outputFile, error) {
+	mode := p.fileMode
+	if mode == 0 {
+		mode = 0666
+	}
+	name := fn
+	if !p.noAtomicWrites {
+		name = fn + ".tmp"
+	}
+	f, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, mode)
+	if err != nil {
+		return nil, err
+	}
+	if p.fileMode != 0 {
+		// the file may have existed with a different mode
+		if err := f.Chmod(p.fileMode); err != nil {
 			f.Close()
-			logf("profile: goroutine profiling disabled, %s", fn)
+			return nil, err
 		}
 	}
+	out := &outputFile{File: f, p: p}
+	if !p.noAtomicWrites {
+		out.rename = fn
+	}
+	return out, nil
+}
 
-	if !prof.noShutdownHook {
-		go func() {
-			c := make(chan os.Signal, 1)
-			signal.Notify(c, os.Interrupt)
-			<-c
+// outputFile is a file written by the session.
+type outputFile struct {
+	*os.File
 
-			log.Println("profile: caught interrupt, stopping profiles")
-			prof.Stop()
+	// p holds the session writing the file.
+	p *Profile
 
-			os.Exit(0)
-		}()
+	// rename holds the name the file is renamed to when closed,
+	// if it is being written to a temporary file.
+	rename string
+}
+
+// discard closes and removes the file, which was not written
+// completely.
+func (f *outputFile) discard() {
+	f.File.Close()
+	os.Remove(f.Name())
+}
+
+// Close closes the file, renaming it into place if it was written
+// to a temporary file. If the file could not be closed it is removed.
+func (f *outputFile) Close() error {
+	var size int64
+	if fi, err := f.File.Stat(); err == nil {
+		size = fi.Size()
 	}
+	name := f.Name()
+	err := f.File.Close()
+	if f.rename != "" {
+		if err != nil {
+			os.Remove(name)
+			return err
+		}
+		name = f.rename
+		err = os.Rename(f.Name(), name)
+	}
+	if err != nil {
+		return err
+	}
+	atomic.AddInt64(&stats.bytesWritten, size)
+	for _, fn := range f.p.onWritten {
+		fn(name, f.p.mode.String(), size)
+	}
+	if f.p.uploadAsWritten {
+		f.p.uploadWritten(name)
+	}
+	return nil
+}
+
+// dirMode returns the mode of directories created by the session.
+func (p *Profile) dirMode() os.FileMode {
+	if p.dirPerm == 0 {
+		return 0777
+	}
+	return p.dirPerm
+}
 
-	return &prof
+// nopCloser adapts an io.Writer to an io.WriteCloser.
+type nopCloser struct {
+	io.Writer
 }
+
+func (nopCloser) Close() error { return nil }
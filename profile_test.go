@@ -3,13 +3,22 @@ package profile
 import (
 	"bufio"
 	"bytes"
+	"encoding/json"
+	"errors"
+	"expvar"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"reflect"
+	"runtime"
+	"sort"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 type checkFn func(t *testing.T, stdout, stderr []byte, err error)
@@ -96,6 +105,29 @@ func main() {
 			Stderr("cpu profiling enabled", "profile: Start() already called"),
 			Err,
 		},
+	}, {
+		name: "concurrent sessions",
+		code: `
+package main
+
+import "github.com/pkg/profile"
+
+func main() {
+	defer profile.Start(profile.GoroutineProfile).Stop()
+	profile.Start(profile.CPUProfile).Stop()
+	profile.Start(profile.CPUProfile).Stop()
+}
+`,
+		checks: []checkFn{
+			NoStdout,
+			Stderr("profile: goroutine profiling enabled",
+				"profile: cpu profiling enabled",
+				"profile: cpu profiling disabled",
+				"profile: cpu profiling enabled",
+				"profile: cpu profiling disabled",
+				"profile: goroutine profiling disabled"),
+			NoErr,
+		},
 	}, {
 		name: "block profile",
 		code: `
@@ -161,108 +193,1781 @@ func main() {
 			Err,
 		},
 	}, {
-		name: "multiple profile sessions",
+		name: "start error",
 		code: `
 package main
 
-import "github.com/pkg/profile"
+import (
+	"fmt"
+
+	"github.com/pkg/profile"
+)
 
 func main() {
-	profile.Start(profile.CPUProfile).Stop()
-	profile.Start(profile.MemProfile).Stop()
-	profile.Start(profile.BlockProfile).Stop()
-	profile.Start(profile.CPUProfile).Stop()
-	profile.Start(profile.MutexProfile).Stop()
+	_, err := profile.StartErr(profile.ProfilePath("` + f.Name() + `"))
+	fmt.Println(err)
+}
+`,
+		checks: []checkFn{
+			Stdout("profile: could not create initial output directory"),
+			NoStderr,
+			NoErr,
+		},
+	}, {
+		name: "session mode and dir",
+		code: `
+package main
+
+import (
+	"fmt"
+
+	"github.com/pkg/profile"
+)
+
+func main() {
+	p := profile.Start(profile.BlockProfile, profile.ProfilePath("` + d + `"), profile.Quiet)
+	defer p.Stop()
+	fmt.Println(p.Mode(), p.Dir())
+}
+`,
+		checks: []checkFn{
+			Stdout("block " + d),
+			NoStderr,
+			NoErr,
+		},
+	}, {
+		name: "start with context",
+		code: `
+package main
+
+import (
+	"context"
+	"log"
+
+	"github.com/pkg/profile"
+)
+
+func main() {
+	ctx, cancel := context.WithCancel(context.Background())
+	p, err := profile.StartWithContext(ctx, profile.MemProfile)
+	if err != nil {
+		log.Fatal(err)
+	}
+	cancel()
+	<-p.Done()
 }
 `,
 		checks: []checkFn{
 			NoStdout,
-			Stderr("profile: cpu profiling enabled",
-				"profile: cpu profiling disabled",
-				"profile: memory profiling enabled",
-				"profile: memory profiling disabled",
-				"profile: block profiling enabled",
-				"profile: block profiling disabled",
-				"profile: cpu profiling enabled",
-				"profile: cpu profiling disabled",
-				"profile: mutex profiling enabled",
-				"profile: mutex profiling disabled"),
+			Stderr("profile: memory profiling enabled",
+				"profile: memory profiling disabled"),
 			NoErr,
 		},
 	}, {
-		name: "profile quiet",
+		name: "session result",
 		code: `
 package main
 
-import "github.com/pkg/profile"
+import (
+	"fmt"
+
+	"github.com/pkg/profile"
+)
 
 func main() {
-        defer profile.Start(profile.Quiet).Stop()
+	p := profile.Start(profile.GoroutineProfile, profile.ProfilePath("` + d + `"), profile.Quiet)
+	p.Stop()
+	r := p.Result()
+	fmt.Println(r.Files, r.Err)
 }
 `,
-		checks: []checkFn{NoStdout, NoStderr, NoErr},
+		checks: []checkFn{
+			Stdout("[" + filepath.Join(d, "goroutine.pprof") + "] <nil>"),
+			NoStderr,
+			NoErr,
+		},
 	}, {
-		name: "profile filename",
+		name: "pause and resume cpu profile",
 		code: `
 package main
 
-import "github.com/pkg/profile"
+import (
+	"log"
+
+	"github.com/pkg/profile"
+)
 
 func main() {
-	defer profile.Start(profile.ProfileFilename("cpu.out")).Stop()
+	p := profile.Start(profile.CPUProfile)
+	defer p.Stop()
+	if err := p.Pause(); err != nil {
+		log.Fatal(err)
+	}
+	if err := p.Resume(); err != nil {
+		log.Fatal(err)
+	}
 }
 `,
 		checks: []checkFn{
 			NoStdout,
-			Stderr("/cpu.out"),
+			Stderr("profile: cpu profiling enabled",
+				"profile: cpu profiling paused",
+				"profile: cpu profiling resumed",
+				"profile: cpu profiling disabled"),
 			NoErr,
 		},
 	}, {
-		name: "profile filename error",
+		name: "pause memory profile",
 		code: `
 package main
 
-import "github.com/pkg/profile"
+import (
+	"log"
+
+	"github.com/pkg/profile"
+)
 
 func main() {
-		defer profile.Start(profile.ProfileFilename("../name")).Stop()
+	p := profile.Start(profile.MemProfile)
+	defer p.Stop()
+	if err := p.Pause(); err != nil {
+		log.Fatal(err)
+	}
 }
 `,
 		checks: []checkFn{
 			NoStdout,
-			Stderr(" filename must not contain path elements"),
+			Stderr("profile: memory profiling enabled",
+				"profile: cannot pause mem profile"),
 			Err,
 		},
 	}, {
-		name: "profile filename and path",
+		name: "start and stop hooks",
+		code: `
+package main
+
+import (
+	"fmt"
+
+	"github.com/pkg/profile"
+)
+
+func main() {
+	defer profile.Start(profile.MutexProfile, profile.Quiet,
+		profile.OnStart(func(p *profile.Profile) { fmt.Println("started", p.Mode()) }),
+		profile.OnStop(func(r profile.Result) { fmt.Println("stopped", r.Mode, len(r.Files), r.Err) }),
+	).Stop()
+}
+`,
+		checks: []checkFn{
+			Stdout("started mutex", "stopped mutex 1 <nil>"),
+			NoStderr,
+			NoErr,
+		},
+	}, {
+		name: "disabled profile",
 		code: `
 package main
 
 import "github.com/pkg/profile"
 
 func main() {
-	defer profile.Start(profile.ProfileFilename("cpu.out"),profile.ProfilePath("` + d + `")).Stop()
+	p := profile.Start(profile.Enabled(false))
+	defer p.Stop()
+	if err := p.Pause(); err != nil {
+		panic(err)
+	}
+	profile.Start(profile.CPUProfile).Stop()
 }
 `,
 		checks: []checkFn{
 			NoStdout,
-			Stderr("profile: cpu profiling enabled, " + d + "/cpu.out"),
+			Stderr("profile: cpu profiling enabled", "profile: cpu profiling disabled"),
 			NoErr,
 		},
-	}}
-	for _, tt := range profileTests {
-		t.Log(tt.name)
-		stdout, stderr, err := runTest(t, tt.code)
-		for _, f := range tt.checks {
-			f(t, stdout, stderr, err)
-		}
+	}, {
+		name: "must start",
+		code: `
+package main
+
+import (
+	"fmt"
+
+	"github.com/pkg/profile"
+)
+
+func main() {
+	defer func() {
+		fmt.Println("recovered:", recover())
+	}()
+	profile.MustStart(profile.ProfileFilename("../name"))
+}
+`,
+		checks: []checkFn{
+			Stdout("recovered: profile: filename must not contain path elements"),
+			NoStderr,
+			NoErr,
+		},
+	}, {
+		name: "session files",
+		code: `
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/pkg/profile"
+)
+
+func main() {
+	p := profile.Start(profile.TraceProfile, profile.Quiet)
+	defer os.RemoveAll(p.Dir())
+	files := p.Files()
+	p.Stop()
+	for _, fn := range files {
+		_, err := os.Stat(fn)
+		fmt.Println(fn == p.Dir()+"/trace.out", err)
 	}
 }
+`,
+		checks: []checkFn{
+			Stdout("true <nil>"),
+			NoStderr,
+			NoErr,
+		},
+	}, {
+		name: "stop active",
+		code: `
+package main
 
-// NoStdout checks that stdout was blank.
-func NoStdout(t *testing.T, stdout, _ []byte, _ error) {
-	if len := len(stdout); len > 0 {
-		t.Errorf("stdout: wanted 0 bytes, got %d", len)
+import "github.com/pkg/profile"
+
+func main() {
+	profile.StopActive()
+	profile.Start(profile.CPUProfile)
+	profile.StopActive()
+	profile.StopActive()
+}
+`,
+		checks: []checkFn{
+			NoStdout,
+			Stderr("profile: cpu profiling enabled", "profile: cpu profiling disabled"),
+			NoErr,
+		},
+	}, {
+		name: "heap dump",
+		code: `
+package main
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+	"time"
+
+	"github.com/pkg/profile"
+)
+
+func main() {
+	p := profile.Start(profile.HeapDumpProfile, profile.HeapDumpSignal(syscall.SIGUSR1), profile.ProfilePath("` + d + `"))
+	syscall.Kill(os.Getpid(), syscall.SIGUSR1)
+	for len(p.Files()) < 2 {
+		time.Sleep(10 * time.Millisecond)
+	}
+	p.Stop()
+	for _, fn := range p.Result().Files {
+		fi, err := os.Stat(fn)
+		fmt.Println(err, fi.Size() > 0)
+	}
+}
+`,
+		checks: []checkFn{
+			Stdout("<nil> true", "<nil> true"),
+			Stderr("profile: heap dump enabled, "+d+"/heap.dump",
+				"profile: warning: heap dumps are at least as large as the heap",
+				"profile: heap dump written, "+d+"/heap-1.dump",
+				"profile: heap dump disabled"),
+			NoErr,
+		},
+	}, {
+		name: "toggle signal",
+		code: `
+package main
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+	"time"
+
+	"github.com/pkg/profile"
+)
+
+func main() {
+	p := profile.Start(profile.GoroutineProfile, profile.ToggleSignal(syscall.SIGUSR1), profile.ProfilePath("` + d + `"))
+	syscall.Kill(os.Getpid(), syscall.SIGUSR1)
+	for len(p.Files()) < 1 {
+		time.Sleep(10 * time.Millisecond)
+	}
+	syscall.Kill(os.Getpid(), syscall.SIGUSR1)
+	<-p.Done()
+	_, err := os.Stat(p.Result().Files[0])
+	fmt.Println(err)
+}
+`,
+		checks: []checkFn{
+			Stdout("<nil>"),
+			Stderr("profile: waiting for user defined signal 1 to start goroutine profiling",
+				"profile: caught toggle signal, starting goroutine profiling",
+				"profile: goroutine profiling enabled, "+d+"/goroutine.pprof",
+				"profile: caught toggle signal, stopping goroutine profiling",
+				"profile: goroutine profiling disabled"),
+			NoErr,
+		},
+	}, {
+		name: "snapshot signal",
+		code: `
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/pkg/profile"
+)
+
+func main() {
+	p := profile.Start(profile.CPUProfile, profile.SnapshotSignal(syscall.SIGUSR2), profile.ProfilePath("` + d + `"))
+	syscall.Kill(os.Getpid(), syscall.SIGUSR2)
+	for len(p.Files()) < 3 {
+		time.Sleep(10 * time.Millisecond)
+	}
+	p.Stop()
+	for _, fn := range p.Result().Files[1:] {
+		matched, _ := filepath.Match("` + d + `/*-????????T??????Z.pprof", fn)
+		fmt.Println(filepath.Base(fn)[:5], matched)
+	}
+}
+`,
+		checks: []checkFn{
+			Stdout("heap- true", "gorou true"),
+			Stderr("profile: cpu profiling enabled",
+				"profile: heap snapshot written, "+d+"/heap-",
+				"profile: goroutine snapshot written, "+d+"/goroutine-",
+				"profile: cpu profiling disabled"),
+			NoErr,
+		},
+	}, {
+		name: "snapshot signal after switch mode",
+		code: `
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/pkg/profile"
+)
+
+func main() {
+	p := profile.Start(profile.CPUProfile, profile.SnapshotSignal(syscall.SIGUSR2, "heap"), profile.ProfilePath("` + d + `"))
+	if err := p.SwitchMode(profile.GoroutineMode); err != nil {
+		panic(err)
+	}
+	syscall.Kill(os.Getpid(), syscall.SIGUSR2)
+	for deadline := time.Now().Add(10 * time.Second); len(p.Files()) < 3 && time.Now().Before(deadline); {
+		time.Sleep(10 * time.Millisecond)
+	}
+	p.Stop()
+	if files := p.Result().Files; len(files) == 3 {
+		fmt.Println(filepath.Base(files[2])[:5])
+	}
+}
+`,
+		checks: []checkFn{
+			Stdout("heap-"),
+			Stderr("profile: cpu profiling enabled",
+				"profile: cpu profiling disabled",
+				"profile: goroutine profiling enabled",
+				"profile: heap snapshot written, "+d+"/heap-",
+				"profile: goroutine profiling disabled"),
+			NoErr,
+		},
+	}, {
+		name: "shutdown hook sigterm",
+		code: `
+package main
+
+import (
+	"os"
+	"syscall"
+	"time"
+
+	"github.com/pkg/profile"
+)
+
+func main() {
+	profile.Start(profile.CPUProfile, profile.ProfilePath("` + d + `"))
+	syscall.Kill(os.Getpid(), syscall.SIGTERM)
+	time.Sleep(time.Minute)
+}
+`,
+		checks: []checkFn{
+			NoStdout,
+			Stderr("profile: cpu profiling enabled",
+				"profile: caught terminated, stopping profiles",
+				"profile: cpu profiling disabled, "+d+"/cpu.pprof"),
+			Err,
+		},
+	}, {
+		name: "shutdown signals",
+		code: `
+package main
+
+import (
+	"os"
+	"syscall"
+	"time"
+
+	"github.com/pkg/profile"
+)
+
+func main() {
+	profile.Start(profile.CPUProfile, profile.ShutdownSignals(syscall.SIGHUP), profile.ProfilePath("` + d + `"))
+	syscall.Kill(os.Getpid(), syscall.SIGHUP)
+	time.Sleep(time.Minute)
+}
+`,
+		checks: []checkFn{
+			NoStdout,
+			Stderr("profile: cpu profiling enabled",
+				"profile: caught hangup, stopping profiles",
+				"profile: cpu profiling disabled, "+d+"/cpu.pprof"),
+			Err,
+		},
+	}, {
+		name: "shutdown exit code",
+		code: `
+package main
+
+import (
+	"os"
+	"syscall"
+	"time"
+
+	"github.com/pkg/profile"
+)
+
+func main() {
+	profile.Start(profile.CPUProfile, profile.ShutdownExitCode(3), profile.ProfilePath("` + d + `"))
+	syscall.Kill(os.Getpid(), syscall.SIGTERM)
+	time.Sleep(time.Minute)
+}
+`,
+		checks: []checkFn{
+			NoStdout,
+			Stderr("profile: cpu profiling enabled",
+				"profile: caught terminated, stopping profiles",
+				"profile: cpu profiling disabled, "+d+"/cpu.pprof",
+				"exit status 3"),
+			Err,
+		},
+	}, {
+		name: "shutdown no exit",
+		code: `
+package main
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+
+	"github.com/pkg/profile"
+)
+
+func main() {
+	p := profile.Start(profile.CPUProfile, profile.ShutdownNoExit, profile.ProfilePath("` + d + `"))
+	syscall.Kill(os.Getpid(), syscall.SIGTERM)
+	<-p.Done()
+	fmt.Println("flushed")
+}
+`,
+		checks: []checkFn{
+			Stdout("flushed"),
+			Stderr("profile: cpu profiling enabled",
+				"profile: caught terminated, stopping profiles",
+				"profile: cpu profiling disabled, "+d+"/cpu.pprof"),
+			NoErr,
+		},
+	}, {
+		name: "shutdown notify",
+		code: `
+package main
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+
+	"github.com/pkg/profile"
+)
+
+func main() {
+	c := make(chan os.Signal, 1)
+	p := profile.Start(profile.CPUProfile, profile.ShutdownNotify(c), profile.ProfilePath("` + d + `"))
+	syscall.Kill(os.Getpid(), syscall.SIGTERM)
+	sig := <-c
+	_, err := os.Stat(p.Result().Files[0])
+	fmt.Println(sig, err)
+}
+`,
+		checks: []checkFn{
+			Stdout("terminated <nil>"),
+			Stderr("profile: cpu profiling enabled",
+				"profile: caught terminated, stopping profiles",
+				"profile: cpu profiling disabled, "+d+"/cpu.pprof"),
+			NoErr,
+		},
+	}, {
+		name: "shutdown timeout",
+		code: `
+package main
+
+import (
+	"os"
+	"syscall"
+	"time"
+
+	"github.com/pkg/profile"
+)
+
+func main() {
+	stuck := profile.OnStop(func(profile.Result) { select {} })
+	profile.Start(profile.CPUProfile, stuck, profile.ShutdownTimeout(100*time.Millisecond), profile.ShutdownExitCode(4), profile.ProfilePath("` + d + `"))
+	syscall.Kill(os.Getpid(), syscall.SIGTERM)
+	time.Sleep(time.Minute)
+}
+`,
+		checks: []checkFn{
+			NoStdout,
+			Stderr("profile: cpu profiling enabled",
+				"profile: caught terminated, stopping profiles",
+				"profile: cpu profiling disabled, "+d+"/cpu.pprof",
+				"profile: timed out after 100ms stopping cpu profiling",
+				"exit status 4"),
+			Err,
+		},
+	}, {
+		name: "start with signals",
+		code: `
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"syscall"
+
+	"github.com/pkg/profile"
+)
+
+func main() {
+	ctx, stop, err := profile.StartWithSignals(context.Background(), profile.CPUProfile, profile.ProfilePath("` + d + `"))
+	if err != nil {
+		panic(err)
+	}
+	defer stop()
+	syscall.Kill(os.Getpid(), syscall.SIGTERM)
+	<-ctx.Done()
+	_, err = os.Stat("` + d + `/cpu.pprof")
+	fmt.Println(ctx.Err(), err)
+}
+`,
+		checks: []checkFn{
+			Stdout("context canceled <nil>"),
+			Stderr("profile: cpu profiling enabled",
+				"profile: cpu profiling disabled, "+d+"/cpu.pprof"),
+			NoErr,
+		},
+	}, {
+		name: "rotate signal",
+		code: `
+package main
+
+import (
+	"fmt"
+	"os"
+	"syscall"
+	"time"
+
+	"github.com/pkg/profile"
+)
+
+func main() {
+	p := profile.Start(profile.CPUProfile, profile.RotateSignal(syscall.SIGHUP), profile.ProfilePath("` + d + `"))
+	time.Sleep(time.Second)
+	syscall.Kill(os.Getpid(), syscall.SIGHUP)
+	for len(p.Files()) < 2 {
+		time.Sleep(10 * time.Millisecond)
+	}
+	p.Stop()
+	files := p.Result().Files
+	_, err := os.Stat(files[0])
+	fmt.Println(len(files), files[0] != files[1], err)
+}
+`,
+		checks: []checkFn{
+			Stdout("2 true <nil>"),
+			Stderr("profile: cpu profiling enabled, "+d+"/cpu-",
+				"profile: caught rotate signal, rotating cpu profile",
+				"profile: cpu profiling disabled, "+d+"/cpu-",
+				"profile: cpu profiling enabled, "+d+"/cpu-",
+				"profile: cpu profiling disabled, "+d+"/cpu-"),
+			NoErr,
+		},
+	}, {
+		name: "exit",
+		code: `
+package main
+
+import (
+	"github.com/pkg/profile"
+)
+
+func main() {
+	profile.Start(profile.GoroutineProfile, profile.ProfilePath("` + d + `"))
+	profile.Exit(3)
+}
+`,
+		checks: []checkFn{
+			NoStdout,
+			Stderr("profile: goroutine profiling enabled, "+d+"/goroutine.pprof",
+				"profile: goroutine profiling disabled, "+d+"/goroutine.pprof",
+				"exit status 3"),
+			Err,
+		},
+	}, {
+		name: "main",
+		code: `
+package main
+
+import (
+	"github.com/pkg/profile"
+)
+
+func main() {
+	profile.Main(func() {
+		profile.Start(profile.GoroutineProfile, profile.ProfilePath("` + d + `"))
+	})
+}
+`,
+		checks: []checkFn{
+			NoStdout,
+			Stderr("profile: goroutine profiling enabled, "+d+"/goroutine.pprof",
+				"profile: goroutine profiling disabled, "+d+"/goroutine.pprof"),
+			NoErr,
+		},
+	}, {
+		name: "shutdown second signal",
+		code: `
+package main
+
+import (
+	"os"
+	"syscall"
+	"time"
+
+	"github.com/pkg/profile"
+)
+
+func main() {
+	stuck := profile.OnStop(func(profile.Result) {
+		syscall.Kill(os.Getpid(), syscall.SIGINT)
+		select {}
+	})
+	profile.Start(profile.CPUProfile, stuck, profile.ProfilePath("` + d + `"))
+	syscall.Kill(os.Getpid(), syscall.SIGTERM)
+	time.Sleep(time.Minute)
+}
+`,
+		checks: []checkFn{
+			NoStdout,
+			Stderr("profile: cpu profiling enabled",
+				"profile: caught terminated, stopping profiles",
+				"profile: cpu profiling disabled, "+d+"/cpu.pprof",
+				"profile: caught interrupt while stopping profiles, exiting"),
+			Err,
+		},
+	}, {
+		name: "log summary",
+		code: `
+package main
+
+import "github.com/pkg/profile"
+
+func main() {
+	defer profile.Start(profile.MemProfile, profile.LogSummary, profile.ProfilePath("` + d + `")).Stop()
+}
+`,
+		checks: []checkFn{
+			NoStdout,
+			Stderr("profile: memory profiling enabled",
+				"profile: memory profiling disabled, "+d+"/mem.pprof",
+				"profile: mem session summary: ran for"),
+			NoErr,
+		},
+	}, {
+		name: "custom profile",
+		code: `
+package main
+
+import (
+	"runtime/pprof"
+
+	"github.com/pkg/profile"
+)
+
+var openIters = pprof.NewProfile("leveldb.openIters")
+
+func main() {
+	openIters.Add("iter", 0)
+	defer profile.Start(profile.CustomProfile("leveldb.openIters"), profile.ProfilePath("` + d + `")).Stop()
+	defer profile.Start(profile.CPUProfile, profile.ProfilePath("` + d + `")).Stop()
+}
+`,
+		checks: []checkFn{
+			NoStdout,
+			Stderr("profile: leveldb.openIters profiling enabled, "+d+"/leveldb.openIters.pprof",
+				"profile: cpu profiling enabled",
+				"profile: cpu profiling disabled",
+				"profile: leveldb.openIters profiling disabled"),
+			NoErr,
+		},
+	}, {
+		name: "unknown custom profile",
+		code: `
+package main
+
+import "github.com/pkg/profile"
+
+func main() {
+	defer profile.Start(profile.CustomProfile("unregistered")).Stop()
+}
+`,
+		checks: []checkFn{
+			NoStdout,
+			Stderr(`profile: unknown profile "unregistered"`),
+			Err,
+		},
+	}, {
+		name: "heap and allocs profiles",
+		code: `
+package main
+
+import "github.com/pkg/profile"
+
+func main() {
+	defer profile.Start(profile.MemProfileHeapAndAllocs, profile.ProfilePath("` + d + `")).Stop()
+}
+`,
+		checks: []checkFn{
+			NoStdout,
+			Stderr("profile: memory profiling enabled (rate 4096), "+d+"/heap.pprof, "+d+"/allocs.pprof",
+				"profile: memory profiling disabled, "+d+"/heap.pprof, "+d+"/allocs.pprof"),
+			NoErr,
+		},
+	}, {
+		name: "all profiles",
+		code: `
+package main
+
+import "github.com/pkg/profile"
+
+func main() {
+	defer profile.Start(profile.AllProfiles, profile.ProfilePath("` + d + `")).Stop()
+}
+`,
+		checks: []checkFn{
+			NoStdout,
+			Stderr("profile: all profiles enabled, "+d,
+				"profile: all profiles disabled, "+d),
+			NoErr,
+		},
+	}, {
+		name: "diagnostic snapshot",
+		code: `
+package main
+
+import "github.com/pkg/profile"
+
+func main() {
+	defer profile.Start(profile.DiagnosticSnapshot, profile.ProfilePath("` + d + `")).Stop()
+}
+`,
+		checks: []checkFn{
+			NoStdout,
+			Stderr("profile: diagnostic snapshot enabled, "+d,
+				"profile: diagnostic snapshot written, "+d),
+			NoErr,
+		},
+	}, {
+		name: "goroutine profile full stacks",
+		code: `
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/pkg/profile"
+)
+
+func main() {
+	p := profile.Start(profile.GoroutineProfileFullStacks, profile.ProfilePath("` + d + `"))
+	p.Stop()
+	data, _ := ioutil.ReadFile(p.Result().Files[0])
+	fmt.Println(strings.HasPrefix(string(data), "goroutine 1 [running]:"))
+}
+`,
+		checks: []checkFn{
+			Stdout("true"),
+			Stderr("profile: goroutine profiling enabled, "+d+"/goroutine.txt",
+				"profile: goroutine profiling disabled, "+d+"/goroutine.txt"),
+			NoErr,
+		},
+	}, {
+		name: "multiple profile sessions",
+		code: `
+package main
+
+import "github.com/pkg/profile"
+
+func main() {
+	profile.Start(profile.CPUProfile).Stop()
+	profile.Start(profile.MemProfile).Stop()
+	profile.Start(profile.BlockProfile).Stop()
+	profile.Start(profile.CPUProfile).Stop()
+	profile.Start(profile.MutexProfile).Stop()
+}
+`,
+		checks: []checkFn{
+			NoStdout,
+			Stderr("profile: cpu profiling enabled",
+				"profile: cpu profiling disabled",
+				"profile: memory profiling enabled",
+				"profile: memory profiling disabled",
+				"profile: block profiling enabled",
+				"profile: block profiling disabled",
+				"profile: cpu profiling enabled",
+				"profile: cpu profiling disabled",
+				"profile: mutex profiling enabled",
+				"profile: mutex profiling disabled"),
+			NoErr,
+		},
+	}, {
+		name: "profile quiet",
+		code: `
+package main
+
+import "github.com/pkg/profile"
+
+func main() {
+        defer profile.Start(profile.Quiet).Stop()
+}
+`,
+		checks: []checkFn{NoStdout, NoStderr, NoErr},
+	}, {
+		name: "profile filename",
+		code: `
+package main
+
+import "github.com/pkg/profile"
+
+func main() {
+	defer profile.Start(profile.ProfileFilename("cpu.out")).Stop()
+}
+`,
+		checks: []checkFn{
+			NoStdout,
+			Stderr("/cpu.out"),
+			NoErr,
+		},
+	}, {
+		name: "profile filename error",
+		code: `
+package main
+
+import "github.com/pkg/profile"
+
+func main() {
+		defer profile.Start(profile.ProfileFilename("../name")).Stop()
+}
+`,
+		checks: []checkFn{
+			NoStdout,
+			Stderr(" filename must not contain path elements"),
+			Err,
+		},
+	}, {
+		name: "profile filename and path",
+		code: `
+package main
+
+import "github.com/pkg/profile"
+
+func main() {
+	defer profile.Start(profile.ProfileFilename("cpu.out"),profile.ProfilePath("` + d + `")).Stop()
+}
+`,
+		checks: []checkFn{
+			NoStdout,
+			Stderr("profile: cpu profiling enabled, " + d + "/cpu.out"),
+			NoErr,
+		},
+	}}
+	for _, tt := range profileTests {
+		t.Log(tt.name)
+		stdout, stderr, err := runTest(t, tt.code)
+		for _, f := range tt.checks {
+			f(t, stdout, stderr, err)
+		}
+	}
+}
+
+func TestRestart(t *testing.T) {
+	memRate := runtime.MemProfileRate
+	mutexRate := runtime.SetMutexProfileFraction(-1)
+	for i := 0; i < 3; i++ {
+		for _, mode := range []Option{MemProfileRate(512), MutexProfile, BlockProfile, CPUProfile} {
+			p, err := StartErr(mode, ProfilePath(t.TempDir()), Quiet, NoShutdownHook)
+			if err != nil {
+				t.Fatal(err)
+			}
+			p.Stop()
+			if err := p.Result().Err; err != nil {
+				t.Fatal(err)
+			}
+			if runtime.MemProfileRate != memRate {
+				t.Fatalf("%v: MemProfileRate: got %d, want %d", p.Mode(), runtime.MemProfileRate, memRate)
+			}
+			if got := runtime.SetMutexProfileFraction(-1); got != mutexRate {
+				t.Fatalf("%v: mutex profile fraction: got %d, want %d", p.Mode(), got, mutexRate)
+			}
+		}
+	}
+}
+
+func TestInvalidOptions(t *testing.T) {
+	tests := []struct {
+		name    string
+		options []Option
+	}{
+		{"mem rate with cpu", []Option{MemProfileRate(2048), CPUProfile}},
+		{"mem type with block", []Option{MemProfileAllocs, BlockProfile}},
+		{"negative mem rate", []Option{MemProfileRate(-1)}},
+		{"filename with path", []Option{ProfileFilename("../cpu.pprof")}},
+		{"timestamp with filename", []Option{Timestamp, ProfileFilename("cpu.pprof")}},
+		{"retention without timestamp", []Option{Retention(3)}},
+		{"invalid file mode", []Option{ProfileFileMode(os.ModeDir | 0600)}},
+		{"capture with filename", []Option{CaptureInMemory, ProfileFilename("cpu.pprof")}},
+		{"text format with cpu", []Option{CPUProfile, TextFormat}},
+		{"run dir with path", []Option{RunDir("../run")}},
+		{"temp dir with path", []Option{ProfileTempDir("", "myapp-"), ProfilePath(".")}},
+		{"max runs with path", []Option{MaxRuns(3)}},
+		{"max age with run id", []Option{MaxAge(time.Hour), RunDir("run1")}},
+		{"manifest with writer", []Option{Manifest, CaptureInMemory}},
+		{"snapshot with cpu", []Option{CPUProfile, Snapshot(time.Second)}},
+		{"snapshot with filename", []Option{MutexProfile, Snapshot(time.Second), ProfileFilename("mutex.pprof")}},
+		{"negative duration", []Option{Duration(-time.Second)}},
+		{"toggle without signals", []Option{ToggleSignal()}},
+		{"shutdown without signals", []Option{ShutdownSignals()}},
+		{"negative shutdown exit code", []Option{ShutdownExitCode(-1)}},
+		{"large shutdown exit code", []Option{ShutdownExitCode(256)}},
+		{"shutdown notify without channel", []Option{ShutdownNotify(nil)}},
+		{"zero shutdown timeout", []Option{ShutdownTimeout(0)}},
+		{"rotate without signals", []Option{RotateSignal()}},
+		{"zero progress interval", []Option{ReportProgress(0, nil)}},
+		{"progress with writer", []Option{ReportProgress(time.Second, nil), CaptureInMemory}},
+		{"rotate signal with writer", []Option{RotateSignal(os.Interrupt), CaptureInMemory}},
+		{"rotate signal with filename", []Option{RotateSignal(os.Interrupt), ProfileFilename("cpu.pprof")}},
+		{"snapshot signal with writer", []Option{SnapshotSignal(os.Interrupt), CaptureInMemory}},
+		{"snapshot signal with path", []Option{SnapshotSignal(os.Interrupt, "../heap")}},
+		{"watchdog without heartbeat", []Option{Watchdog(nil, time.Second)}},
+		{"dual format with trace", []Option{TraceProfile, DualFormat}},
+		{"unknown placeholder", []Option{ProfileFilenameTemplate("{user}.pprof")}},
+		{"unterminated placeholder", []Option{ProfileFilenameTemplate("{pid.pprof")}},
+		{"template with path", []Option{ProfileFilenameTemplate("{mode}/{pid}.pprof")}},
+		{"upload as written without upload", []Option{UploadAsWritten}},
+	}
+	for _, tt := range tests {
+		dir := filepath.Join(t.TempDir(), "out")
+		options := append(tt.options, ProfilePath(dir), Quiet, NoShutdownHook)
+		if _, err := StartErr(options...); err == nil {
+			t.Errorf("%s: expected error", tt.name)
+		}
+		if _, err := os.Stat(dir); !os.IsNotExist(err) {
+			t.Errorf("%s: output directory was created", tt.name)
+		}
+	}
+}
+
+func TestWriteTo(t *testing.T) {
+	for _, mode := range []Option{CPUProfile, GoroutineProfile, MemProfile} {
+		var buf bytes.Buffer
+		p, err := StartErr(mode, WriteTo(&buf), Quiet, NoShutdownHook)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p.Mode() == CPUMode {
+			p.Pause()
+			p.Resume()
+		}
+		p.Stop()
+		if err := p.Result().Err; err != nil {
+			t.Fatalf("%v: %v", p.Mode(), err)
+		}
+		if p.Dir() != "" || len(p.Result().Files) != 0 {
+			t.Fatalf("%v: expected no files, got %q %q", p.Mode(), p.Dir(), p.Result().Files)
+		}
+		if _, err := parseProto(buf.Bytes()); err != nil {
+			t.Fatalf("%v: %v", p.Mode(), err)
+		}
+	}
+}
+
+func TestCPUProfileRate(t *testing.T) {
+	var buf bytes.Buffer
+	p, err := StartErr(CPUProfileRate(500), WriteTo(&buf), Quiet, NoShutdownHook)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+	prof, err := parseProto(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := int64(time.Second / 500); prof.period != want {
+		t.Fatalf("got period %d, want %d", prof.period, want)
+	}
+}
+
+func TestAllProfiles(t *testing.T) {
+	dir := t.TempDir()
+	p, err := StartErr(AllProfiles, ProfilePath(dir), Quiet, NoShutdownHook)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"goroutine", "heap", "allocs", "threadcreate", "block", "mutex"} {
+		fn := filepath.Join(dir, name+".pprof")
+		buf, err := ioutil.ReadFile(fn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := parseProto(buf); err != nil {
+			t.Fatalf("%s: %v", fn, err)
+		}
+	}
+}
+
+func TestDiagnosticSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	p, err := StartErr(DiagnosticSnapshot, ProfilePath(dir), Quiet, NoShutdownHook)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		filepath.Join(dir, "goroutine.txt"),
+		filepath.Join(dir, "goroutine.pprof"),
+		filepath.Join(dir, "threadcreate.pprof"),
+	}
+	if got := p.Result().Files; strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Fatalf("got files %q, want %q", got, want)
+	}
+	buf, err := ioutil.ReadFile(want[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(buf, []byte("TestDiagnosticSnapshot")) {
+		t.Fatalf("%s does not contain the stack of the calling goroutine", want[0])
+	}
+}
+
+func TestExpvarSnapshot(t *testing.T) {
+	expvar.NewInt("profile_test_requests").Set(42)
+	dir := t.TempDir()
+	p, err := StartErr(GoroutineProfile, ExpvarSnapshot, ProfilePath(dir), Quiet, NoShutdownHook)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+	buf, err := ioutil.ReadFile(filepath.Join(dir, "expvar.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var vars map[string]json.RawMessage
+	if err := json.Unmarshal(buf, &vars); err != nil {
+		t.Fatal(err)
+	}
+	if got := string(vars["profile_test_requests"]); got != "42" {
+		t.Fatalf("got profile_test_requests %q, want 42", got)
+	}
+	if len(p.Result().Files) != 2 {
+		t.Fatalf("got files %q, want the profile and expvar snapshot", p.Result().Files)
+	}
+}
+
+func TestRecover(t *testing.T) {
+	dir := t.TempDir()
+	p, err := StartErr(CPUProfile, ProfilePath(dir), Quiet, NoShutdownHook)
+	if err != nil {
+		t.Fatal(err)
+	}
+	func() {
+		defer func() {
+			if r := recover(); r != "boom" {
+				t.Fatalf("got panic value %v, want boom", r)
+			}
+		}()
+		defer p.Recover()
+		panic("boom")
+	}()
+	select {
+	case <-p.Done():
+	default:
+		t.Fatal("session was not stopped")
+	}
+	want := []string{filepath.Join(dir, "cpu.pprof"), filepath.Join(dir, "goroutine-panic.txt")}
+	if got := p.Result().Files; strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Fatalf("got files %q, want %q", got, want)
+	}
+}
+
+func TestCatchPanic(t *testing.T) {
+	cpuDir, goroutineDir := t.TempDir(), t.TempDir()
+	cpu, err := StartErr(CPUProfile, ProfilePath(cpuDir), Quiet, NoShutdownHook)
+	if err != nil {
+		t.Fatal(err)
+	}
+	goroutine, err := StartErr(GoroutineProfile, ProfilePath(goroutineDir), Quiet, NoShutdownHook)
+	if err != nil {
+		t.Fatal(err)
+	}
+	func() {
+		defer func() {
+			if r := recover(); r != "boom" {
+				t.Fatalf("got panic value %v, want boom", r)
+			}
+		}()
+		defer CatchPanic()
+		panic("boom")
+	}()
+	for _, p := range []*Profile{cpu, goroutine} {
+		select {
+		case <-p.Done():
+		default:
+			t.Fatalf("%v session was not stopped", p.Mode())
+		}
+		want := []string{filepath.Join(p.Dir(), p.Mode().String()+".pprof"), filepath.Join(p.Dir(), "goroutine-panic.txt")}
+		if got := p.Result().Files; strings.Join(got, " ") != strings.Join(want, " ") {
+			t.Fatalf("got files %q, want %q", got, want)
+		}
+	}
+
+	// CatchPanic does nothing when not panicking.
+	func() {
+		defer CatchPanic()
+	}()
+}
+
+func TestTimestamp(t *testing.T) {
+	dir := t.TempDir()
+	p, err := StartErr(GoroutineProfile, Timestamp, ExpvarSnapshot, ProfilePath(dir), Quiet, NoShutdownHook)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+	ts := p.started.UTC().Format("20060102T150405Z")
+	want := []string{
+		filepath.Join(dir, "goroutine-"+ts+".pprof"),
+		filepath.Join(dir, "expvar-"+ts+".json"),
+	}
+	if got := p.Result().Files; strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Fatalf("got files %q, want %q", got, want)
+	}
+	for _, fn := range want {
+		if _, err := os.Stat(fn); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestProfileFilenameTemplate(t *testing.T) {
+	dir := t.TempDir()
+	p, err := StartErr(GoroutineProfile, ProfileFilenameTemplate("{mode}-{pid}-{tag}.pprof"), ProfileTag("job1"), ProfilePath(dir), Quiet, NoShutdownHook)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+	want := filepath.Join(dir, fmt.Sprintf("goroutine-%d-job1.pprof", os.Getpid()))
+	if got := p.Result().Files; len(got) != 1 || got[0] != want {
+		t.Fatalf("got files %q, want %q", got, want)
+	}
+}
+
+func TestRetention(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{
+		"goroutine-20200101T000000Z.pprof",
+		"goroutine-20200102T000000Z.pprof",
+		"goroutine-20200103T000000Z.pprof",
+		"cpu-20200101T000000Z.pprof",
+		// written by a trigger, and so not of the same kind.
+		"goroutine-goroutinesabove-20200101T000000Z.pprof",
+	} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if runtime.GOOS != "windows" {
+		if err := os.Symlink("goroutine-20200101T000000Z.pprof", filepath.Join(dir, "goroutine-latest.pprof")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	p, err := StartErr(GoroutineProfile, Timestamp, Retention(2), ProfilePath(dir), Quiet, NoShutdownHook)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+	got, err := filepath.Glob(filepath.Join(dir, "*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		filepath.Join(dir, "cpu-20200101T000000Z.pprof"),
+		filepath.Join(dir, "goroutine-20200103T000000Z.pprof"),
+		p.Result().Files[0],
+		filepath.Join(dir, "goroutine-goroutinesabove-20200101T000000Z.pprof"),
+	}
+	if runtime.GOOS != "windows" {
+		want = append(want, filepath.Join(dir, "goroutine-latest.pprof"))
+	}
+	sort.Strings(want)
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Fatalf("got files %q, want %q", got, want)
+	}
+}
+
+func TestRetentionRotate(t *testing.T) {
+	dir := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(dir, "goroutine-20200101T000000Z.pprof"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	p, err := StartErr(GoroutineProfile, Timestamp, Retention(1), ProfilePath(dir), Quiet, NoShutdownHook)
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(time.Second)
+	if err := p.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+	files := p.Result().Files
+	got, err := filepath.Glob(filepath.Join(dir, "*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := files[len(files)-1]; len(got) != 1 || got[0] != want {
+		t.Fatalf("got files %q, want only the rotated file %s", got, want)
+	}
+}
+
+func TestProfileModes(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("file modes are not supported on windows")
+	}
+	dir := filepath.Join(t.TempDir(), "out")
+	p, err := StartErr(GoroutineProfile, ProfileDirMode(0700), ProfileFileMode(0600), ProfilePath(dir), Quiet, NoShutdownHook)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+	for fn, want := range map[string]os.FileMode{dir: 0700, p.Result().Files[0]: 0600} {
+		fi, err := os.Stat(fn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := fi.Mode().Perm(); got != want {
+			t.Errorf("%s: got mode %v, want %v", fn, got, want)
+		}
+	}
+}
+
+func TestAtomicWrites(t *testing.T) {
+	for _, atomic := range []bool{true, false} {
+		dir := t.TempDir()
+		options := []Option{GoroutineProfile, ProfilePath(dir), Quiet, NoShutdownHook}
+		if !atomic {
+			options = append(options, NoAtomicWrites)
+		}
+		p, err := StartErr(options...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fn := filepath.Join(dir, "goroutine.pprof")
+		if _, err := os.Stat(fn); atomic != os.IsNotExist(err) {
+			t.Errorf("atomic %v: stat %s before Stop: %v", atomic, fn, err)
+		}
+		if err := p.Close(); err != nil {
+			t.Fatal(err)
+		}
+		got, err := filepath.Glob(filepath.Join(dir, "*"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(got) != 1 || got[0] != fn {
+			t.Errorf("atomic %v: got files %q after Stop, want %q", atomic, got, fn)
+		}
+	}
+}
+
+func TestCaptureInMemory(t *testing.T) {
+	p, err := StartErr(CPUProfile, CaptureInMemory, Quiet, NoShutdownHook)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.SwitchMode(GoroutineMode); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if p.Dir() != "" || len(p.Result().Files) != 0 {
+		t.Fatalf("expected no files, got %q %q", p.Dir(), p.Result().Files)
+	}
+	for _, mode := range []Mode{CPUMode, GoroutineMode} {
+		if _, err := parseProto(p.Bytes(mode)); err != nil {
+			t.Fatalf("%v: %v", mode, err)
+		}
+	}
+	if b := p.Bytes(MemMode); b != nil {
+		t.Fatalf("got %d bytes of mem profile, want none", len(b))
+	}
+}
+
+func TestLatestSymlink(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symbolic links require privileges on windows")
+	}
+	dir := t.TempDir()
+	for i := 0; i < 2; i++ {
+		p, err := StartErr(GoroutineProfile, Timestamp, LatestSymlink, ProfilePath(dir), Quiet, NoShutdownHook)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := p.Close(); err != nil {
+			t.Fatal(err)
+		}
+		target, err := os.Readlink(filepath.Join(dir, "goroutine-latest.pprof"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := filepath.Base(p.Result().Files[0]); target != want {
+			t.Fatalf("got link to %q, want %q", target, want)
+		}
+		time.Sleep(time.Second)
+	}
+}
+
+func TestTextFormat(t *testing.T) {
+	dir := t.TempDir()
+	p, err := StartErr(MemProfile, TextFormat, ProfilePath(dir), Quiet, NoShutdownHook)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+	buf, err := ioutil.ReadFile(filepath.Join(dir, "mem.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(buf, []byte("heap profile:")) {
+		t.Fatalf("mem.txt is not a text heap profile: %.40q", buf)
+	}
+}
+
+func TestDualFormat(t *testing.T) {
+	dir := t.TempDir()
+	p, err := StartErr(GoroutineProfile, DualFormat, ProfilePath(dir), Quiet, NoShutdownHook)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+	buf, err := ioutil.ReadFile(filepath.Join(dir, "goroutine.pprof"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := parseProto(buf); err != nil {
+		t.Fatal(err)
+	}
+	buf, err = ioutil.ReadFile(filepath.Join(dir, "goroutine.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(buf, []byte("goroutine profile:")) {
+		t.Fatalf("goroutine.txt is not a text goroutine profile: %.40q", buf)
+	}
+}
+
+func TestRunDir(t *testing.T) {
+	dir := t.TempDir()
+	p, err := StartErr(GoroutineProfile, RunDir("run1"), ProfilePath(dir), Quiet, NoShutdownHook)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(dir, "run1", "goroutine.pprof"); p.Result().Files[0] != want {
+		t.Fatalf("got files %q, want %q", p.Result().Files, want)
+	}
+
+	p, err = StartErr(GoroutineProfile, RunDir(""), ProfilePath(dir), Quiet, NoShutdownHook)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Stop()
+	if parent, id := filepath.Split(p.Dir()); filepath.Clean(parent) != dir || !strings.HasSuffix(id, fmt.Sprintf("-%d", os.Getpid())) {
+		t.Fatalf("got run directory %q, want a run id within %q", p.Dir(), dir)
+	}
+}
+
+func TestProfileTempDir(t *testing.T) {
+	parent := filepath.Join(t.TempDir(), "profiles")
+	p, err := StartErr(GoroutineProfile, ProfileTempDir(parent, "myapp-"), Quiet, NoShutdownHook)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Stop()
+	if dir, name := filepath.Split(p.Dir()); filepath.Clean(dir) != parent || !strings.HasPrefix(name, "myapp-") {
+		t.Fatalf("got directory %q, want a myapp- directory within %q", p.Dir(), parent)
+	}
+}
+
+func TestMaxAgeMaxRuns(t *testing.T) {
+	parent := t.TempDir()
+	old := time.Now().Add(-48 * time.Hour)
+	for i, name := range []string{"myapp-1", "myapp-2", "myapp-3", "myapp-4", "other-1", "myapp-x"} {
+		dir := filepath.Join(parent, name)
+		if err := os.Mkdir(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		mtime := time.Now().Add(-time.Duration(i+1) * time.Minute)
+		if name == "myapp-4" {
+			mtime = old
+		}
+		if err := os.Chtimes(dir, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	p, err := StartErr(GoroutineProfile, ProfileTempDir(parent, "myapp-"), MaxAge(24*time.Hour), MaxRuns(3), Quiet, NoShutdownHook)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Stop()
+
+	entries, err := ioutil.ReadDir(parent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, fi := range entries {
+		got = append(got, fi.Name())
+	}
+	// the session's directory and the two newest earlier directories
+	// are kept, along with directories this package did not create.
+	want := []string{"myapp-1", "myapp-2", filepath.Base(p.Dir()), "myapp-x", "other-1"}
+	sort.Strings(want)
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got directories %q, want %q", got, want)
+	}
+}
+
+func TestDuration(t *testing.T) {
+	dir := t.TempDir()
+	stopped := make(chan Result, 1)
+	p, err := StartErr(GoroutineProfile, Duration(10*time.Millisecond), OnStop(func(r Result) { stopped <- r }), ProfilePath(dir), Quiet, NoShutdownHook)
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-p.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("session was not stopped after its duration")
+	}
+	if r := <-stopped; r.Err != nil || len(r.Files) != 1 {
+		t.Fatalf("got result %+v", r)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "goroutine.pprof")); err != nil {
+		t.Fatal(err)
+	}
+	p.Stop() // stopping again does nothing
+}
+
+func TestRotate(t *testing.T) {
+	p, err := StartErr(GoroutineProfile, Timestamp, ProfilePath(t.TempDir()), Quiet, NoShutdownHook)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Stop()
+	if err := p.Rotate(); err == nil {
+		t.Error("expected error rotating twice within a second")
+	}
+	time.Sleep(time.Second)
+	if err := p.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+	p.Stop()
+	files := p.Result().Files
+	if len(files) != 2 || files[0] == files[1] {
+		t.Fatalf("got files %q, want two distinct files", files)
+	}
+	for _, fn := range files {
+		if _, err := os.Stat(fn); err != nil {
+			t.Error(err)
+		}
+	}
+	if err := p.Rotate(); err != errStopped {
+		t.Errorf("got error %v rotating a stopped session, want %v", err, errStopped)
+	}
+}
+
+func TestOnProfileWritten(t *testing.T) {
+	var mu sync.Mutex
+	var written []string
+	record := func(path, mode string, size int64) {
+		fi, err := os.Stat(path)
+		if err != nil {
+			t.Error(err)
+		} else if fi.Size() != size {
+			t.Errorf("%s: got size %d, want %d", path, size, fi.Size())
+		}
+		if mode != "mem" {
+			t.Errorf("%s: got mode %q, want %q", path, mode, "mem")
+		}
+		mu.Lock()
+		written = append(written, path)
+		mu.Unlock()
+	}
+	p, err := StartErr(MemProfileHeapAndAllocs, Manifest, OnProfileWritten(record), ProfilePath(t.TempDir()), Quiet, NoShutdownHook)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Stop()
+	if files := p.Result().Files; !reflect.DeepEqual(written, files) {
+		t.Errorf("got files %q written, want %q", written, files)
+	}
+}
+
+func TestOnError(t *testing.T) {
+	var mu sync.Mutex
+	var errs []error
+	record := func(err error) {
+		mu.Lock()
+		errs = append(errs, err)
+		mu.Unlock()
+	}
+	p := Start(GoroutineProfile, OnError(record), ProfilePath(t.TempDir()), Quiet, NoShutdownHook)
+	p.logError(errors.New("profile: something failed"))
+	p.Stop()
+	if len(errs) != 1 || errs[0].Error() != "profile: something failed" {
+		t.Errorf("got errors %v, want one", errs)
+	}
+
+	// an invalid session is reported rather than exiting.
+	errs = nil
+	p = Start(ShutdownExitCode(256), OnError(record), Quiet)
+	p.Stop()
+	if len(errs) != 1 {
+		t.Fatalf("got errors %v, want one", errs)
+	}
+	if files := p.Result().Files; len(files) != 0 {
+		t.Errorf("got files %q written, want none", files)
+	}
+}
+
+func TestNewBegin(t *testing.T) {
+	dir := t.TempDir()
+	p, err := New(GoroutineProfile, ProfilePath(dir), Quiet, NoShutdownHook)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fn := filepath.Join(dir, "goroutine.pprof")
+	if _, err := os.Stat(fn); !os.IsNotExist(err) {
+		t.Fatalf("New: expected %s not to exist", fn)
+	}
+	if err := p.Begin(); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Begin(); err == nil {
+		t.Fatal("Begin: expected error on second call")
+	}
+	p.Stop()
+	if _, err := os.Stat(fn); err != nil {
+		t.Fatal(err)
+	}
+
+	// stopping a session which has not begun does nothing.
+	p, err = New(CPUProfile, ProfilePath(dir), Quiet, NoShutdownHook)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Stop()
+	if files := p.Result().Files; len(files) != 0 {
+		t.Fatalf("Stop: expected no files, got %q", files)
+	}
+	if err := p.Begin(); err == nil {
+		t.Fatal("Begin: expected error after Stop")
+	}
+}
+
+func TestScopedModes(t *testing.T) {
+	tests := []struct {
+		name    string
+		options []Option
+		want    Mode
+		valid   bool
+	}{
+		{"cpu", []Option{CPU()}, CPUMode, true},
+		{"mem", []Option{Mem(2048, "allocs")}, MemMode, true},
+		{"mutex", []Option{Mutex(10)}, MutexMode, true},
+		{"block", []Option{Block(0)}, BlockMode, true},
+		{"cpu and mem", []Option{CPU(), Mem(0, "")}, 0, false},
+		{"mem rate after cpu", []Option{CPU(), MemProfileRate(2048)}, 0, false},
+		{"block after mutex", []Option{Mutex(1), BlockProfile}, 0, false},
+		{"unknown mem type", []Option{Mem(0, "stack")}, 0, false},
+		{"negative block rate", []Option{Block(-1)}, 0, false},
+	}
+	for _, tt := range tests {
+		options := append(tt.options, ProfilePath(t.TempDir()), Quiet, NoShutdownHook)
+		p, err := New(options...)
+		if valid := err == nil; valid != tt.valid {
+			t.Errorf("%s: got error %v, want valid %v", tt.name, err, tt.valid)
+			continue
+		}
+		if err == nil && p.Mode() != tt.want {
+			t.Errorf("%s: got mode %v, want %v", tt.name, p.Mode(), tt.want)
+		}
+	}
+}
+
+func TestClose(t *testing.T) {
+	p, err := StartErr(BlockProfile, ProfilePath(t.TempDir()), Quiet, NoShutdownHook)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var c io.Closer = p
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSwitchMode(t *testing.T) {
+	dir := t.TempDir()
+	p, err := StartErr(GoroutineProfile, ProfilePath(dir), Quiet, NoShutdownHook)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.SwitchMode(CPUMode); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Pause(); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.SwitchMode(MemMode); err != nil {
+		t.Fatal(err)
+	}
+	p.Stop()
+	r := p.Result()
+	if r.Err != nil {
+		t.Fatal(r.Err)
+	}
+	if r.Mode != MemMode {
+		t.Fatalf("got mode %v, want %v", r.Mode, MemMode)
+	}
+	want := []string{
+		filepath.Join(dir, "goroutine.pprof"),
+		filepath.Join(dir, "cpu.pprof"),
+		filepath.Join(dir, "mem.pprof"),
+	}
+	if len(r.Files) != len(want) {
+		t.Fatalf("got files %q, want %q", r.Files, want)
+	}
+	for i, fn := range want {
+		if r.Files[i] != fn {
+			t.Fatalf("got files %q, want %q", r.Files, want)
+		}
+		data, err := os.ReadFile(fn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := parseProto(data); err != nil {
+			t.Fatalf("%s: %v", fn, err)
+		}
+	}
+	if err := p.SwitchMode(CPUMode); err == nil {
+		t.Fatal("SwitchMode: expected error after Stop")
+	}
+}
+
+// NoStdout checks that stdout was blank.
+func NoStdout(t *testing.T, stdout, _ []byte, _ error) {
+	if len := len(stdout); len > 0 {
+		t.Errorf("stdout: wanted 0 bytes, got %d", len)
+	}
+}
+
+// Stdout verifies that the given lines match the output from stdout
+func Stdout(lines ...string) checkFn {
+	return func(t *testing.T, stdout, _ []byte, _ error) {
+		r := bytes.NewReader(stdout)
+		if !validateOutput(r, lines) {
+			t.Errorf("stdout: wanted '%s', got '%s'", lines, stdout)
+		}
 	}
 }
 
@@ -0,0 +1,84 @@
+package profile
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// A ProgressReport describes a running session, see ReportProgress.
+type ProgressReport struct {
+	// Mode holds the kind of profiling performed by the session.
+	Mode Mode
+
+	// Elapsed holds how long the session has been running.
+	Elapsed time.Duration
+
+	// BytesWritten holds the size of the session's files so far,
+	// including those still being written.
+	BytesWritten int64
+}
+
+// ReportProgress logs how long the session has been running, and the
+// size of the files it has written so far, every interval, so that a
+// long running session, for example of execution tracing, can be seen
+// to be alive. If fn is not nil it is also called with each report.
+func ReportProgress(interval time.Duration, fn func(ProgressReport)) Option {
+	return func(p *Profile) error {
+		if interval <= 0 {
+			return fmt.Errorf("profile: progress interval must be positive")
+		}
+		p.progressInterval, p.onProgress = interval, fn
+		return nil
+	}
+}
+
+// startProgress reports the session's progress until prof.closer is
+// called.
+func (prof *Profile) startProgress() {
+	quit := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		t := time.NewTicker(prof.progressInterval)
+		defer t.Stop()
+		for {
+			select {
+			case <-t.C:
+			case <-quit:
+				return
+			}
+			r := ProgressReport{
+				Mode:         prof.mode,
+				Elapsed:      time.Since(prof.started),
+				BytesWritten: prof.bytesWritten(),
+			}
+			prof.logf("profile: %v profiling running for %v, %d bytes written", r.Mode, r.Elapsed.Round(time.Second), r.BytesWritten)
+			if prof.onProgress != nil {
+				prof.onProgress(r)
+			}
+		}
+	}()
+	closer := prof.closer
+	prof.closer = func() error {
+		close(quit)
+		<-done
+		return closer()
+	}
+}
+
+// bytesWritten returns the size of the session's files, including the
+// temporary files of those still being written.
+func (prof *Profile) bytesWritten() int64 {
+	var n int64
+	for _, fn := range prof.Files() {
+		fi, err := os.Stat(fn)
+		if os.IsNotExist(err) && !prof.noAtomicWrites {
+			fi, err = os.Stat(fn + ".tmp")
+		}
+		if err == nil {
+			n += fi.Size()
+		}
+	}
+	return n
+}
@@ -0,0 +1,33 @@
+package profile
+
+import (
+	"testing"
+	"time"
+)
+
+func TestReportProgress(t *testing.T) {
+	reports := make(chan ProgressReport, 1)
+	report := func(r ProgressReport) {
+		select {
+		case reports <- r:
+		default:
+		}
+	}
+	p, err := StartErr(GoroutineProfile, Snapshot(time.Millisecond), ReportProgress(time.Millisecond, report), ProfilePath(t.TempDir()), Quiet, NoShutdownHook)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Stop()
+	for len(p.Files()) < 2 {
+		time.Sleep(time.Millisecond)
+	}
+	for {
+		r := <-reports
+		if r.Mode != GoroutineMode || r.Elapsed <= 0 {
+			t.Fatalf("got report %+v", r)
+		}
+		if r.BytesWritten > 0 {
+			break
+		}
+	}
+}
@@ -0,0 +1,634 @@
+package profile
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"errors"
+	"io/ioutil"
+)
+
+// This file contains a minimal encoder and decoder for the pprof
+// profile.proto format, sufficient for the package to merge and
+// annotate the profiles written by runtime/pprof without taking
+// a dependency on github.com/google/pprof.
+// See https://github.com/google/pprof/blob/main/proto/profile.proto.
+
+// protoProfile is a decoded perftools.profiles.Profile message.
+// String valued fields hold indexes into stringTable.
+type protoProfile struct {
+	sampleType        []protoValueType
+	sample            []protoSample
+	mapping           []protoMapping
+	location          []protoLocation
+	function          []protoFunction
+	stringTable       []string
+	dropFrames        int64
+	keepFrames        int64
+	timeNanos         int64
+	durationNanos     int64
+	periodType        protoValueType
+	period            int64
+	comment           []int64
+	defaultSampleType int64
+	docURL            int64
+}
+
+type protoValueType struct {
+	typ, unit int64
+}
+
+type protoSample struct {
+	locationID []uint64
+	value      []int64
+	label      []protoLabel
+}
+
+type protoLabel struct {
+	key, str, num, numUnit int64
+}
+
+type protoMapping struct {
+	id, memoryStart, memoryLimit, fileOffset uint64
+	filename, buildID                        int64
+	hasFunctions, hasFilenames               bool
+	hasLineNumbers, hasInlineFrames          bool
+}
+
+type protoLocation struct {
+	id, mappingID, address uint64
+	line                   []protoLine
+	isFolded               bool
+}
+
+type protoLine struct {
+	functionID   uint64
+	line, column int64
+}
+
+type protoFunction struct {
+	id                         uint64
+	name, systemName, filename int64
+	startLine                  int64
+}
+
+var errProtoMalformed = errors.New("malformed profile")
+
+// protoBuffer decodes protobuf wire format fields.
+type protoBuffer struct {
+	data []byte
+	err  error
+}
+
+func (b *protoBuffer) varint() uint64 {
+	v, n := binary.Uvarint(b.data)
+	if n <= 0 {
+		b.err = errProtoMalformed
+		b.data = nil
+		return 0
+	}
+	b.data = b.data[n:]
+	return v
+}
+
+func (b *protoBuffer) bytes() []byte {
+	n := b.varint()
+	if b.err != nil || uint64(len(b.data)) < n {
+		b.err = errProtoMalformed
+		b.data = nil
+		return nil
+	}
+	v := b.data[:n]
+	b.data = b.data[n:]
+	return v
+}
+
+// next returns the field number and wire type of the next field.
+func (b *protoBuffer) next() (int, int) {
+	tag := b.varint()
+	return int(tag >> 3), int(tag & 7)
+}
+
+// skip discards a field of the given wire type.
+func (b *protoBuffer) skip(wire int) {
+	switch wire {
+	case 0:
+		b.varint()
+	case 1:
+		if len(b.data) < 8 {
+			b.err = errProtoMalformed
+			return
+		}
+		b.data = b.data[8:]
+	case 2:
+		b.bytes()
+	case 5:
+		if len(b.data) < 4 {
+			b.err = errProtoMalformed
+			return
+		}
+		b.data = b.data[4:]
+	default:
+		b.err = errProtoMalformed
+	}
+}
+
+// uint64s decodes a repeated integer field which may be packed.
+func (b *protoBuffer) uint64s(wire int, dst []uint64) []uint64 {
+	if wire == 0 {
+		return append(dst, b.varint())
+	}
+	packed := protoBuffer{data: b.bytes()}
+	for len(packed.data) > 0 && packed.err == nil {
+		dst = append(dst, packed.varint())
+	}
+	if packed.err != nil {
+		b.err = packed.err
+	}
+	return dst
+}
+
+// message decodes a nested message using fn to decode each field.
+func (b *protoBuffer) message(fn func(b *protoBuffer, field, wire int)) {
+	m := protoBuffer{data: b.bytes()}
+	for len(m.data) > 0 && m.err == nil && b.err == nil {
+		field, wire := m.next()
+		fn(&m, field, wire)
+	}
+	if m.err != nil {
+		b.err = m.err
+	}
+}
+
+// parseProto decodes a profile, which may be gzip compressed.
+func parseProto(data []byte) (*protoProfile, error) {
+	if len(data) >= 2 && data[0] == 0x1f && data[1] == 0x8b {
+		zr, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		data, err = ioutil.ReadAll(zr)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var p protoProfile
+	b := protoBuffer{data: data}
+	for len(b.data) > 0 && b.err == nil {
+		field, wire := b.next()
+		switch field {
+		case 1:
+			var vt protoValueType
+			b.message(vt.decode)
+			p.sampleType = append(p.sampleType, vt)
+		case 2:
+			var s protoSample
+			b.message(s.decode)
+			p.sample = append(p.sample, s)
+		case 3:
+			var m protoMapping
+			b.message(m.decode)
+			p.mapping = append(p.mapping, m)
+		case 4:
+			var l protoLocation
+			b.message(l.decode)
+			p.location = append(p.location, l)
+		case 5:
+			var f protoFunction
+			b.message(f.decode)
+			p.function = append(p.function, f)
+		case 6:
+			p.stringTable = append(p.stringTable, string(b.bytes()))
+		case 7:
+			p.dropFrames = int64(b.varint())
+		case 8:
+			p.keepFrames = int64(b.varint())
+		case 9:
+			p.timeNanos = int64(b.varint())
+		case 10:
+			p.durationNanos = int64(b.varint())
+		case 11:
+			b.message(p.periodType.decode)
+		case 12:
+			p.period = int64(b.varint())
+		case 13:
+			for _, v := range b.uint64s(wire, nil) {
+				p.comment = append(p.comment, int64(v))
+			}
+		case 14:
+			p.defaultSampleType = int64(b.varint())
+		case 15:
+			p.docURL = int64(b.varint())
+		default:
+			b.skip(wire)
+		}
+	}
+	if b.err != nil {
+		return nil, b.err
+	}
+	if len(p.stringTable) == 0 || p.stringTable[0] != "" {
+		return nil, errProtoMalformed
+	}
+	return &p, nil
+}
+
+func (vt *protoValueType) decode(b *protoBuffer, field, wire int) {
+	switch field {
+	case 1:
+		vt.typ = int64(b.varint())
+	case 2:
+		vt.unit = int64(b.varint())
+	default:
+		b.skip(wire)
+	}
+}
+
+func (s *protoSample) decode(b *protoBuffer, field, wire int) {
+	switch field {
+	case 1:
+		s.locationID = b.uint64s(wire, s.locationID)
+	case 2:
+		for _, v := range b.uint64s(wire, nil) {
+			s.value = append(s.value, int64(v))
+		}
+	case 3:
+		var l protoLabel
+		b.message(l.decode)
+		s.label = append(s.label, l)
+	default:
+		b.skip(wire)
+	}
+}
+
+func (l *protoLabel) decode(b *protoBuffer, field, wire int) {
+	switch field {
+	case 1:
+		l.key = int64(b.varint())
+	case 2:
+		l.str = int64(b.varint())
+	case 3:
+		l.num = int64(b.varint())
+	case 4:
+		l.numUnit = int64(b.varint())
+	default:
+		b.skip(wire)
+	}
+}
+
+func (m *protoMapping) decode(b *protoBuffer, field, wire int) {
+	switch field {
+	case 1:
+		m.id = b.varint()
+	case 2:
+		m.memoryStart = b.varint()
+	case 3:
+		m.memoryLimit = b.varint()
+	case 4:
+		m.fileOffset = b.varint()
+	case 5:
+		m.filename = int64(b.varint())
+	case 6:
+		m.buildID = int64(b.varint())
+	case 7:
+		m.hasFunctions = b.varint() != 0
+	case 8:
+		m.hasFilenames = b.varint() != 0
+	case 9:
+		m.hasLineNumbers = b.varint() != 0
+	case 10:
+		m.hasInlineFrames = b.varint() != 0
+	default:
+		b.skip(wire)
+	}
+}
+
+func (l *protoLocation) decode(b *protoBuffer, field, wire int) {
+	switch field {
+	case 1:
+		l.id = b.varint()
+	case 2:
+		l.mappingID = b.varint()
+	case 3:
+		l.address = b.varint()
+	case 4:
+		var ln protoLine
+		b.message(ln.decode)
+		l.line = append(l.line, ln)
+	case 5:
+		l.isFolded = b.varint() != 0
+	default:
+		b.skip(wire)
+	}
+}
+
+func (ln *protoLine) decode(b *protoBuffer, field, wire int) {
+	switch field {
+	case 1:
+		ln.functionID = b.varint()
+	case 2:
+		ln.line = int64(b.varint())
+	case 3:
+		ln.column = int64(b.varint())
+	default:
+		b.skip(wire)
+	}
+}
+
+func (f *protoFunction) decode(b *protoBuffer, field, wire int) {
+	switch field {
+	case 1:
+		f.id = b.varint()
+	case 2:
+		f.name = int64(b.varint())
+	case 3:
+		f.systemName = int64(b.varint())
+	case 4:
+		f.filename = int64(b.varint())
+	case 5:
+		f.startLine = int64(b.varint())
+	default:
+		b.skip(wire)
+	}
+}
+
+// protoEncoder encodes protobuf wire format fields.
+type protoEncoder struct {
+	data []byte
+	tmp  [binary.MaxVarintLen64]byte
+}
+
+func (e *protoEncoder) varint(v uint64) {
+	n := binary.PutUvarint(e.tmp[:], v)
+	e.data = append(e.data, e.tmp[:n]...)
+}
+
+func (e *protoEncoder) tag(field, wire int) {
+	e.varint(uint64(field)<<3 | uint64(wire))
+}
+
+// uint64Opt encodes v if it is not zero.
+func (e *protoEncoder) uint64Opt(field int, v uint64) {
+	if v != 0 {
+		e.tag(field, 0)
+		e.varint(v)
+	}
+}
+
+func (e *protoEncoder) int64Opt(field int, v int64) {
+	e.uint64Opt(field, uint64(v))
+}
+
+func (e *protoEncoder) boolOpt(field int, v bool) {
+	if v {
+		e.uint64Opt(field, 1)
+	}
+}
+
+func (e *protoEncoder) bytes(field int, v []byte) {
+	e.tag(field, 2)
+	e.varint(uint64(len(v)))
+	e.data = append(e.data, v...)
+}
+
+// packed encodes a packed repeated integer field.
+func (e *protoEncoder) packed(field int, vs []uint64) {
+	if len(vs) == 0 {
+		return
+	}
+	var p protoEncoder
+	for _, v := range vs {
+		p.varint(v)
+	}
+	e.bytes(field, p.data)
+}
+
+func (e *protoEncoder) packedInt64s(field int, vs []int64) {
+	us := make([]uint64, len(vs))
+	for i, v := range vs {
+		us[i] = uint64(v)
+	}
+	e.packed(field, us)
+}
+
+// message encodes a nested message using fn to encode its fields.
+func (e *protoEncoder) message(field int, fn func(e *protoEncoder)) {
+	var m protoEncoder
+	fn(&m)
+	e.bytes(field, m.data)
+}
+
+// encode returns the gzip compressed encoding of p.
+func (p *protoProfile) encode() ([]byte, error) {
+	var e protoEncoder
+	for _, vt := range p.sampleType {
+		e.message(1, vt.encode)
+	}
+	for _, s := range p.sample {
+		e.message(2, s.encode)
+	}
+	for _, m := range p.mapping {
+		e.message(3, m.encode)
+	}
+	for _, l := range p.location {
+		e.message(4, l.encode)
+	}
+	for _, f := range p.function {
+		e.message(5, f.encode)
+	}
+	for _, s := range p.stringTable {
+		e.bytes(6, []byte(s))
+	}
+	e.int64Opt(7, p.dropFrames)
+	e.int64Opt(8, p.keepFrames)
+	e.int64Opt(9, p.timeNanos)
+	e.int64Opt(10, p.durationNanos)
+	if p.periodType != (protoValueType{}) {
+		e.message(11, p.periodType.encode)
+	}
+	e.int64Opt(12, p.period)
+	e.packedInt64s(13, p.comment)
+	e.int64Opt(14, p.defaultSampleType)
+	e.int64Opt(15, p.docURL)
+
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(e.data); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (vt protoValueType) encode(e *protoEncoder) {
+	e.int64Opt(1, vt.typ)
+	e.int64Opt(2, vt.unit)
+}
+
+func (s protoSample) encode(e *protoEncoder) {
+	e.packed(1, s.locationID)
+	e.packedInt64s(2, s.value)
+	for _, l := range s.label {
+		e.message(3, l.encode)
+	}
+}
+
+func (l protoLabel) encode(e *protoEncoder) {
+	e.int64Opt(1, l.key)
+	e.int64Opt(2, l.str)
+	e.int64Opt(3, l.num)
+	e.int64Opt(4, l.numUnit)
+}
+
+func (m protoMapping) encode(e *protoEncoder) {
+	e.uint64Opt(1, m.id)
+	e.uint64Opt(2, m.memoryStart)
+	e.uint64Opt(3, m.memoryLimit)
+	e.uint64Opt(4, m.fileOffset)
+	e.int64Opt(5, m.filename)
+	e.int64Opt(6, m.buildID)
+	e.boolOpt(7, m.hasFunctions)
+	e.boolOpt(8, m.hasFilenames)
+	e.boolOpt(9, m.hasLineNumbers)
+	e.boolOpt(10, m.hasInlineFrames)
+}
+
+func (l protoLocation) encode(e *protoEncoder) {
+	e.uint64Opt(1, l.id)
+	e.uint64Opt(2, l.mappingID)
+	e.uint64Opt(3, l.address)
+	for _, ln := range l.line {
+		e.message(4, ln.encode)
+	}
+	e.boolOpt(5, l.isFolded)
+}
+
+func (ln protoLine) encode(e *protoEncoder) {
+	e.uint64Opt(1, ln.functionID)
+	e.int64Opt(2, ln.line)
+	e.int64Opt(3, ln.column)
+}
+
+func (f protoFunction) encode(e *protoEncoder) {
+	e.uint64Opt(1, f.id)
+	e.int64Opt(2, f.name)
+	e.int64Opt(3, f.systemName)
+	e.int64Opt(4, f.filename)
+	e.int64Opt(5, f.startLine)
+}
+
+// addString returns the index of s in the string table,
+// adding it if necessary.
+func (p *protoProfile) addString(s string) int64 {
+	for i, t := range p.stringTable {
+		if t == s {
+			return int64(i)
+		}
+	}
+	p.stringTable = append(p.stringTable, s)
+	return int64(len(p.stringTable) - 1)
+}
+
+// merge appends the samples of q to p. The mappings, locations and
+// functions of q are renumbered to avoid colliding with those of p.
+// Both profiles must record the same sample types.
+func (p *protoProfile) merge(q *protoProfile) error {
+	if len(p.sampleType) != len(q.sampleType) {
+		return errors.New("profile: cannot merge profiles with different sample types")
+	}
+
+	strs := make(map[string]int64, len(p.stringTable))
+	for i, s := range p.stringTable {
+		if _, ok := strs[s]; !ok {
+			strs[s] = int64(i)
+		}
+	}
+	str := func(i int64) int64 {
+		if i < 0 || i >= int64(len(q.stringTable)) {
+			return 0
+		}
+		s := q.stringTable[i]
+		if j, ok := strs[s]; ok {
+			return j
+		}
+		p.stringTable = append(p.stringTable, s)
+		j := int64(len(p.stringTable) - 1)
+		strs[s] = j
+		return j
+	}
+
+	var mappingBase, locationBase, functionBase uint64
+	for _, m := range p.mapping {
+		if m.id > mappingBase {
+			mappingBase = m.id
+		}
+	}
+	for _, l := range p.location {
+		if l.id > locationBase {
+			locationBase = l.id
+		}
+	}
+	for _, f := range p.function {
+		if f.id > functionBase {
+			functionBase = f.id
+		}
+	}
+	offset := func(base, id uint64) uint64 {
+		if id == 0 {
+			return 0
+		}
+		return base + id
+	}
+
+	for _, m := range q.mapping {
+		m.id = offset(mappingBase, m.id)
+		m.filename = str(m.filename)
+		m.buildID = str(m.buildID)
+		p.mapping = append(p.mapping, m)
+	}
+	for _, f := range q.function {
+		f.id = offset(functionBase, f.id)
+		f.name = str(f.name)
+		f.systemName = str(f.systemName)
+		f.filename = str(f.filename)
+		p.function = append(p.function, f)
+	}
+	for _, l := range q.location {
+		l.id = offset(locationBase, l.id)
+		l.mappingID = offset(mappingBase, l.mappingID)
+		lines := make([]protoLine, len(l.line))
+		for i, ln := range l.line {
+			ln.functionID = offset(functionBase, ln.functionID)
+			lines[i] = ln
+		}
+		l.line = lines
+		p.location = append(p.location, l)
+	}
+	for _, s := range q.sample {
+		ids := make([]uint64, len(s.locationID))
+		for i, id := range s.locationID {
+			ids[i] = offset(locationBase, id)
+		}
+		s.locationID = ids
+		labels := make([]protoLabel, len(s.label))
+		for i, l := range s.label {
+			l.key = str(l.key)
+			l.str = str(l.str)
+			l.numUnit = str(l.numUnit)
+			labels[i] = l
+		}
+		s.label = labels
+		p.sample = append(p.sample, s)
+	}
+	for _, c := range q.comment {
+		p.comment = append(p.comment, str(c))
+	}
+
+	if q.timeNanos != 0 && (p.timeNanos == 0 || q.timeNanos < p.timeNanos) {
+		p.timeNanos = q.timeNanos
+	}
+	p.durationNanos += q.durationNanos
+	return nil
+}
@@ -0,0 +1,67 @@
+package profile
+
+import (
+	"bytes"
+	"runtime/pprof"
+	"testing"
+)
+
+func TestProtoRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	if err := pprof.Lookup("goroutine").WriteTo(&buf, 0); err != nil {
+		t.Fatal(err)
+	}
+	p, err := parseProto(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := p.encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	q, err := parseProto(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(q.sample) != len(p.sample) || len(q.location) != len(p.location) || len(q.stringTable) != len(p.stringTable) {
+		t.Fatalf("round trip: got %d samples, %d locations, %d strings, want %d, %d, %d",
+			len(q.sample), len(q.location), len(q.stringTable),
+			len(p.sample), len(p.location), len(p.stringTable))
+	}
+}
+
+func TestProtoMerge(t *testing.T) {
+	parse := func() *protoProfile {
+		var buf bytes.Buffer
+		if err := pprof.Lookup("goroutine").WriteTo(&buf, 0); err != nil {
+			t.Fatal(err)
+		}
+		p, err := parseProto(buf.Bytes())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+	p, q := parse(), parse()
+	samples, locations := len(p.sample)+len(q.sample), len(p.location)+len(q.location)
+	if err := p.merge(q); err != nil {
+		t.Fatal(err)
+	}
+	if len(p.sample) != samples || len(p.location) != locations {
+		t.Fatalf("merge: got %d samples, %d locations, want %d, %d", len(p.sample), len(p.location), samples, locations)
+	}
+	ids := make(map[uint64]bool)
+	for _, l := range p.location {
+		if ids[l.id] {
+			t.Fatalf("merge: duplicate location id %d", l.id)
+		}
+		ids[l.id] = true
+	}
+	for _, s := range p.sample {
+		for _, id := range s.locationID {
+			if !ids[id] {
+				t.Fatalf("merge: sample references unknown location id %d", id)
+			}
+		}
+	}
+}
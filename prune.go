@@ -0,0 +1,119 @@
+package profile
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// MaxAge removes directories created by earlier sessions which were
+// last modified more than d ago when a session starts. Only the
+// temporary directories created for sessions not given a ProfilePath,
+// see ProfileTempDir, and the directories created by RunDir with a
+// generated run id are considered.
+func MaxAge(d time.Duration) Option {
+	return func(p *Profile) error {
+		if d <= 0 {
+			return fmt.Errorf("profile: maximum age must be positive")
+		}
+		p.pruneAge = d
+		return nil
+	}
+}
+
+// MaxRuns limits the number of directories created by sessions to n,
+// including the directory of the session being started. When a
+// session starts the least recently modified directories are removed.
+// The directories considered are those described by MaxAge.
+func MaxRuns(n int) Option {
+	return func(p *Profile) error {
+		if n < 1 {
+			return fmt.Errorf("profile: maximum runs must be at least one")
+		}
+		p.pruneRuns = n
+		return nil
+	}
+}
+
+// runIDPattern matches the run ids generated by RunDir.
+var runIDPattern = regexp.MustCompile(`^\d{8}T\d{6}Z-\d+$`)
+
+// pruneDirs removes the directories of earlier sessions according to
+// MaxAge and MaxRuns.
+func (p *Profile) pruneDirs() error {
+	var parent, current string
+	var match func(name string) bool
+	switch {
+	case p.path == "":
+		// the temporary directory is either the session's
+		// directory or, with RunDir, its parent
+		current = p.dir
+		if p.runDir {
+			current = filepath.Dir(p.dir)
+		}
+		parent = filepath.Dir(current)
+		pattern := p.tempPattern
+		if pattern == "" {
+			pattern = "profile"
+		}
+		// ioutil.TempDir replaces the last * in the pattern with
+		// a random number, or appends one if there is no *.
+		prefix, suffix := pattern, ""
+		if i := strings.LastIndex(pattern, "*"); i >= 0 {
+			prefix, suffix = pattern[:i], pattern[i+1:]
+		}
+		match = func(name string) bool {
+			return len(name) > len(prefix)+len(suffix) &&
+				strings.HasPrefix(name, prefix) && strings.HasSuffix(name, suffix) &&
+				isDigits(name[len(prefix):len(name)-len(suffix)])
+		}
+	case p.runDir && p.runDirID == "":
+		current, parent = p.dir, filepath.Dir(p.dir)
+		match = runIDPattern.MatchString
+	default:
+		return nil
+	}
+
+	entries, err := ioutil.ReadDir(parent)
+	if err != nil {
+		return err
+	}
+	var dirs []os.FileInfo
+	for _, fi := range entries {
+		if fi.IsDir() && match(fi.Name()) && filepath.Join(parent, fi.Name()) != current {
+			dirs = append(dirs, fi)
+		}
+	}
+	// newest first
+	sort.Slice(dirs, func(i, j int) bool { return dirs[i].ModTime().After(dirs[j].ModTime()) })
+	for i, fi := range dirs {
+		old := p.pruneAge > 0 && time.Since(fi.ModTime()) > p.pruneAge
+		excess := p.pruneRuns > 0 && i+1 >= p.pruneRuns
+		if !old && !excess {
+			continue
+		}
+		dir := filepath.Join(parent, fi.Name())
+		if rerr := os.RemoveAll(dir); rerr != nil {
+			if err == nil {
+				err = rerr
+			}
+			continue
+		}
+		p.logf("profile: removed %s", dir)
+	}
+	return err
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,13 @@
+//go:build windows || plan9
+// +build windows plan9
+
+package profile
+
+import "os"
+
+// raise terminates the process with the status a shell reports for a
+// process killed by sig, as signals cannot be sent to the process
+// again on this platform.
+func raise(sig os.Signal) {
+	os.Exit(exitStatus(sig))
+}
@@ -0,0 +1,25 @@
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package profile
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// raise terminates the process with sig, restoring its default
+// action and sending it to the process again, so that the parent
+// process sees how it ended. If the signal does not terminate the
+// process, for example because it was ignored when the process
+// started, raise exits with the status a shell would report.
+func raise(sig os.Signal) {
+	if s, ok := sig.(syscall.Signal); ok {
+		signal.Reset(s)
+		syscall.Kill(os.Getpid(), s)
+		time.Sleep(100 * time.Millisecond)
+	}
+	os.Exit(exitStatus(sig))
+}
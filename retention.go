@@ -0,0 +1,89 @@
+package profile
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Retention limits the number of files of each kind kept in the
+// profile directory to n. When the session stops, files written by
+// earlier sessions which differ from those of this session only by
+// their timestamp are deleted, oldest first, leaving the newest n.
+// Retention requires that files are named with Timestamp or with a
+// ProfileFilenameTemplate containing {ts}, or that ArchiveOutput is
+// given, in which case the newest n archives are kept.
+func Retention(n int) Option {
+	return func(p *Profile) error {
+		if n < 1 {
+			return fmt.Errorf("profile: retention must be at least one file")
+		}
+		p.retention = n
+		return nil
+	}
+}
+
+// retain deletes the oldest files in the session's directory which
+// differ from a file written by the session only by their timestamp,
+// keeping p.retention of each. Files which share a prefix but are
+// otherwise named differently, such as cpu-cpuabove-<ts>.pprof beside
+// cpu-<ts>.pprof, are not of the same kind.
+func (p *Profile) retain() error {
+	type kind struct{ prefix, suffix string }
+	kinds := make(map[kind]bool)
+	for _, fn := range p.Files() {
+		if prefix, suffix, ok := splitTimestamp(filepath.Base(fn)); ok {
+			kinds[kind{prefix, suffix}] = true
+		}
+	}
+	if len(kinds) == 0 {
+		return nil
+	}
+	entries, err := ioutil.ReadDir(p.dir)
+	if err != nil {
+		return err
+	}
+	for k := range kinds {
+		var matches []string
+		for _, fi := range entries {
+			name := fi.Name()
+			if !fi.Mode().IsRegular() || len(name) != len(k.prefix)+len(timestampLayout)+len(k.suffix) ||
+				!strings.HasPrefix(name, k.prefix) || !strings.HasSuffix(name, k.suffix) {
+				continue
+			}
+			if _, perr := time.Parse(timestampLayout, name[len(k.prefix):len(name)-len(k.suffix)]); perr == nil {
+				matches = append(matches, filepath.Join(p.dir, name))
+			}
+		}
+		// timestamps sort in the order they were taken
+		sort.Strings(matches)
+		for len(matches) > p.retention {
+			if rerr := os.Remove(matches[0]); rerr != nil {
+				if err == nil {
+					err = fmt.Errorf("profile: could not remove %s: %v", matches[0], rerr)
+				}
+			} else {
+				p.logf("profile: removed %s", matches[0])
+			}
+			matches = matches[1:]
+		}
+	}
+	return err
+}
+
+// splitTimestamp returns the parts of name before and after the first
+// timestamp in it, as added by Timestamp, reporting whether there is
+// one.
+func splitTimestamp(name string) (prefix, suffix string, ok bool) {
+	n := len(timestampLayout)
+	for i := 0; i+n <= len(name); i++ {
+		if _, err := time.Parse(timestampLayout, name[i:i+n]); err == nil {
+			return name[:i], name[i+n:], true
+		}
+	}
+	return "", "", false
+}
@@ -0,0 +1,75 @@
+package profile
+
+import (
+	"fmt"
+	"os"
+	"sync/atomic"
+	"time"
+)
+
+// RotateSignal rotates the session's profile each time one of the
+// given signals, typically syscall.SIGHUP, is received: the current
+// profile is written out and closed, as if the session had been
+// stopped, and a new one started, so that tools which rotate log files
+// on SIGHUP can manage profiles too. RotateSignal implies Timestamp;
+// each profile is named with the time it was started. See Rotate.
+func RotateSignal(sig ...os.Signal) Option {
+	return func(p *Profile) error {
+		if len(sig) == 0 {
+			return fmt.Errorf("profile: RotateSignal requires at least one signal")
+		}
+		p.rotateSignals, p.timestamp = sig, true
+		return nil
+	}
+}
+
+// rotateOnSignal rotates the session's profile each time one of the
+// rotate signals is received, until the session stops.
+func (p *Profile) rotateOnSignal() {
+	stop := dumpOnSignal(p.rotateSignals, func(int) {
+		p.logf("profile: caught rotate signal, rotating %v profile", p.mode)
+		if err := p.Rotate(); err != nil {
+			p.logError(err)
+		}
+	})
+	go func() {
+		<-p.done
+		stop()
+	}()
+}
+
+// Rotate stops collecting the session's current profile, writing it
+// out as if the session had been stopped, and starts collecting a new
+// profile of the same mode. Rotate requires Timestamp, or RotateSignal,
+// as the new profile is named with the time it was started, and so may
+// be called at most once a second.
+func (p *Profile) Rotate() error {
+	p.runMu.Lock()
+	defer p.runMu.Unlock()
+	if atomic.LoadUint32(&p.stopped) != 0 {
+		return errStopped
+	}
+	if atomic.LoadUint32(&p.begun) == 0 {
+		return fmt.Errorf("profile: Rotate() called before Begin()")
+	}
+	if !p.timestamp || p.inMemory() {
+		return fmt.Errorf("profile: Rotate requires Timestamp, and cannot be used with WriteTo or CaptureInMemory")
+	}
+	if p.disabled {
+		return nil
+	}
+	now := time.Now()
+	if now.UTC().Format(timestampLayout) == p.fileTime().UTC().Format(timestampLayout) {
+		return fmt.Errorf("profile: cannot rotate %v profile twice within a second", p.mode)
+	}
+
+	if err := p.flush(); err != nil && p.err == nil {
+		p.err = err
+	}
+	p.rotated, p.cpu = now, nil
+	if err := p.start(); err != nil {
+		return err
+	}
+	p.startBackground()
+	return nil
+}
@@ -0,0 +1,81 @@
+package profile
+
+import (
+	"context"
+	"runtime/pprof"
+	"strings"
+)
+
+// DoRPC calls f with a copy of ctx carrying pprof labels describing
+// the RPC fullMethod, in the form /package.Service/Method used by
+// gRPC, applying them to the current goroutine for the duration of the
+// call, see pprof.Do. The service label holds package.Service and the
+// method label holds Method, so that samples can be attributed to the
+// RPC being served, for example with pprof's -tagfocus flag.
+//
+// DoRPC lets gRPC servers label their handlers without this package
+// depending on gRPC. Install it with interceptors such as:
+//
+//	func unary(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+//		profile.DoRPC(ctx, info.FullMethod, func(ctx context.Context) {
+//			resp, err = handler(ctx, req)
+//		})
+//		return resp, err
+//	}
+//
+//	func stream(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+//		profile.DoRPC(ss.Context(), info.FullMethod, func(context.Context) {
+//			err = handler(srv, ss)
+//		})
+//		return err
+//	}
+//
+//	s := grpc.NewServer(grpc.UnaryInterceptor(unary), grpc.StreamInterceptor(stream))
+func DoRPC(ctx context.Context, fullMethod string, f func(context.Context)) {
+	service, method := splitMethod(fullMethod)
+	pprof.Do(ctx, pprof.Labels("service", service, "method", method), f)
+}
+
+// splitMethod splits a gRPC method name, /package.Service/Method,
+// into its service and method. Names which are not in that form are
+// returned as the method, with no service.
+func splitMethod(fullMethod string) (service, method string) {
+	s := strings.TrimPrefix(fullMethod, "/")
+	if i := strings.LastIndexByte(s, '/'); i >= 0 {
+		return s[:i], s[i+1:]
+	}
+	return "", s
+}
+
+// RPCOptions configure the function returned by RPCProfiler.
+type RPCOptions struct {
+	// SampleRate holds the fraction of calls, between 0 and 1, for
+	// which a cpu profile is captured. If zero, no profiles are
+	// captured.
+	SampleRate float64
+
+	// Options hold the options for the sessions capturing cpu
+	// profiles, for example ProfilePath.
+	Options []Option
+}
+
+// RPCProfiler returns a function which, like DoRPC, calls f with the
+// RPC's service and method labels, and which captures a cpu profile
+// covering the call for the fraction of calls given by
+// opts.SampleRate, as HTTPMiddleware does for requests. Use the
+// method label to focus on a method, as the profile covers the whole
+// process. The names of the files written include rpc, for example
+// cpu-rpc-20060102T150405Z.pprof. As with HTTPMiddleware, the sessions
+// do not install the shutdown hook, are Quiet unless opts.Options give
+// another Verbosity, and are finished once the call returns without
+// delaying its response. Call the function returned from interceptors
+// in place of DoRPC.
+func RPCProfiler(opts RPCOptions) func(ctx context.Context, fullMethod string, f func(context.Context)) {
+	s := &sampler{name: "rpc", rate: opts.SampleRate, options: opts.Options}
+	return func(ctx context.Context, fullMethod string, f func(context.Context)) {
+		if p := s.sample(); p != nil {
+			defer s.finish(p)
+		}
+		DoRPC(ctx, fullMethod, f)
+	}
+}
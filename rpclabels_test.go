@@ -0,0 +1,58 @@
+package profile
+
+import (
+	"context"
+	"path/filepath"
+	"runtime/pprof"
+	"testing"
+)
+
+func TestDoRPC(t *testing.T) {
+	tests := []struct {
+		fullMethod      string
+		service, method string
+	}{
+		{"/helloworld.Greeter/SayHello", "helloworld.Greeter", "SayHello"},
+		{"/Greeter/SayHello", "Greeter", "SayHello"},
+		{"SayHello", "", "SayHello"},
+	}
+	for _, tt := range tests {
+		DoRPC(context.Background(), tt.fullMethod, func(ctx context.Context) {
+			service, _ := pprof.Label(ctx, "service")
+			method, _ := pprof.Label(ctx, "method")
+			if service != tt.service || method != tt.method {
+				t.Errorf("%s: got service %q method %q, want %q and %q", tt.fullMethod, service, method, tt.service, tt.method)
+			}
+		})
+	}
+}
+
+func TestRPCProfiler(t *testing.T) {
+	dir := t.TempDir()
+	do := RPCProfiler(RPCOptions{SampleRate: 1, Options: []Option{ProfilePath(dir)}})
+	var method string
+	var session *Profile
+	do(context.Background(), "/helloworld.Greeter/SayHello", func(ctx context.Context) {
+		method, _ = pprof.Label(ctx, "method")
+		mu.Lock()
+		session = active[CPUMode.String()]
+		mu.Unlock()
+	})
+	if method != "SayHello" {
+		t.Errorf("got method %q, want SayHello", method)
+	}
+	if session == nil {
+		t.Fatal("sampled call was not profiled")
+	}
+	if !session.noShutdownHook || !session.quiet {
+		t.Errorf("got noShutdownHook %v, quiet %v, want both", session.noShutdownHook, session.quiet)
+	}
+	<-session.done
+	files, err := filepath.Glob(filepath.Join(dir, "cpu-rpc-*.pprof"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 {
+		t.Errorf("got files %q, want one cpu profile", files)
+	}
+}
@@ -0,0 +1,272 @@
+package profile
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// UploadS3 requests that the files written by the session are
+// uploaded to the named Amazon S3 bucket, under prefix, when the
+// session stops. See S3Uploader.
+func UploadS3(bucket, prefix string) Option {
+	return Upload(&S3Uploader{Bucket: bucket, Prefix: prefix})
+}
+
+// S3Uploader is an Uploader which writes files to Amazon S3, or a
+// compatible object store, with PutObject requests. Credentials are
+// read each time a file is uploaded from the AWS_ACCESS_KEY_ID,
+// AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN environment variables
+// or, if they are not set, from the profile named by AWS_PROFILE, or
+// default, in the shared credentials file, ~/.aws/credentials or the
+// file named by AWS_SHARED_CREDENTIALS_FILE. Other sources, such as
+// instance roles and web identity tokens, are not supported.
+type S3Uploader struct {
+	// Bucket holds the name of the bucket.
+	Bucket string
+
+	// Prefix is prepended to the name of each uploaded file to
+	// form its key, for example "profiles/myservice/".
+	Prefix string
+
+	// Region holds the region of the bucket. If blank, the
+	// AWS_REGION environment variable is used, or us-east-1.
+	Region string
+
+	// Endpoint holds the URL of an S3 compatible service. If
+	// set, requests use path style addressing against Endpoint
+	// rather than the bucket's virtual host on amazonaws.com.
+	Endpoint string
+
+	// Client holds the HTTP client used to make requests. If
+	// nil, http.DefaultClient is used.
+	Client *http.Client
+}
+
+// Upload implements Uploader.
+func (s *S3Uploader) Upload(ctx context.Context, name string, r io.Reader, size int64) error {
+	creds, err := loadAWSCredentials()
+	if err != nil {
+		return err
+	}
+	region := s.Region
+	if region == "" {
+		region = os.Getenv("AWS_REGION")
+	}
+	if region == "" {
+		region = "us-east-1"
+	}
+
+	key := s.Prefix + name
+	var u string
+	if s.Endpoint != "" {
+		u = strings.TrimRight(s.Endpoint, "/") + "/" + s.Bucket + "/" + awsEscapePath(key)
+	} else {
+		u = "https://" + s.Bucket + ".s3." + region + ".amazonaws.com/" + awsEscapePath(key)
+	}
+	req, err := http.NewRequest("PUT", u, r)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	req.ContentLength = size
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("X-Amz-Content-Sha256", "UNSIGNED-PAYLOAD")
+	if creds.sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", creds.sessionToken)
+	}
+	signAWSv4(req, creds, region, "s3", time.Now())
+
+	client := s.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("s3: put %s/%s: %s: %s", s.Bucket, key, resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+type awsCredentials struct {
+	accessKey, secretKey, sessionToken string
+}
+
+// loadAWSCredentials returns the credentials given by the environment
+// or, failing that, the shared credentials file, see S3Uploader.
+func loadAWSCredentials() (awsCredentials, error) {
+	creds := awsCredentials{
+		accessKey:    os.Getenv("AWS_ACCESS_KEY_ID"),
+		secretKey:    os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		sessionToken: os.Getenv("AWS_SESSION_TOKEN"),
+	}
+	if creds.accessKey != "" && creds.secretKey != "" {
+		return creds, nil
+	}
+	path := os.Getenv("AWS_SHARED_CREDENTIALS_FILE")
+	if path == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return creds, fmt.Errorf("s3: AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY are not set and the shared credentials file could not be found: %v", err)
+		}
+		path = filepath.Join(home, ".aws", "credentials")
+	}
+	profile := os.Getenv("AWS_PROFILE")
+	if profile == "" {
+		profile = "default"
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return creds, fmt.Errorf("s3: AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY are not set and the shared credentials file could not be read: %v", err)
+	}
+	creds = parseAWSCredentials(string(data), profile)
+	if creds.accessKey == "" || creds.secretKey == "" {
+		return creds, fmt.Errorf("s3: no credentials for profile %q in %s", profile, path)
+	}
+	return creds, nil
+}
+
+// parseAWSCredentials returns the credentials of the named profile in
+// data, which holds a shared credentials file in INI format.
+func parseAWSCredentials(data, profile string) awsCredentials {
+	var creds awsCredentials
+	var section string
+	for _, line := range strings.Split(data, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+		if line[0] == '[' && line[len(line)-1] == ']' {
+			section = strings.TrimSpace(line[1 : len(line)-1])
+			continue
+		}
+		if section != profile {
+			continue
+		}
+		i := strings.IndexByte(line, '=')
+		if i < 0 {
+			continue
+		}
+		v := strings.TrimSpace(line[i+1:])
+		switch strings.ToLower(strings.TrimSpace(line[:i])) {
+		case "aws_access_key_id":
+			creds.accessKey = v
+		case "aws_secret_access_key":
+			creds.secretKey = v
+		case "aws_session_token":
+			creds.sessionToken = v
+		}
+	}
+	return creds
+}
+
+// signAWSv4 adds an AWS Signature Version 4 Authorization header to
+// req, signing the Host header and every header already set on req.
+// The X-Amz-Content-Sha256 header must hold the payload hash, or
+// UNSIGNED-PAYLOAD.
+func signAWSv4(req *http.Request, creds awsCredentials, region, service string, t time.Time) {
+	t = t.UTC()
+	amzDate := t.Format("20060102T150405Z")
+	date := t.Format("20060102")
+	req.Header.Set("X-Amz-Date", amzDate)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for k, v := range req.Header {
+		headers[strings.ToLower(k)] = strings.TrimSpace(strings.Join(v, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, k := range names {
+		canonicalHeaders.WriteString(k + ":" + headers[k] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	path := req.URL.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		path,
+		awsCanonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		req.Header.Get("X-Amz-Content-Sha256"),
+	}, "\n")
+
+	scope := date + "/" + region + "/" + service + "/aws4_request"
+	sum := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(sum[:])
+
+	key := hmacSHA256([]byte("AWS4"+creds.secretKey), date)
+	key = hmacSHA256(key, region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+creds.accessKey+"/"+scope+
+		", SignedHeaders="+signedHeaders+", Signature="+signature)
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// awsEscapePath escapes an object key for use in a request path,
+// leaving the separating slashes intact.
+func awsEscapePath(key string) string {
+	segments := strings.Split(key, "/")
+	for i, s := range segments {
+		segments[i] = awsEscape(s)
+	}
+	return strings.Join(segments, "/")
+}
+
+// awsEscape percent encodes every byte of s except the unreserved
+// characters, as required by Signature Version 4.
+func awsEscape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' ||
+			c == '-' || c == '_' || c == '.' || c == '~' {
+			b.WriteByte(c)
+			continue
+		}
+		fmt.Fprintf(&b, "%%%02X", c)
+	}
+	return b.String()
+}
+
+func awsCanonicalQuery(q url.Values) string {
+	var params []string
+	for k, vs := range q {
+		for _, v := range vs {
+			params = append(params, awsEscape(k)+"="+awsEscape(v))
+		}
+	}
+	sort.Strings(params)
+	return strings.Join(params, "&")
+}
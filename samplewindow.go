@@ -0,0 +1,32 @@
+package profile
+
+import (
+	"fmt"
+	"time"
+)
+
+// SampleWindow returns a Trigger which profiles the process for
+// profileFor out of every period, for example for 10 seconds of every
+// 10 minutes, giving regular visibility of a production process at a
+// fraction of the cost of profiling it continuously. The kind of
+// profiling is selected by the options given to Watch, and is cpu
+// profiling if none is given. The first window starts one period
+// after Watch is called.
+func SampleWindow(profileFor, every time.Duration) Trigger {
+	return Trigger{
+		Interval: every,
+		Duration: profileFor,
+		name:     "window",
+		check: func() (func() (bool, string), error) {
+			if profileFor <= 0 || profileFor >= every {
+				return nil, fmt.Errorf("profile: SampleWindow requires a positive duration shorter than the period")
+			}
+			return func() (bool, string) {
+				return true, fmt.Sprintf("sampling for %v of every %v", profileFor, every)
+			}, nil
+		},
+		capture: func(w *Watcher) error {
+			return w.session(w.trigger.modes[0], w.trigger.Duration)
+		},
+	}
+}
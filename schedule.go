@@ -0,0 +1,146 @@
+package profile
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule returns a Trigger which profiles the process in the given
+// mode for d at the times described by spec, a cron expression of
+// five fields: minute, hour, day of month, month and day of week,
+// where Sunday is 0 or 7. Each field is *, a number, a range such as
+// 1-5, or a list of these separated by commas, and * and ranges may be
+// followed by a step such as */15. For example
+//
+//	Schedule("*/15 * * * *", CPUMode, 30*time.Second)
+//
+// profiles the cpu for 30 seconds every 15 minutes, local time. If d is
+// zero, profiles which are written when the session stops, such as
+// memory profiles, are written immediately. Give Retention to Watch to
+// keep only the most recent files.
+func Schedule(spec string, mode Mode, d time.Duration) Trigger {
+	return Trigger{
+		Interval: DefaultTriggerInterval,
+		Duration: d,
+		name:     "schedule",
+		modes:    []Mode{mode},
+		check: func() (func() (bool, string), error) {
+			if !mode.valid() {
+				return nil, fmt.Errorf("profile: unknown mode %v", mode)
+			}
+			s, err := parseCron(spec)
+			if err != nil {
+				return nil, err
+			}
+			var last time.Time // the minute the trigger last fired
+			return func() (bool, string) {
+				now := time.Now().Truncate(time.Minute)
+				if now.Equal(last) || !s.matches(now) {
+					return false, ""
+				}
+				last = now
+				return true, fmt.Sprintf("schedule %q", spec)
+			}, nil
+		},
+		capture: func(w *Watcher) error {
+			return w.session(mode, w.trigger.Duration)
+		},
+	}
+}
+
+// cronSchedule holds the times matched by a cron expression as
+// bit sets, one for each field.
+type cronSchedule struct {
+	minute, hour, dom, month, dow uint64
+
+	// domStar and dowStar record if the day fields are *; if
+	// neither is, a day matching either field matches.
+	domStar, dowStar bool
+}
+
+// parseCron parses a cron expression of five fields.
+func parseCron(spec string) (*cronSchedule, error) {
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("profile: schedule %q must have five fields", spec)
+	}
+	var s cronSchedule
+	for i, f := range []struct {
+		bits     *uint64
+		min, max int
+	}{
+		{&s.minute, 0, 59},
+		{&s.hour, 0, 23},
+		{&s.dom, 1, 31},
+		{&s.month, 1, 12},
+		{&s.dow, 0, 7},
+	} {
+		bits, err := parseCronField(fields[i], f.min, f.max)
+		if err != nil {
+			return nil, fmt.Errorf("profile: schedule %q: %v", spec, err)
+		}
+		*f.bits = bits
+	}
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1 // 7 is also Sunday
+	}
+	s.domStar, s.dowStar = fields[2] == "*", fields[4] == "*"
+	return &s, nil
+}
+
+// parseCronField parses a field of a cron expression, returning the
+// set of values between min and max which it matches.
+func parseCronField(field string, min, max int) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rng, step := part, 1
+		if i := strings.IndexByte(part, '/'); i >= 0 {
+			n, err := strconv.Atoi(part[i+1:])
+			if err != nil || n < 1 {
+				return 0, fmt.Errorf("invalid step in %q", part)
+			}
+			rng, step = part[:i], n
+		}
+		lo, hi := min, max
+		switch {
+		case rng == "*":
+		case strings.IndexByte(rng, '-') >= 0:
+			i := strings.IndexByte(rng, '-')
+			var err error
+			if lo, err = strconv.Atoi(rng[:i]); err != nil {
+				return 0, fmt.Errorf("invalid range %q", part)
+			}
+			if hi, err = strconv.Atoi(rng[i+1:]); err != nil {
+				return 0, fmt.Errorf("invalid range %q", part)
+			}
+		default:
+			n, err := strconv.Atoi(rng)
+			if err != nil || step != 1 {
+				return 0, fmt.Errorf("invalid value %q", part)
+			}
+			lo, hi = n, n
+		}
+		if lo < min || hi > max || lo > hi {
+			return 0, fmt.Errorf("%q is outside the range %d-%d", part, min, max)
+		}
+		for n := lo; n <= hi; n += step {
+			bits |= 1 << uint(n)
+		}
+	}
+	return bits, nil
+}
+
+// matches reports whether t is within a minute matched by s.
+func (s *cronSchedule) matches(t time.Time) bool {
+	has := func(bits uint64, n int) bool { return bits&(1<<uint(n)) != 0 }
+	if !has(s.minute, t.Minute()) || !has(s.hour, t.Hour()) || !has(s.month, int(t.Month())) {
+		return false
+	}
+	dom, dow := has(s.dom, t.Day()), has(s.dow, int(t.Weekday()))
+	if s.domStar || s.dowStar {
+		return dom && dow
+	}
+	return dom || dow
+}
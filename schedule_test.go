@@ -0,0 +1,70 @@
+package profile
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParseCron(t *testing.T) {
+	at := func(s string) time.Time {
+		tm, err := time.Parse("2006-01-02 15:04", s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tm
+	}
+	tests := []struct {
+		spec string
+		time string
+		want bool
+	}{
+		{"* * * * *", "2024-03-05 13:07", true},
+		{"*/15 * * * *", "2024-03-05 13:45", true},
+		{"*/15 * * * *", "2024-03-05 13:46", false},
+		{"0 9-17/2 * * *", "2024-03-05 11:00", true},
+		{"0 9-17/2 * * *", "2024-03-05 12:00", false},
+		{"30 2 1,15 * *", "2024-03-15 02:30", true},
+		{"30 2 * 6 *", "2024-03-15 02:30", false},
+		{"0 0 * * 7", "2024-03-10 00:00", true}, // a Sunday
+		{"0 0 * * 0", "2024-03-10 00:00", true},
+		{"0 0 * * 1-5", "2024-03-10 00:00", false},
+		{"0 0 1 * 1", "2024-03-11 00:00", true}, // either day field
+		{"0 0 1 * 1", "2024-03-12 00:00", false},
+	}
+	for _, tt := range tests {
+		s, err := parseCron(tt.spec)
+		if err != nil {
+			t.Errorf("%q: %v", tt.spec, err)
+			continue
+		}
+		if got := s.matches(at(tt.time)); got != tt.want {
+			t.Errorf("%q at %s: got %v, want %v", tt.spec, tt.time, got, tt.want)
+		}
+	}
+
+	for _, spec := range []string{"", "* * * *", "60 * * * *", "*/0 * * * *", "5-1 * * * *", "a * * * *", "1/2 * * * *", "* * 0 * *"} {
+		if _, err := parseCron(spec); err == nil {
+			t.Errorf("%q: expected error", spec)
+		}
+	}
+}
+
+func TestSchedule(t *testing.T) {
+	dir := t.TempDir()
+	trigger := Schedule("* * * * *", GoroutineMode, 0)
+	trigger.Interval = 10 * time.Millisecond
+	w, err := Watch(trigger, ProfilePath(dir), Quiet, NoShutdownHook)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := waitForFiles(t, w, 1)
+	w.Stop()
+	if matched, _ := filepath.Match(filepath.Join(dir, "goroutine-schedule-*.pprof"), files[0]); !matched {
+		t.Fatalf("got file %q, want a goroutine-schedule profile", files[0])
+	}
+
+	if _, err := Watch(Schedule("* * *", CPUMode, time.Second)); err == nil {
+		t.Fatal("expected error for invalid schedule")
+	}
+}
@@ -0,0 +1,258 @@
+package profile
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"sync"
+	"time"
+)
+
+// ShutdownOnQuit adds SIGQUIT to the signals, by default SIGINT and
+// SIGTERM, which the shutdown hook catches to stop profiling and write the
+// session's data before exiting. By default SIGQUIT is left to the
+// Go runtime, which dumps the stacks of all goroutines and exits
+// without writing profiles. ShutdownOnQuit has no effect when
+// combined with NoShutdownHook, or on platforms without SIGQUIT.
+func ShutdownOnQuit(p *Profile) error {
+	p.shutdownOnQuit = true
+	return nil
+}
+
+// ShutdownSignals sets the signals which the shutdown hook catches to
+// stop profiling and write the session's data before exiting, in
+// place of the default SIGINT and SIGTERM. Signals hooked by other
+// sessions remain hooked. ShutdownSignals has no effect when combined
+// with NoShutdownHook.
+func ShutdownSignals(sig ...os.Signal) Option {
+	return func(p *Profile) error {
+		if len(sig) == 0 {
+			return fmt.Errorf("profile: ShutdownSignals requires at least one signal, see NoShutdownHook")
+		}
+		p.shutdownSigs = sig
+		return nil
+	}
+}
+
+// ShutdownExitCode sets the status with which the program exits after
+// the shutdown hook has stopped profiling. By default the hook ends
+// the program with the signal it caught, as if it had not been
+// hooked. ShutdownExitCode replaces an earlier ShutdownNoExit.
+func ShutdownExitCode(code int) Option {
+	return func(p *Profile) error {
+		if code < 0 || code > 255 {
+			return fmt.Errorf("profile: invalid shutdown exit code %d", code)
+		}
+		p.shutdownExitCode, p.shutdownNoExit, p.shutdownNotify = &code, false, nil
+		return nil
+	}
+}
+
+// ShutdownNoExit stops the shutdown hook from exiting the program
+// once it has stopped profiling, leaving the application, which
+// should handle the signal itself, to decide when to exit. As an
+// application's own signal handler races with the hook, see
+// ShutdownNotify to handle the signal once profiling has stopped.
+// ShutdownNoExit replaces an earlier ShutdownExitCode.
+func ShutdownNoExit(p *Profile) error {
+	p.shutdownExitCode, p.shutdownNoExit, p.shutdownNotify = nil, true, nil
+	return nil
+}
+
+// ShutdownNotify lets an application which handles signals itself
+// cooperate with the shutdown hook. In place of the application
+// calling signal.Notify, the hook relays each signal it catches to c
+// once it has stopped profiling, and does not exit the program. Like
+// signal.Notify, the hook does not block sending to c, so c should be
+// buffered, and c remains registered after the session stops.
+// ShutdownNotify replaces an earlier ShutdownExitCode or
+// ShutdownNoExit.
+func ShutdownNotify(c chan<- os.Signal) Option {
+	return func(p *Profile) error {
+		if c == nil {
+			return fmt.Errorf("profile: ShutdownNotify requires a channel")
+		}
+		p.shutdownExitCode, p.shutdownNoExit, p.shutdownNotify = nil, true, c
+		return nil
+	}
+}
+
+// ShutdownTimeout limits how long the shutdown hook waits for the
+// session to stop, for example while its files are uploaded. Once d
+// has passed, the hook logs the sessions which have not stopped and
+// carries on, usually exiting the program. If several running
+// sessions set a timeout, the hook waits for the longest.
+func ShutdownTimeout(d time.Duration) Option {
+	return func(p *Profile) error {
+		if d <= 0 {
+			return fmt.Errorf("profile: shutdown timeout must be positive")
+		}
+		p.shutdownTimeout = d
+		return nil
+	}
+}
+
+// shutdownSignals returns the signals the shutdown hook catches for
+// the session.
+func (p *Profile) shutdownSignals() []os.Signal {
+	signals := p.shutdownSigs
+	if signals == nil {
+		signals = terminateSignals
+	}
+	signals = append([]os.Signal(nil), signals...)
+	if p.shutdownOnQuit && quitSignal != nil {
+		signals = append(signals, quitSignal)
+	}
+	return signals
+}
+
+var hook struct {
+	// mu protects the fields of hook.
+	mu sync.Mutex
+
+	// c receives the signals caught by the shutdown hook; it is nil
+	// until the hook is installed.
+	c chan os.Signal
+
+	// signals holds the signals delivered to c.
+	signals map[os.Signal]bool
+
+	// notify hold the channels registered by ShutdownNotify.
+	notify []chan<- os.Signal
+
+	// flushed is closed once the hook has stopped the running
+	// sessions.
+	flushed chan struct{}
+}
+
+// installShutdownHook hooks the given signals, in addition to any
+// hooked by earlier sessions, to stop all running sessions that have
+// not disabled the shutdown hook, then terminate the program as the
+// signal would have. If notify is not nil, it is registered to
+// receive the signals instead.
+func installShutdownHook(signals []os.Signal, notify chan<- os.Signal) {
+	hook.mu.Lock()
+	defer hook.mu.Unlock()
+	if hook.c == nil {
+		hook.c = make(chan os.Signal, 1)
+		hook.signals = make(map[os.Signal]bool)
+		hook.flushed = make(chan struct{})
+		installConsoleHandler()
+		go shutdownHook(hook.c, hook.flushed)
+	}
+	var add []os.Signal
+	for _, sig := range signals {
+		if !hook.signals[sig] {
+			hook.signals[sig] = true
+			add = append(add, sig)
+		}
+	}
+	if len(add) > 0 {
+		signal.Notify(hook.c, add...)
+	}
+	if notify != nil && !registered(hook.notify, notify) {
+		hook.notify = append(hook.notify, notify)
+	}
+}
+
+func registered(cs []chan<- os.Signal, c chan<- os.Signal) bool {
+	for _, rc := range cs {
+		if rc == c {
+			return true
+		}
+	}
+	return false
+}
+
+// shutdownHook stops the running sessions each time a signal is
+// received on c, closing flushed after the first. If channels have
+// been registered by ShutdownNotify it relays the signal to them.
+// Otherwise, unless one of the sessions set ShutdownNoExit, it exits,
+// with the highest status set by ShutdownExitCode, or else with the
+// signal.
+func shutdownHook(c chan os.Signal, flushed chan struct{}) {
+	for sig := range c {
+		log.Printf("profile: caught %v, stopping profiles", sig)
+		var sessions []*Profile
+		exit, code, timeout := true, -1, time.Duration(0)
+		for _, p := range running() {
+			if p.noShutdownHook {
+				continue
+			}
+			sessions = append(sessions, p)
+			if p.shutdownTimeout > timeout {
+				timeout = p.shutdownTimeout
+			}
+			if p.shutdownNoExit {
+				exit = false
+			}
+			if p.shutdownExitCode != nil && *p.shutdownExitCode > code {
+				code = *p.shutdownExitCode
+			}
+		}
+		stopSessions(sessions, timeout, c)
+		if flushed != nil {
+			close(flushed)
+			flushed = nil
+		}
+
+		hook.mu.Lock()
+		notify := hook.notify
+		hook.mu.Unlock()
+		for _, nc := range notify {
+			select {
+			case nc <- sig:
+			default:
+			}
+		}
+		if len(notify) > 0 {
+			exit = false
+		}
+
+		switch {
+		case !exit:
+		case code >= 0:
+			os.Exit(code)
+		default:
+			raise(sig)
+		}
+	}
+}
+
+// stopSessions stops the given sessions concurrently, waiting for at
+// most timeout, if not zero, and logging those which have not stopped
+// when it expires. If another signal is received on c while it waits,
+// the program is terminated at once, so that a user whose profiles
+// will not flush can interrupt the program again to end it.
+func stopSessions(sessions []*Profile, timeout time.Duration, c chan os.Signal) {
+	stopped := make(chan *Profile, len(sessions))
+	pending := make(map[*Profile]bool)
+	for _, p := range sessions {
+		pending[p] = true
+		go func(p *Profile) {
+			p.Stop()
+			stopped <- p
+		}(p)
+	}
+	var expired <-chan time.Time
+	if timeout > 0 {
+		t := time.NewTimer(timeout)
+		defer t.Stop()
+		expired = t.C
+	}
+	for len(pending) > 0 {
+		select {
+		case p := <-stopped:
+			delete(pending, p)
+		case <-expired:
+			for p := range pending {
+				log.Printf("profile: timed out after %v stopping %v profiling", timeout, p.mode)
+			}
+			return
+		case sig := <-c:
+			log.Printf("profile: caught %v while stopping profiles, exiting", sig)
+			raise(sig)
+		}
+	}
+}
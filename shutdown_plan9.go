@@ -0,0 +1,20 @@
+package profile
+
+import "os"
+
+// terminateSignals hold the signals the shutdown hook catches by
+// default.
+var terminateSignals = []os.Signal{os.Interrupt}
+
+// quitSignal holds the signal added by ShutdownOnQuit, which plan9
+// does not have.
+var quitSignal os.Signal
+
+// exitStatus returns the status a shell reports for a process killed
+// by sig; plan9 notes have no numbers, so use that of SIGINT.
+func exitStatus(sig os.Signal) int {
+	if sig == os.Interrupt {
+		return 130
+	}
+	return 1
+}
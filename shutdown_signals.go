@@ -0,0 +1,26 @@
+//go:build !plan9
+// +build !plan9
+
+package profile
+
+import (
+	"os"
+	"syscall"
+)
+
+// terminateSignals hold the signals the shutdown hook catches by
+// default. Service managers such as systemd and Kubernetes stop a
+// process by sending SIGTERM.
+var terminateSignals = []os.Signal{os.Interrupt, syscall.SIGTERM}
+
+// quitSignal holds the signal added by ShutdownOnQuit.
+var quitSignal os.Signal = syscall.SIGQUIT
+
+// exitStatus returns the status a shell reports for a process killed
+// by sig, 128 plus the signal number.
+func exitStatus(sig os.Signal) int {
+	if s, ok := sig.(syscall.Signal); ok {
+		return 128 + int(s)
+	}
+	return 1
+}
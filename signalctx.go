@@ -0,0 +1,58 @@
+package profile
+
+import (
+	"context"
+	"sync"
+)
+
+// StartWithSignals starts a new profiling session and returns a copy of
+// ctx which is done once the process receives one of the session's
+// shutdown signals, SIGINT and SIGTERM unless set by ShutdownSignals,
+// ctx is done, or the returned stop function is called. In each case
+// the session is stopped, and its data written, before the returned
+// context is done, so a program may simply return once it is. The
+// signals are not passed to the shutdown hook, which is not installed
+// for the session. Calling stop also stops the signals being caught,
+// restoring their default behaviour, and waits for the session to stop.
+func StartWithSignals(ctx context.Context, options ...Option) (context.Context, func(), error) {
+	options = append(options[:len(options):len(options)], NoShutdownHook)
+	prof, err := StartErr(options...)
+	if err != nil {
+		return nil, nil, err
+	}
+	sctx, stopNotify := notifyContext(ctx, prof.shutdownSignals()...)
+	fctx := &flushContext{Context: ctx, done: make(chan struct{})}
+	go func() {
+		<-sctx.Done()
+		prof.Stop()
+		fctx.mu.Lock()
+		fctx.err = sctx.Err()
+		fctx.mu.Unlock()
+		close(fctx.done)
+	}()
+	stop := func() {
+		stopNotify()
+		<-fctx.done
+	}
+	return fctx, stop, nil
+}
+
+// flushContext is a context which is done once a profiling session,
+// stopped when its parent is done, has written its data.
+type flushContext struct {
+	context.Context
+
+	done chan struct{}
+
+	// mu protects err.
+	mu  sync.Mutex
+	err error
+}
+
+func (c *flushContext) Done() <-chan struct{} { return c.done }
+
+func (c *flushContext) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
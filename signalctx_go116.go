@@ -0,0 +1,16 @@
+//go:build go1.16
+// +build go1.16
+
+package profile
+
+import (
+	"context"
+	"os"
+	"os/signal"
+)
+
+// notifyContext returns a copy of ctx which is done when one of the
+// given signals is received, see signal.NotifyContext.
+func notifyContext(ctx context.Context, signals ...os.Signal) (context.Context, context.CancelFunc) {
+	return signal.NotifyContext(ctx, signals...)
+}
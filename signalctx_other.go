@@ -0,0 +1,27 @@
+//go:build !go1.16
+// +build !go1.16
+
+package profile
+
+import (
+	"context"
+	"os"
+	"os/signal"
+)
+
+// notifyContext returns a copy of ctx which is done when one of the
+// given signals is received, like signal.NotifyContext in Go 1.16.
+func notifyContext(ctx context.Context, signals ...os.Signal) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(ctx)
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, signals...)
+	go func() {
+		select {
+		case <-c:
+			cancel()
+		case <-ctx.Done():
+		}
+		signal.Stop(c)
+	}()
+	return ctx, cancel
+}
@@ -0,0 +1,40 @@
+package profile
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestStartWithSignals(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		stop func(cancel context.CancelFunc, stop func())
+	}{
+		{"stop", func(_ context.CancelFunc, stop func()) { stop() }},
+		{"parent done", func(cancel context.CancelFunc, _ func()) { cancel() }},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			parent, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			ctx, stop, err := StartWithSignals(parent, GoroutineProfile, ProfilePath(dir), Quiet)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer stop()
+			if ctx.Err() != nil {
+				t.Fatalf("context done before stopping: %v", ctx.Err())
+			}
+			tt.stop(cancel, stop)
+			<-ctx.Done()
+			if ctx.Err() != context.Canceled {
+				t.Errorf("got error %v, want %v", ctx.Err(), context.Canceled)
+			}
+			if _, err := os.Stat(filepath.Join(dir, "goroutine.pprof")); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
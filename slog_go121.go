@@ -0,0 +1,35 @@
+//go:build go1.21
+// +build go1.21
+
+package profile
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+)
+
+// WithSlog logs the session's messages to l as structured records,
+// in place of the standard logger. Messages such as "cpu profiling
+// enabled" have attributes holding the session's mode and, where
+// they apply, the path of the file written, the profiling rate, the
+// name of the profile and any error, which is logged at level Error;
+// other messages are logged at level Info. WithSlog replaces an
+// earlier JSONEvents. Quiet suppresses the messages as before.
+func WithSlog(l *slog.Logger) Option {
+	return func(p *Profile) error {
+		if l == nil {
+			return fmt.Errorf("profile: WithSlog requires a logger")
+		}
+		p.logger = func(msg string, attrs ...interface{}) {
+			level := slog.LevelInfo
+			for i := 0; i < len(attrs); i += 2 {
+				if attrs[i] == "error" {
+					level = slog.LevelError
+				}
+			}
+			l.Log(context.Background(), level, msg, attrs...)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,50 @@
+//go:build go1.21
+// +build go1.21
+
+package profile
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"path/filepath"
+	"testing"
+)
+
+func TestWithSlog(t *testing.T) {
+	dir := t.TempDir()
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, nil))
+	p, err := StartErr(MemProfileRate(2048), WithSlog(logger), ProfilePath(dir), NoShutdownHook)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Stop()
+
+	fn := filepath.Join(dir, "mem.pprof")
+	want := []map[string]interface{}{
+		{"level": "INFO", "msg": "memory profiling enabled", "mode": "mem", "rate": 2048.0, "path": fn},
+		{"level": "INFO", "msg": "memory profiling disabled", "mode": "mem", "path": fn},
+	}
+	dec := json.NewDecoder(&buf)
+	for _, w := range want {
+		var got map[string]interface{}
+		if err := dec.Decode(&got); err != nil {
+			t.Fatal(err)
+		}
+		delete(got, "time")
+		if len(got) != len(w) {
+			t.Errorf("got record %v, want %v", got, w)
+			continue
+		}
+		for k, v := range w {
+			if got[k] != v {
+				t.Errorf("got record %v, want %v", got, w)
+				break
+			}
+		}
+	}
+	if dec.More() {
+		t.Errorf("unexpected records after %v", want)
+	}
+}
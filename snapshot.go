@@ -0,0 +1,92 @@
+package profile
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Snapshot writes a numbered snapshot of the session's profile every
+// interval, for example goroutine-0001.pprof, goroutine-0002.pprof
+// and so on, in addition to the profile written when the session
+// stops. Comparing successive snapshots, for example with the -base
+// flag of go tool pprof, shows how a leak develops over time.
+// Snapshot is valid with memory, mutex, block, thread creation,
+// goroutine and custom profiling.
+func Snapshot(interval time.Duration) Option {
+	return func(p *Profile) error {
+		if interval <= 0 {
+			return fmt.Errorf("profile: snapshot interval must be positive")
+		}
+		p.snapshotInterval = interval
+		return nil
+	}
+}
+
+// snapshotNames returns the default name of the files written by the
+// session and the name of the profile passed to pprof.Lookup.
+func (prof *Profile) snapshotNames() (name, profile string) {
+	switch prof.mode {
+	case MemMode:
+		return "mem", prof.memProfileType
+	case ThreadCreateMode:
+		return "threadcreation", "threadcreate"
+	case CustomMode:
+		return strings.Replace(prof.customProfile, string(filepath.Separator), "_", -1), prof.customProfile
+	default:
+		return prof.mode.String(), prof.mode.String()
+	}
+}
+
+// startSnapshots starts writing snapshots of the session's profile,
+// stopping before the final profile is written by prof.closer.
+func (prof *Profile) startSnapshots() {
+	name, profile := prof.snapshotNames()
+	snapshot := func(n int) error {
+		start := time.Now()
+		w, fn, err := prof.createLookup(fmt.Sprintf("%s-%04d", name, n))
+		if err != nil {
+			return fmt.Errorf("profile: could not create %s snapshot %q: %v", profile, fn, err)
+		}
+		if err := prof.writeLookup(w, profile); err != nil {
+			return fmt.Errorf("profile: could not write %s snapshot %q: %v", profile, fn, err)
+		}
+		prof.recordSnapshot(start, fn)
+		prof.logAttrs("profile: "+profile+" snapshot written", "name", profile, "path", fn)
+		return nil
+	}
+
+	quit := make(chan struct{})
+	done := make(chan error, 1)
+	go func() {
+		t := time.NewTicker(prof.snapshotInterval)
+		defer t.Stop()
+		var err error
+		for n := 1; ; n++ {
+			select {
+			case <-t.C:
+				serr := snapshot(n)
+				if serr != nil {
+					prof.logError(serr)
+				}
+				if err == nil {
+					err = serr
+				}
+			case <-quit:
+				done <- err
+				return
+			}
+		}
+	}()
+
+	closer := prof.closer
+	prof.closer = func() error {
+		close(quit)
+		err := <-done
+		if cerr := closer(); err == nil {
+			err = cerr
+		}
+		return err
+	}
+}
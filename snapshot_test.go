@@ -0,0 +1,42 @@
+package profile
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	p, err := StartErr(GoroutineProfile, Snapshot(20*time.Millisecond), ProfilePath(dir), Quiet, NoShutdownHook)
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(70 * time.Millisecond)
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+	files := p.Result().Files
+	if len(files) < 3 {
+		t.Fatalf("got %d files, want at least 3: %q", len(files), files)
+	}
+	if want := filepath.Join(dir, "goroutine.pprof"); files[0] != want {
+		t.Fatalf("got profile %q, want %q", files[0], want)
+	}
+	for i, fn := range files {
+		if i > 0 {
+			if want := filepath.Join(dir, fmt.Sprintf("goroutine-%04d.pprof", i)); fn != want {
+				t.Fatalf("got snapshot %q, want %q", fn, want)
+			}
+		}
+		buf, err := ioutil.ReadFile(fn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := parseProto(buf); err != nil {
+			t.Fatalf("%s: %v", fn, err)
+		}
+	}
+}
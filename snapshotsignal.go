@@ -0,0 +1,100 @@
+package profile
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime/pprof"
+	"strings"
+	"time"
+)
+
+// SnapshotSignal writes a snapshot of each of the named profiles, as
+// returned by pprof.Lookup, each time sig, typically syscall.SIGUSR2,
+// is received while the session is running. If no names are given,
+// heap and goroutine profiles are written. Snapshots are written to
+// the profile directory with the time they were taken in their name,
+// for example heap-20060102T150405Z.pprof, and do not affect the
+// session's own profile.
+func SnapshotSignal(sig os.Signal, names ...string) Option {
+	return func(p *Profile) error {
+		if sig == nil {
+			return fmt.Errorf("profile: SnapshotSignal requires a signal")
+		}
+		for _, name := range names {
+			if !validSnapshotName(name) {
+				return fmt.Errorf("profile: invalid snapshot profile name %q", name)
+			}
+		}
+		if len(names) == 0 {
+			names = []string{"heap", "goroutine"}
+		}
+		p.snapshotSignal, p.snapshotProfiles = sig, names
+		return nil
+	}
+}
+
+// validSnapshotName reports whether name may be used as the name of a
+// snapshot, which is part of the name of the file it is written to,
+// and so must be a single path element.
+func validSnapshotName(name string) bool {
+	return name != "" && name != "." && name != ".." && filepath.Base(name) == name && !strings.ContainsAny(name, `/\`)
+}
+
+// startSignalSnapshots writes snapshots each time the snapshot signal
+// is received, until prof.closer is called.
+func (prof *Profile) startSignalSnapshots() {
+	stop := dumpOnSignal([]os.Signal{prof.snapshotSignal}, func(int) {
+		ts := time.Now().UTC().Format(timestampLayout)
+		for _, name := range prof.snapshotProfiles {
+			fn, err := prof.writeSnapshot(name, ts, 0)
+			if err != nil {
+				prof.logAttrs("profile: could not write "+name+" snapshot", "name", name, "error", err)
+				continue
+			}
+			prof.logAttrs("profile: "+name+" snapshot written", "name", name, "path", fn)
+		}
+	})
+	closer := prof.closer
+	prof.closer = func() error {
+		stop()
+		return closer()
+	}
+}
+
+// writeSnapshot writes the profile called name, in the format given
+// by debug, to a file named with the suffix, typically a timestamp.
+func (prof *Profile) writeSnapshot(name, suffix string, debug int) (string, error) {
+	start := time.Now()
+	lp := pprof.Lookup(name)
+	if lp == nil {
+		return "", fmt.Errorf("unknown profile %q", name)
+	}
+	base := filepath.Join(prof.dir, name+"-"+suffix+".pprof")
+	if debug > 0 {
+		base = strings.TrimSuffix(base, ".pprof") + ".txt"
+	}
+	fn := base
+	for n := 1; ; n++ {
+		// more than one snapshot was taken within a second
+		if _, err := os.Stat(fn); os.IsNotExist(err) {
+			break
+		}
+		fn = numberedFilename(base, n)
+	}
+	f, err := prof.createFile(fn)
+	if err != nil {
+		return fn, err
+	}
+	w := prof.withBuildInfo(f, fn)
+	err = lp.WriteTo(w, debug)
+	if cerr := w.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fn, err
+	}
+	prof.addFile(fn)
+	prof.recordSnapshot(start, fn)
+	return fn, nil
+}
@@ -0,0 +1,76 @@
+package profile
+
+import (
+	"expvar"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// stats hold counters of the profiling performed by the program.
+var stats struct {
+	// bytesWritten holds the size of the files written.
+	bytesWritten int64
+
+	// snapshots holds the number of snapshots written, see
+	// Snapshot, SnapshotSignal and Watchdog, and snapshotNanos the
+	// time taken to write them.
+	snapshots     int64
+	snapshotNanos int64
+
+	// sessions holds the number of sessions begun.
+	sessions int64
+}
+
+// recordSnapshot records the snapshot written to fn, whose writing
+// began at start, in stats and as an event.
+func (p *Profile) recordSnapshot(start time.Time, fn string) {
+	atomic.AddInt64(&stats.snapshots, 1)
+	atomic.AddInt64(&stats.snapshotNanos, int64(time.Since(start)))
+	p.sendEvent(EventSnapshotWritten, fn, nil)
+}
+
+// publishOnce ensures the profile expvar is published at most once.
+var publishOnce sync.Once
+
+// publishExpvar publishes the state of the package's profiling as the
+// expvar called profile, once the first session begins, so that it is
+// served by /debug/vars. It holds
+//
+//	active           whether a session is running
+//	mode             the modes of the running sessions
+//	output_dir       the directories the running sessions write to
+//	bytes_written    the size of the files written by all sessions
+//	snapshots_taken  the number of snapshots written by all sessions
+//
+// If the program has already published a variable called profile, it
+// is left alone.
+func publishExpvar() {
+	if expvar.Get("profile") != nil {
+		return
+	}
+	expvar.Publish("profile", expvar.Func(profileVars))
+}
+
+func profileVars() interface{} {
+	modes, dirs := []string{}, []string{}
+	seen := make(map[string]bool)
+	sessions := running()
+	for _, p := range sessions {
+		modes = append(modes, p.mode.String())
+		if p.dir != "" && !seen[p.dir] {
+			seen[p.dir] = true
+			dirs = append(dirs, p.dir)
+		}
+	}
+	sort.Strings(modes)
+	sort.Strings(dirs)
+	return map[string]interface{}{
+		"active":          len(sessions) > 0,
+		"mode":            modes,
+		"output_dir":      dirs,
+		"bytes_written":   atomic.LoadInt64(&stats.bytesWritten),
+		"snapshots_taken": atomic.LoadInt64(&stats.snapshots),
+	}
+}
@@ -0,0 +1,53 @@
+package profile
+
+import (
+	"encoding/json"
+	"expvar"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestPublishExpvar(t *testing.T) {
+	dir := t.TempDir()
+	vars := func() (v struct {
+		Active         bool     `json:"active"`
+		Mode           []string `json:"mode"`
+		OutputDir      []string `json:"output_dir"`
+		BytesWritten   int64    `json:"bytes_written"`
+		SnapshotsTaken int64    `json:"snapshots_taken"`
+	}) {
+		ev := expvar.Get("profile")
+		if ev == nil {
+			t.Fatal("profile expvar not published")
+		}
+		if err := json.Unmarshal([]byte(ev.String()), &v); err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+
+	p, err := StartErr(GoroutineProfile, Snapshot(time.Millisecond), ProfilePath(dir), Quiet, NoShutdownHook)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for len(p.Files()) < 3 {
+		time.Sleep(time.Millisecond)
+	}
+	before := vars()
+	if !before.Active || !reflect.DeepEqual(before.Mode, []string{"goroutine"}) || !reflect.DeepEqual(before.OutputDir, []string{dir}) {
+		t.Errorf("got %+v while profiling goroutines to %s", before, dir)
+	}
+	if before.SnapshotsTaken < 1 || before.BytesWritten <= 0 {
+		t.Errorf("got %+v after writing snapshots", before)
+	}
+	p.Stop()
+
+	after := vars()
+	if after.Active || len(after.Mode) != 0 || len(after.OutputDir) != 0 {
+		t.Errorf("got %+v after stopping", after)
+	}
+	if after.BytesWritten <= before.BytesWritten {
+		t.Errorf("bytes written did not increase from %d to %d", before.BytesWritten, after.BytesWritten)
+	}
+}
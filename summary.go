@@ -0,0 +1,171 @@
+package profile
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// peakInterval is how often a session samples the heap size and the
+// number of goroutines, to report their peaks in its Summary.
+const peakInterval = time.Second
+
+// A Summary describes a stopped session. It is reported by Result, and
+// logged when the session stops if LogSummary is given.
+type Summary struct {
+	// Duration holds how long the session ran.
+	Duration time.Duration
+
+	// Samples holds the number of samples in the session's pprof
+	// files, for example the number of cpu samples or of sampled
+	// allocations.
+	Samples int64
+
+	// Sizes holds the size of each file the session wrote, by path.
+	Sizes map[string]int64
+
+	// PeakHeap holds the largest heap size, in bytes, observed
+	// while the session ran.
+	PeakHeap uint64
+
+	// PeakGoroutines holds the largest number of goroutines
+	// observed while the session ran.
+	PeakGoroutines int
+}
+
+// LogSummary logs the session's Summary when it stops, for example
+//
+//	profile: cpu session summary: ran for 30s, 2987 samples, 1 files, 41231 bytes, peak heap 8421376 bytes, peak 12 goroutines
+func LogSummary(p *Profile) error {
+	p.logSummary = true
+	return nil
+}
+
+// Bytes returns the total size of the session's files.
+func (s Summary) Bytes() int64 {
+	var n int64
+	for _, size := range s.Sizes {
+		n += size
+	}
+	return n
+}
+
+// peaks tracks the heap size and number of goroutines while a session
+// runs.
+type peaks struct {
+	mu         sync.Mutex
+	heap       uint64
+	goroutines int
+
+	quit chan struct{}
+	done chan struct{}
+}
+
+// sample records the current heap size and number of goroutines.
+func (pk *peaks) sample() {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	n := runtime.NumGoroutine()
+	pk.mu.Lock()
+	defer pk.mu.Unlock()
+	if ms.HeapAlloc > pk.heap {
+		pk.heap = ms.HeapAlloc
+	}
+	if n > pk.goroutines {
+		pk.goroutines = n
+	}
+}
+
+// startPeaks samples the heap size and number of goroutines every
+// peakInterval until stopPeaks is called. It is called once, when the
+// session begins, as the peaks span rotations and mode switches.
+func (prof *Profile) startPeaks() {
+	pk := &prof.peaks
+	quit, done := make(chan struct{}), make(chan struct{})
+	pk.quit, pk.done = quit, done
+	pk.sample()
+	go func() {
+		defer close(done)
+		t := time.NewTicker(peakInterval)
+		defer t.Stop()
+		for {
+			select {
+			case <-t.C:
+				pk.sample()
+			case <-quit:
+				return
+			}
+		}
+	}()
+}
+
+// stopPeaks takes a final sample and stops sampling.
+func (prof *Profile) stopPeaks() {
+	pk := &prof.peaks
+	if pk.quit == nil {
+		return
+	}
+	close(pk.quit)
+	<-pk.done
+	pk.sample()
+}
+
+// summary describes the session, which wrote files and ran for d.
+func (prof *Profile) summary(files []string, d time.Duration) Summary {
+	s := Summary{
+		Duration:       d,
+		Sizes:          make(map[string]int64),
+		PeakHeap:       prof.peaks.heap,
+		PeakGoroutines: prof.peaks.goroutines,
+	}
+	for _, fn := range files {
+		fi, err := os.Stat(fn)
+		if err != nil {
+			continue // removed by Retain or an uploader
+		}
+		s.Sizes[fn] = fi.Size()
+		if filepath.Ext(fn) == ".pprof" {
+			s.Samples += countSamples(fn)
+		}
+	}
+	return s
+}
+
+// countSamples returns the number of samples in the pprof file fn, or
+// zero if it cannot be read. Where the profile records a count with
+// each stack, as cpu and allocation profiles do, the counts are
+// summed.
+func countSamples(fn string) int64 {
+	data, err := ioutil.ReadFile(fn)
+	if err != nil {
+		return 0
+	}
+	p, err := parseProto(data)
+	if err != nil {
+		return 0
+	}
+	var counted bool
+	if len(p.sampleType) > 0 {
+		unit := p.sampleType[0].unit
+		counted = unit >= 0 && unit < int64(len(p.stringTable)) && p.stringTable[unit] == "count"
+	}
+	var n int64
+	for _, s := range p.sample {
+		if counted && len(s.value) > 0 {
+			n += s.value[0]
+		} else {
+			n++
+		}
+	}
+	return n
+}
+
+// String returns a one line description of s.
+func (s Summary) String() string {
+	return fmt.Sprintf("ran for %v, %d samples, %d files, %d bytes, peak heap %d bytes, peak %d goroutines",
+		s.Duration.Round(time.Millisecond), s.Samples, len(s.Sizes), s.Bytes(), s.PeakHeap, s.PeakGoroutines)
+}
@@ -0,0 +1,32 @@
+package profile
+
+import (
+	"testing"
+)
+
+func TestSummary(t *testing.T) {
+	p, err := StartErr(MemProfileRate(1), ProfilePath(t.TempDir()), Quiet, NoShutdownHook)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 1000; i++ {
+		sink = make([]byte, 64)
+	}
+	p.Stop()
+	r := p.Result()
+	s := r.Summary
+	if s.Duration <= 0 || s.Samples < 1000 || s.PeakHeap == 0 || s.PeakGoroutines == 0 {
+		t.Errorf("got summary %+v", s)
+	}
+	if len(s.Sizes) != len(r.Files) {
+		t.Fatalf("got sizes %v, want one for each of %q", s.Sizes, r.Files)
+	}
+	for _, fn := range r.Files {
+		if s.Sizes[fn] <= 0 {
+			t.Errorf("%s: got size %d", fn, s.Sizes[fn])
+		}
+	}
+	if s.Bytes() != s.Sizes[r.Files[0]] {
+		t.Errorf("got %d bytes, want %d", s.Bytes(), s.Sizes[r.Files[0]])
+	}
+}
@@ -0,0 +1,91 @@
+package profile
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// ProfileFilenameTemplate controls the filename of the profile file
+// to be written, like ProfileFilename, expanding placeholders when
+// the session begins so that profiles collected by a fleet of
+// programs describe where they came from. The placeholders are:
+//
+//	{hostname}	the name of the host, see os.Hostname
+//	{pid}		the process id
+//	{mode}		the profiling mode, for example cpu
+//	{ts}		the time the session began, as with Timestamp
+//	{tag}		the tag given by ProfileTag
+//
+// For example "{mode}-{hostname}-{pid}.pprof". The expanded filename
+// must not contain any path elements.
+func ProfileFilenameTemplate(tmpl string) Option {
+	return func(p *Profile) error {
+		if err := checkTemplate(tmpl); err != nil {
+			return err
+		}
+		if filepath.Base(tmpl) != tmpl {
+			return fmt.Errorf("profile: filename must not contain path elements")
+		}
+		p.fname = tmpl
+		p.fnameTemplate = true
+		return nil
+	}
+}
+
+// ProfileTag sets the value of the {tag} placeholder expanded by
+// ProfileFilenameTemplate, for example the name of a job or build.
+func ProfileTag(tag string) Option {
+	return func(p *Profile) error {
+		if strings.ContainsAny(tag, `/\`) {
+			return fmt.Errorf("profile: tag must not contain path separators")
+		}
+		p.tag = tag
+		return nil
+	}
+}
+
+// checkTemplate reports an error if tmpl contains an unknown or
+// unterminated placeholder.
+func checkTemplate(tmpl string) error {
+	for s := tmpl; ; {
+		i := strings.IndexByte(s, '{')
+		if i < 0 {
+			return nil
+		}
+		j := strings.IndexByte(s[i:], '}')
+		if j < 0 {
+			return fmt.Errorf("profile: unterminated placeholder in filename template %q", tmpl)
+		}
+		switch name := s[i+1 : i+j]; name {
+		case "hostname", "pid", "mode", "ts", "tag":
+		default:
+			return fmt.Errorf("profile: unknown placeholder {%s} in filename template %q", name, tmpl)
+		}
+		s = s[i+j+1:]
+	}
+}
+
+// expandTemplate expands the placeholders in tmpl.
+func (p *Profile) expandTemplate(tmpl string) string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	host = strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' {
+			return '_'
+		}
+		return r
+	}, host)
+	r := strings.NewReplacer(
+		"{hostname}", host,
+		"{pid}", strconv.Itoa(os.Getpid()),
+		"{mode}", p.mode.String(),
+		"{ts}", p.started.UTC().Format(timestampLayout),
+		"{tag}", p.tag,
+	)
+	return r.Replace(tmpl)
+}
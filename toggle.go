@@ -0,0 +1,45 @@
+package profile
+
+import (
+	"fmt"
+	"os"
+)
+
+// ToggleSignal defers profiling until one of the given signals,
+// typically syscall.SIGUSR1, is received. The first signal begins the
+// session and the second stops it and writes its data, so an operator
+// can profile a long running process on demand. Further signals are
+// ignored. ToggleSignal affects Start, StartErr, MustStart and
+// StartWithContext; a session created with New begins when Begin is
+// called. Stopping the session before it has begun writes nothing.
+func ToggleSignal(sig ...os.Signal) Option {
+	return func(p *Profile) error {
+		if len(sig) == 0 {
+			return fmt.Errorf("profile: ToggleSignal requires at least one signal")
+		}
+		p.toggleSignals = sig
+		return nil
+	}
+}
+
+// beginOnSignal begins the session on the first of the toggle
+// signals received and stops it on the second.
+func (p *Profile) beginOnSignal() {
+	stop := dumpOnSignal(p.toggleSignals, func(n int) {
+		switch n {
+		case 1:
+			p.logf("profile: caught toggle signal, starting %v profiling", p.mode)
+			if err := p.Begin(); err != nil {
+				p.logError(err)
+			}
+		case 2:
+			p.logf("profile: caught toggle signal, stopping %v profiling", p.mode)
+			p.Stop()
+		}
+	})
+	go func() {
+		<-p.done
+		stop()
+	}()
+	p.logf("profile: waiting for %v to start %v profiling", p.toggleSignals[0], p.mode)
+}
@@ -0,0 +1,29 @@
+package profile
+
+import (
+	"context"
+	"runtime/trace"
+)
+
+// TraceTask creates a runtime/trace task named name, returning a
+// context carrying the task and a function which ends it. If the
+// execution trace is not being recorded, for example because no
+// TraceProfile session is running, TraceTask returns ctx unchanged
+// and a function which does nothing.
+func TraceTask(ctx context.Context, name string) (context.Context, func()) {
+	if !trace.IsEnabled() {
+		return ctx, func() {}
+	}
+	ctx, task := trace.NewTask(ctx, name)
+	return ctx, task.End
+}
+
+// TraceRegion calls fn, recording the call as a runtime/trace
+// region named name if the execution trace is being recorded.
+func TraceRegion(ctx context.Context, name string, fn func()) {
+	if !trace.IsEnabled() {
+		fn()
+		return
+	}
+	trace.WithRegion(ctx, name, fn)
+}
@@ -1,8 +1,61 @@
 package profile_test
 
-import "github.com/pkg/profile"
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/pkg/profile"
+)
 
 func ExampleTraceProfile() {
 	// use execution tracing, rather than the default cpu profiling.
 	defer profile.Start(profile.TraceProfile).Stop()
 }
+
+func ExampleTraceSummary() {
+	// write trace-summary.txt, with scheduler latency percentiles,
+	// next to trace.out.
+	defer profile.Start(profile.TraceProfile, profile.TraceSummary).Stop()
+}
+
+func ExampleTraceTask() {
+	defer profile.Start(profile.TraceProfile).Stop()
+
+	// annotate the trace with a task containing a region.
+	ctx, end := profile.TraceTask(context.Background(), "request")
+	defer end()
+	profile.TraceRegion(ctx, "decode", func() {
+		// ...
+	})
+}
+
+func TestTraceTask(t *testing.T) {
+	ctx := context.Background()
+	if got, end := profile.TraceTask(ctx, "idle"); got != ctx {
+		t.Fatal("TraceTask changed the context while tracing was off")
+	} else {
+		end()
+	}
+
+	var buf bytes.Buffer
+	p, err := profile.StartErr(profile.TraceProfile, profile.WriteTo(&buf), profile.Quiet, profile.NoShutdownHook)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tctx, end := profile.TraceTask(ctx, "traced-task")
+	ran := false
+	profile.TraceRegion(tctx, "traced-region", func() { ran = true })
+	end()
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if !ran {
+		t.Fatal("TraceRegion did not call fn")
+	}
+	for _, name := range []string{"traced-task", "traced-region"} {
+		if !bytes.Contains(buf.Bytes(), []byte(name)) {
+			t.Errorf("trace does not mention %q", name)
+		}
+	}
+}
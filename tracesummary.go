@@ -0,0 +1,107 @@
+package profile
+
+import (
+	"fmt"
+	"math"
+	"path/filepath"
+	"time"
+)
+
+// TraceSummary requests that a TraceProfile session writes a short
+// report alongside trace.out when it stops, giving the median and
+// 99th percentile scheduler latency, the time goroutines spent
+// runnable before running, and the cpu time spent on GC assists
+// during the trace. The figures are taken from runtime/metrics at
+// the start and end of the session rather than by parsing the
+// trace, so they cover the whole program for the duration of the
+// trace. TraceSummary requires Go 1.20 or later.
+func TraceSummary(p *Profile) error {
+	p.traceSummary = true
+	return nil
+}
+
+// schedMetrics holds the runtime metrics reported by TraceSummary.
+type schedMetrics struct {
+	// latencies and buckets hold the scheduler latency histogram,
+	// where buckets has one more element than latencies.
+	latencies []uint64
+	buckets   []float64
+
+	gcAssist float64 // cpu-seconds
+	gcTotal  float64 // cpu-seconds
+}
+
+// startTraceSummary arranges for the summary to be written after
+// the trace has been stopped by the session's closer.
+func (prof *Profile) startTraceSummary() error {
+	before, err := readSchedMetrics()
+	if err != nil {
+		return err
+	}
+	start := time.Now()
+	closer := prof.closer
+	prof.closer = func() error {
+		err := closer()
+		if serr := prof.writeTraceSummary(before, time.Since(start)); err == nil {
+			err = serr
+		}
+		return err
+	}
+	return nil
+}
+
+func (prof *Profile) writeTraceSummary(before schedMetrics, d time.Duration) error {
+	after, err := readSchedMetrics()
+	if err != nil {
+		return err
+	}
+	counts := make([]uint64, len(after.latencies))
+	for i := range counts {
+		counts[i] = after.latencies[i] - before.latencies[i]
+	}
+
+	fn := filepath.Join(prof.dir, prof.outputName("trace-summary.txt"))
+	f, err := prof.createFile(fn)
+	if err != nil {
+		return fmt.Errorf("could not create trace summary %q: %v", fn, err)
+	}
+	fmt.Fprintf(f, "duration: %v\n", d)
+	fmt.Fprintf(f, "scheduler latency p50: %v\n", percentile(counts, after.buckets, 0.50))
+	fmt.Fprintf(f, "scheduler latency p99: %v\n", percentile(counts, after.buckets, 0.99))
+	fmt.Fprintf(f, "gc assist time: %v\n", seconds(after.gcAssist-before.gcAssist))
+	fmt.Fprintf(f, "gc total time: %v\n", seconds(after.gcTotal-before.gcTotal))
+	if err := f.Close(); err != nil {
+		return err
+	}
+	prof.addFile(fn)
+	prof.logAttrs("profile: trace summary written", "path", fn)
+	return nil
+}
+
+// percentile returns the smallest bucket boundary below which at
+// least fraction q of the counts in the histogram fall.
+func percentile(counts []uint64, buckets []float64, q float64) time.Duration {
+	var total uint64
+	for _, c := range counts {
+		total += c
+	}
+	if total == 0 {
+		return 0
+	}
+	target := uint64(math.Ceil(q * float64(total)))
+	var sum uint64
+	for i, c := range counts {
+		sum += c
+		if sum >= target {
+			if math.IsInf(buckets[i+1], 1) {
+				return seconds(buckets[i])
+			}
+			return seconds(buckets[i+1])
+		}
+	}
+	return seconds(buckets[len(buckets)-1])
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
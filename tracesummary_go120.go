@@ -0,0 +1,22 @@
+//go:build go1.20
+// +build go1.20
+
+package profile
+
+import "runtime/metrics"
+
+func readSchedMetrics() (schedMetrics, error) {
+	samples := []metrics.Sample{
+		{Name: "/sched/latencies:seconds"},
+		{Name: "/cpu/classes/gc/mark/assist:cpu-seconds"},
+		{Name: "/cpu/classes/gc/total:cpu-seconds"},
+	}
+	metrics.Read(samples)
+	h := samples[0].Value.Float64Histogram()
+	return schedMetrics{
+		latencies: append([]uint64(nil), h.Counts...),
+		buckets:   h.Buckets,
+		gcAssist:  samples[1].Value.Float64(),
+		gcTotal:   samples[2].Value.Float64(),
+	}, nil
+}
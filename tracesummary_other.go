@@ -0,0 +1,10 @@
+//go:build !go1.20
+// +build !go1.20
+
+package profile
+
+import "errors"
+
+func readSchedMetrics() (schedMetrics, error) {
+	return schedMetrics{}, errors.New("profile: TraceSummary requires Go 1.20 or later")
+}
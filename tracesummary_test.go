@@ -0,0 +1,60 @@
+//go:build go1.20
+// +build go1.20
+
+package profile
+
+import (
+	"io/ioutil"
+	"math"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPercentile(t *testing.T) {
+	buckets := []float64{0, 0.001, 0.002, math.Inf(1)}
+	tests := []struct {
+		counts []uint64
+		q      float64
+		want   time.Duration
+	}{
+		{[]uint64{0, 0, 0}, 0.5, 0},
+		{[]uint64{10, 0, 0}, 0.99, time.Millisecond},
+		{[]uint64{50, 49, 1}, 0.5, time.Millisecond},
+		{[]uint64{50, 49, 1}, 0.99, 2 * time.Millisecond},
+		{[]uint64{50, 48, 2}, 0.99, 2 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		if got := percentile(tt.counts, buckets, tt.q); got != tt.want {
+			t.Errorf("percentile(%v, %v): got %v, want %v", tt.counts, tt.q, got, tt.want)
+		}
+	}
+}
+
+func TestTraceSummary(t *testing.T) {
+	dir := t.TempDir()
+	p, err := StartErr(TraceProfile, TraceSummary, ProfilePath(dir), Quiet, NoShutdownHook)
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan bool)
+	for i := 0; i < 10; i++ {
+		go func() { spin(10 * time.Millisecond); done <- true }()
+	}
+	for i := 0; i < 10; i++ {
+		<-done
+	}
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+	buf, err := ioutil.ReadFile(filepath.Join(dir, "trace-summary.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"scheduler latency p50:", "scheduler latency p99:", "gc assist time:"} {
+		if !strings.Contains(string(buf), want) {
+			t.Errorf("summary does not contain %q:\n%s", want, buf)
+		}
+	}
+}
@@ -0,0 +1,224 @@
+package profile
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// Defaults for the fields of a Trigger.
+const (
+	DefaultTriggerInterval = time.Second
+	DefaultTriggerCooldown = 10 * time.Minute
+	DefaultTriggerDuration = 30 * time.Second
+)
+
+// A Trigger describes a condition, such as high cpu usage, which is
+// checked periodically by Watch, and the profiles captured when it
+// holds. Triggers are created by functions such as WhenCPUAbove; their
+// exported fields may be changed before the trigger is passed to
+// Watch.
+type Trigger struct {
+	// Interval holds how often the condition is checked.
+	Interval time.Duration
+
+	// Cooldown holds the minimum time between the start of one
+	// capture and the start of the next, so that a condition
+	// which persists does not fill the disk.
+	Cooldown time.Duration
+
+	// Duration holds how long profiles which are collected over
+	// time, such as cpu profiles, are collected for. If zero, the
+	// session capturing them is stopped as soon as it starts.
+	Duration time.Duration
+
+	// name identifies the trigger in file names and log messages.
+	name string
+
+	// modes hold the kinds of profiling performed by capture. If
+	// nil, Watch sets it to the mode selected by its options.
+	modes []Mode
+
+	// options hold options added to those given to Watch.
+	options []Option
+
+	// check returns a function which is called every Interval and
+	// reports whether the condition holds, with a description of
+	// the condition for log messages.
+	check func() (func() (bool, string), error)
+
+	// capture collects the trigger's profiles using w.session or
+	// w.sessions.
+	capture func(w *Watcher) error
+}
+
+// Watcher monitors the process for the condition described by a
+// Trigger. See Watch.
+type Watcher struct {
+	trigger Trigger
+	options []Option
+	quiet   bool
+	budget  budget
+
+	quit     chan struct{}
+	quitOnce sync.Once
+	done     chan struct{}
+
+	mu    sync.Mutex
+	files []string
+}
+
+// Watch checks the condition described by t every t.Interval until the
+// Watcher's Stop method is called, capturing profiles each time the
+// condition holds, but no more often than t.Cooldown. The profiles
+// are written by sessions started with the given options, for example
+// ProfilePath, together with the mode chosen by the trigger and
+// Timestamp. Give Budget to limit how much profiling is performed.
+// The names of the files written include the name of the trigger, for
+// example cpu-cpuabove-20060102T150405Z.pprof.
+func Watch(t Trigger, options ...Option) (*Watcher, error) {
+	if t.check == nil {
+		return nil, fmt.Errorf("profile: Watch requires a trigger created by this package")
+	}
+	if t.Interval <= 0 || t.Cooldown < 0 || t.Duration < 0 {
+		return nil, fmt.Errorf("profile: trigger interval must be positive, and cooldown and duration must not be negative")
+	}
+	w := &Watcher{
+		trigger: t,
+		options: options,
+		quit:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	if w.trigger.modes == nil {
+		p, err := configure(options...)
+		if err != nil {
+			return nil, err
+		}
+		w.trigger.modes = []Mode{p.mode}
+	}
+	for _, mode := range w.trigger.modes {
+		p, err := configure(w.sessionOptions(mode)...)
+		if err != nil {
+			return nil, err
+		}
+		if p.inMemory() {
+			return nil, fmt.Errorf("profile: Watch cannot be combined with WriteTo or CaptureInMemory")
+		}
+		w.quiet = p.quiet
+		w.budget = budget{
+			maxActive:   time.Duration(p.budgetActive * float64(budgetWindow)),
+			maxCaptures: p.budgetCaptures,
+		}
+	}
+	check, err := t.check()
+	if err != nil {
+		return nil, err
+	}
+	go w.run(check)
+	return w, nil
+}
+
+// sessionOptions returns the options for a session of the given mode.
+func (w *Watcher) sessionOptions(mode Mode, extra ...Option) []Option {
+	options := append([]Option(nil), w.options...)
+	options = append(options, w.trigger.options...)
+	options = append(options, func(p *Profile) error {
+		p.trigger, p.timestamp = w.trigger.name, true
+		return p.useMode(mode)
+	})
+	return append(options, extra...)
+}
+
+func (w *Watcher) run(check func() (bool, string)) {
+	defer close(w.done)
+	t := time.NewTicker(w.trigger.Interval)
+	defer t.Stop()
+	var last time.Time
+	for {
+		select {
+		case <-t.C:
+		case <-w.quit:
+			return
+		}
+		ok, desc := check()
+		if !ok || (!last.IsZero() && time.Since(last) < w.trigger.Cooldown) {
+			continue
+		}
+		last = time.Now()
+		if ok, why := w.budget.allow(last, w.trigger.Duration); !ok {
+			// the cooldown applies to skipped captures too, so
+			// that this is not logged every interval.
+			w.logf("profile: %s trigger fired, %s, but profiling is over budget, %s", w.trigger.name, desc, why)
+			continue
+		}
+		w.logf("profile: %s trigger fired, %s", w.trigger.name, desc)
+		if err := w.trigger.capture(w); err != nil {
+			w.logf("profile: %s trigger: %v", w.trigger.name, err)
+		}
+		w.budget.record(last, time.Since(last))
+	}
+}
+
+// session starts a session of the given mode and waits for it to
+// stop, either after d, or immediately if d is zero, recording the
+// files it writes.
+func (w *Watcher) session(mode Mode, d time.Duration) error {
+	return w.sessions([]Mode{mode}, d)
+}
+
+// sessions is like session, but runs a session of each of the given
+// modes at the same time.
+func (w *Watcher) sessions(modes []Mode, d time.Duration) error {
+	var extra []Option
+	if d > 0 {
+		extra = append(extra, Duration(d))
+	}
+	var ps []*Profile
+	var err error
+	for _, mode := range modes {
+		p, serr := StartErr(w.sessionOptions(mode, extra...)...)
+		if serr != nil {
+			err = serr
+			d = 0 // stop the sessions already started
+			break
+		}
+		ps = append(ps, p)
+	}
+	for _, p := range ps {
+		if d > 0 {
+			select {
+			case <-p.Done():
+			case <-w.quit:
+			}
+		}
+		if cerr := p.Close(); err == nil {
+			err = cerr
+		}
+		w.mu.Lock()
+		w.files = append(w.files, p.Result().Files...)
+		w.mu.Unlock()
+	}
+	return err
+}
+
+// Files returns the paths of the files written by the sessions the
+// Watcher has started.
+func (w *Watcher) Files() []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return append([]string(nil), w.files...)
+}
+
+// Stop stops checking the trigger's condition, stopping any session
+// capturing profiles, and waits for its data to be written.
+func (w *Watcher) Stop() {
+	w.quitOnce.Do(func() { close(w.quit) })
+	<-w.done
+}
+
+func (w *Watcher) logf(format string, args ...interface{}) {
+	if !w.quiet {
+		log.Printf(format, args...)
+	}
+}
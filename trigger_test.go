@@ -0,0 +1,233 @@
+package profile
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+)
+
+// waitForFiles waits for w to record at least n files.
+func waitForFiles(t *testing.T, w *Watcher, n int) []string {
+	t.Helper()
+	for end := time.Now().Add(10 * time.Second); time.Now().Before(end); time.Sleep(10 * time.Millisecond) {
+		if files := w.Files(); len(files) >= n {
+			return files
+		}
+	}
+	t.Fatalf("got files %q, want at least %d", w.Files(), n)
+	return nil
+}
+
+func TestWhenCPUAbove(t *testing.T) {
+	if _, err := processCPUTime(); err != nil {
+		t.Skip(err)
+	}
+	dir := t.TempDir()
+	trigger := WhenCPUAbove(1, 40*time.Millisecond)
+	trigger.Interval = 20 * time.Millisecond
+	trigger.Duration = 50 * time.Millisecond
+	w, err := Watch(trigger, ProfilePath(dir), Quiet, NoShutdownHook)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Stop()
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			default:
+				spin(time.Millisecond)
+			}
+		}
+	}()
+	files := waitForFiles(t, w, 1)
+	close(done)
+	w.Stop()
+	if matched, _ := filepath.Match(filepath.Join(dir, "cpu-cpuabove-*.pprof"), files[0]); !matched {
+		t.Fatalf("got file %q, want a cpu-cpuabove profile", files[0])
+	}
+	if len(w.Files()) != 1 {
+		t.Fatalf("got files %q, want one capture within the cooldown", w.Files())
+	}
+}
+
+func TestWhenHeapAbove(t *testing.T) {
+	dir := t.TempDir()
+	trigger := WhenHeapAbove(1)
+	trigger.Interval = 10 * time.Millisecond
+	w, err := Watch(trigger, MemProfileHeapAndAllocs, ProfilePath(dir), Quiet, NoShutdownHook)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := waitForFiles(t, w, 2)
+	time.Sleep(50 * time.Millisecond)
+	w.Stop()
+	if len(w.Files()) != 2 {
+		t.Fatalf("got files %q, want one capture while the heap stays above the threshold", w.Files())
+	}
+	for i, name := range []string{"heap", "allocs"} {
+		if matched, _ := filepath.Match(filepath.Join(dir, name+"-heapabove-*.pprof"), files[i]); !matched {
+			t.Fatalf("got file %q, want a %s-heapabove profile", files[i], name)
+		}
+	}
+}
+
+func TestWhenHeapAboveRate(t *testing.T) {
+	dir := t.TempDir()
+	trigger := WhenHeapAbove(1)
+	trigger.Interval = 10 * time.Millisecond
+	w, err := Watch(trigger, ProfilePath(dir), Quiet, NoShutdownHook)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := waitForFiles(t, w, 1)
+	w.Stop()
+	data, err := ioutil.ReadFile(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := parseProto(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.period == 0 {
+		t.Fatalf("%s: got period 0, want the memory profile rate", files[0])
+	}
+}
+
+func TestWhenGoroutinesAbove(t *testing.T) {
+	dir := t.TempDir()
+	trigger := WhenGoroutinesAbove(1)
+	trigger.Interval = 10 * time.Millisecond
+	trigger.Cooldown = 30 * time.Millisecond
+	w, err := Watch(trigger, ProfilePath(dir), Quiet, NoShutdownHook)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := waitForFiles(t, w, 2)
+	w.Stop()
+	if matched, _ := filepath.Match(filepath.Join(dir, "goroutine-goroutinesabove-*.txt"), files[0]); !matched {
+		t.Fatalf("got file %q, want a goroutine-goroutinesabove stack dump", files[0])
+	}
+	buf, err := ioutil.ReadFile(files[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(buf, []byte("goroutine ")) {
+		t.Fatalf("got %.40q, want full goroutine stacks", buf)
+	}
+}
+
+func TestWhenGCPauseAbove(t *testing.T) {
+	if _, _, err := readGCPauses(); err != nil {
+		t.Skip(err)
+	}
+	dir := t.TempDir()
+	trigger := WhenGCPauseAbove(time.Nanosecond)
+	trigger.Interval = 10 * time.Millisecond
+	trigger.Duration = 50 * time.Millisecond
+	w, err := Watch(trigger, ProfilePath(dir), Quiet, NoShutdownHook)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Stop()
+	runtime.GC()
+	files := waitForFiles(t, w, 2)
+	w.Stop()
+	for i, name := range []string{"mem-gcpauseabove-*.pprof", "trace-gcpauseabove-*.out"} {
+		if matched, _ := filepath.Match(filepath.Join(dir, name), files[i]); !matched {
+			t.Fatalf("got file %q, want %s", files[i], name)
+		}
+	}
+}
+
+func TestSampleWindow(t *testing.T) {
+	dir := t.TempDir()
+	w, err := Watch(SampleWindow(20*time.Millisecond, 40*time.Millisecond), MutexProfile, ProfilePath(dir), Quiet, NoShutdownHook)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := waitForFiles(t, w, 1)
+	w.Stop()
+	if matched, _ := filepath.Match(filepath.Join(dir, "mutex-window-*.pprof"), files[0]); !matched {
+		t.Fatalf("got file %q, want a mutex-window profile", files[0])
+	}
+}
+
+func TestWhenContentionAbove(t *testing.T) {
+	if _, err := readMutexWait(); err != nil {
+		t.Skip(err)
+	}
+	dir := t.TempDir()
+	trigger := WhenContentionAbove(time.Millisecond)
+	trigger.Interval = 20 * time.Millisecond
+	trigger.Duration = 50 * time.Millisecond
+	w, err := Watch(trigger, ProfilePath(dir), Quiet, NoShutdownHook)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Stop()
+
+	var mu sync.Mutex
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				mu.Lock()
+				time.Sleep(time.Millisecond)
+				mu.Unlock()
+			}
+		}()
+	}
+	files := waitForFiles(t, w, 2)
+	close(done)
+	wg.Wait()
+	w.Stop()
+	for i, name := range []string{"mutex-contentionabove-*.pprof", "block-contentionabove-*.pprof"} {
+		if matched, _ := filepath.Match(filepath.Join(dir, name), files[i]); !matched {
+			t.Fatalf("got file %q, want %s", files[i], name)
+		}
+	}
+}
+
+func TestWatchInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		trigger Trigger
+		options []Option
+	}{
+		{"zero trigger", Trigger{}, nil},
+		{"invalid percentage", WhenCPUAbove(120, time.Second), nil},
+		{"filename", WhenCPUAbove(80, time.Second), []Option{ProfileFilename("cpu.pprof")}},
+		{"zero heap", WhenHeapAbove(0), nil},
+		{"heap with cpu", WhenHeapAbove(1 << 30), []Option{CPUProfileRate(500)}},
+		{"zero goroutines", WhenGoroutinesAbove(0), nil},
+		{"zero pause", WhenGCPauseAbove(0), nil},
+		{"window longer than period", SampleWindow(time.Minute, time.Second), nil},
+		{"invalid fraction", WhenNearMemLimit(1.5), nil},
+		{"control file without path", ControlFile(""), nil},
+		{"zero contention", WhenContentionAbove(0), nil},
+		{"invalid budget", WhenGoroutinesAbove(1), []Option{Budget(2, 0)}},
+		{"capture in memory", WhenCPUAbove(80, time.Second), []Option{CaptureInMemory}},
+	}
+	for _, tt := range tests {
+		if w, err := Watch(tt.trigger, append(tt.options, Quiet)...); err == nil {
+			w.Stop()
+			t.Errorf("%s: expected error", tt.name)
+		}
+	}
+}
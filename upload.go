@@ -0,0 +1,145 @@
+package profile
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// An Uploader copies the files written by a session to remote
+// storage, so that profiles outlive the machine or container which
+// recorded them.
+type Uploader interface {
+	// Upload copies size bytes read from r to the remote file
+	// called name.
+	Upload(ctx context.Context, name string, r io.Reader, size int64) error
+}
+
+// DefaultUploadTimeout is the default time allowed to upload the
+// files written by a session.
+const DefaultUploadTimeout = time.Minute
+
+// Upload requests that each file written by the session is copied
+// with u when the session stops. Files are uploaded under their
+// base names; the Uploader may add a prefix. Upload may be given
+// more than once to copy files to several destinations. Errors
+// encountered while uploading are reported by Result.
+func Upload(u Uploader) Option {
+	return func(p *Profile) error {
+		if u == nil {
+			return fmt.Errorf("profile: Upload requires an Uploader")
+		}
+		p.uploaders = append(p.uploaders, u)
+		return nil
+	}
+}
+
+// UploadTimeout sets the time allowed to upload the files written by
+// the session when it stops. The default is DefaultUploadTimeout.
+func UploadTimeout(d time.Duration) Option {
+	return func(p *Profile) error {
+		if d <= 0 {
+			return fmt.Errorf("profile: upload timeout must be positive")
+		}
+		p.uploadTimeout = d
+		return nil
+	}
+}
+
+// UploadAsWritten requests that each file written by the session is
+// uploaded as soon as it is written, rather than when the session
+// stops, so that the snapshots of a long running session, see
+// Snapshot, reach remote storage or a continuous profiling service
+// while it runs. Each file is allowed the time set by UploadTimeout.
+// Files written without being uploaded, such as the manifest, are
+// uploaded when the session stops.
+func UploadAsWritten(p *Profile) error {
+	p.uploadAsWritten = true
+	return nil
+}
+
+// uploadWritten uploads the file fn, which has just been written,
+// recording the first error encountered to be reported by upload.
+func (p *Profile) uploadWritten(fn string) {
+	err := p.uploadFiles([]string{fn})
+	p.uploadMu.Lock()
+	defer p.uploadMu.Unlock()
+	if p.uploaded == nil {
+		p.uploaded = make(map[string]bool)
+	}
+	p.uploaded[fn] = true
+	if p.uploadErr == nil {
+		p.uploadErr = err
+	}
+}
+
+// upload copies the session's files with each of its uploaders,
+// except those already uploaded by uploadWritten.
+func (p *Profile) upload() error {
+	p.uploadMu.Lock()
+	var fns []string
+	for _, fn := range p.Files() {
+		if !p.uploaded[fn] {
+			fns = append(fns, fn)
+		}
+	}
+	err := p.uploadErr
+	p.uploadMu.Unlock()
+	if uerr := p.uploadFiles(fns); err == nil {
+		err = uerr
+	}
+	return err
+}
+
+// uploadFiles copies the files fns with each of the session's
+// uploaders.
+func (p *Profile) uploadFiles(fns []string) error {
+	timeout := p.uploadTimeout
+	if timeout == 0 {
+		timeout = DefaultUploadTimeout
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	ctx = context.WithValue(ctx, uploadModeKey{}, p.mode)
+	var err error
+	for _, fn := range fns {
+		for _, u := range p.uploaders {
+			if uerr := uploadFile(ctx, u, fn); uerr != nil {
+				p.logAttrs("profile: could not upload "+fn, "error", uerr)
+				if err == nil {
+					err = fmt.Errorf("profile: could not upload %s: %v", fn, uerr)
+				}
+				continue
+			}
+			p.logf("profile: uploaded %s", fn)
+		}
+	}
+	return err
+}
+
+// uploadModeKey is the context key of the mode of the session whose
+// files are being uploaded.
+type uploadModeKey struct{}
+
+// uploadMode returns the mode of the session whose files are being
+// uploaded with ctx, if known.
+func uploadMode(ctx context.Context) (Mode, bool) {
+	mode, ok := ctx.Value(uploadModeKey{}).(Mode)
+	return mode, ok
+}
+
+func uploadFile(ctx context.Context, u Uploader, fn string) error {
+	f, err := os.Open(fn)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	return u.Upload(ctx, filepath.Base(fn), f, fi.Size())
+}
@@ -0,0 +1,96 @@
+package profile
+
+import (
+	"fmt"
+	"time"
+)
+
+// Watchdog calls heartbeat every timeout while the session is running
+// and, if a call does not return within timeout, writes the stacks of
+// every goroutine, in the format of GoroutineProfileFullStacks, and
+// mutex and block profiles to the profile directory, named with the
+// time the hang was detected, for example
+// goroutine-watchdog-20060102T150405Z.txt. heartbeat should exercise
+// the part of the program suspected of hanging, for example by
+// acquiring a lock or sending a request to a worker. Nothing more is
+// written until a call to heartbeat returns. The mutex and block
+// profiles only hold data if mutex and block profiling have been
+// enabled, see runtime.SetMutexProfileFraction and
+// runtime.SetBlockProfileRate.
+func Watchdog(heartbeat func(), timeout time.Duration) Option {
+	return func(p *Profile) error {
+		if heartbeat == nil || timeout <= 0 {
+			return fmt.Errorf("profile: Watchdog requires a heartbeat function and a positive timeout")
+		}
+		p.heartbeat, p.heartbeatTimeout = heartbeat, timeout
+		return nil
+	}
+}
+
+// startWatchdog calls the heartbeat function until prof.closer is
+// called.
+func (prof *Profile) startWatchdog() {
+	quit := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			beat := make(chan struct{})
+			go func() {
+				prof.heartbeat()
+				close(beat)
+			}()
+			t := time.NewTimer(prof.heartbeatTimeout)
+			select {
+			case <-beat:
+			case <-t.C:
+				prof.logf("profile: watchdog heartbeat did not return within %v", prof.heartbeatTimeout)
+				prof.writeWatchdogDump()
+				select {
+				case <-beat:
+				case <-quit:
+					return
+				}
+			case <-quit:
+				t.Stop()
+				return
+			}
+			t.Stop()
+
+			// wait for the next heartbeat
+			t = time.NewTimer(prof.heartbeatTimeout)
+			select {
+			case <-t.C:
+			case <-quit:
+				t.Stop()
+				return
+			}
+		}
+	}()
+	closer := prof.closer
+	prof.closer = func() error {
+		close(quit)
+		<-done
+		return closer()
+	}
+}
+
+// writeWatchdogDump writes the profiles for Watchdog.
+func (prof *Profile) writeWatchdogDump() {
+	suffix := "watchdog-" + time.Now().UTC().Format(timestampLayout)
+	for _, s := range []struct {
+		name  string
+		debug int
+	}{
+		{"goroutine", 2},
+		{"mutex", 0},
+		{"block", 0},
+	} {
+		fn, err := prof.writeSnapshot(s.name, suffix, s.debug)
+		if err != nil {
+			prof.logAttrs("profile: could not write watchdog "+s.name+" profile", "name", s.name, "error", err)
+			continue
+		}
+		prof.logAttrs("profile: watchdog "+s.name+" profile written", "name", s.name, "path", fn)
+	}
+}
@@ -0,0 +1,45 @@
+package profile
+
+import (
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWatchdog(t *testing.T) {
+	dir := t.TempDir()
+	var mu sync.Mutex
+	heartbeat := func() {
+		mu.Lock()
+		mu.Unlock()
+	}
+	p, err := StartErr(CPUProfile, Watchdog(heartbeat, 20*time.Millisecond), ProfilePath(dir), Quiet, NoShutdownHook)
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if files := p.Files(); len(files) != 1 {
+		t.Fatalf("got files %q while the heartbeat was returning", files)
+	}
+
+	mu.Lock()
+	for end := time.Now().Add(10 * time.Second); len(p.Files()) < 4 && time.Now().Before(end); {
+		time.Sleep(10 * time.Millisecond)
+	}
+	time.Sleep(50 * time.Millisecond)
+	mu.Unlock()
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	files := p.Result().Files
+	if len(files) != 4 {
+		t.Fatalf("got files %q, want the profile and one watchdog dump", files)
+	}
+	for i, name := range []string{"goroutine-watchdog-*.txt", "mutex-watchdog-*.pprof", "block-watchdog-*.pprof"} {
+		if matched, _ := filepath.Match(filepath.Join(dir, name), files[i+1]); !matched {
+			t.Fatalf("got file %q, want %s", files[i+1], name)
+		}
+	}
+}